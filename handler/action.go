@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"context"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/sdk"
+	"sort"
+	"sync"
+)
+
+// ActionRequest describes the remediation action requested by an action.triggered event
+type ActionRequest struct {
+	// Event is the decoded data of the action.triggered event
+	Event keptnv2.ActionTriggeredEventData
+	// Parameters is the value of the action decoded into the type returned by NewParameters of a ParameterizedAction,
+	// nil for other actions
+	Parameters interface{}
+	// Target is the workload derived from the problem of the event, empty if no target rule matched
+	Target ActionTarget
+}
+
+// ActionTarget is the workload a remediation action is applied to
+type ActionTarget struct {
+	// Name is the name of the workload, the service of the event if empty
+	Name string
+	// Namespace is the namespace of the workload, determined by the namespace template of the action if empty
+	Namespace string
+}
+
+// Name returns the name of the requested action
+func (r ActionRequest) Name() string {
+	return r.Event.Action.Action
+}
+
+// TargetName returns the name of the workload the action is applied to
+func (r ActionRequest) TargetName() string {
+	if r.Target.Name != "" {
+		return r.Target.Name
+	}
+	return r.Event.Service
+}
+
+// TargetNamespace returns the namespace of the workload the action is applied to, rendering the given template if the target does not define one
+func (r ActionRequest) TargetNamespace(namespace *NamespaceTemplate) (string, error) {
+	if r.Target.Namespace != "" {
+		return r.Target.Namespace, nil
+	}
+	return namespace.Namespace(r.Event.EventData)
+}
+
+// ActionResult is reported in the action.finished event after an action was executed
+type ActionResult struct {
+	// Result is the result of the action, pass if empty
+	Result keptnv2.ResultType
+	// Message describes what the action did
+	Message string
+}
+
+// Action is a remediation action that can be triggered by action.triggered events
+type Action interface {
+	// Describe returns a human readable description of what the action will do for the given request
+	Describe(req ActionRequest) string
+	// Validate checks whether the action can be executed for the given request before it is executed
+	Validate(req ActionRequest) error
+	// Execute performs the action. Returning an error reports the action as errored
+	Execute(ctx context.Context, k sdk.IKeptn, req ActionRequest) (ActionResult, error)
+}
+
+// ActionRegistry maps action names to the Action executed for them
+type ActionRegistry struct {
+	mutex   sync.RWMutex
+	actions map[string]Action
+}
+
+// NewActionRegistry creates a new, empty ActionRegistry
+func NewActionRegistry() *ActionRegistry {
+	return &ActionRegistry{
+		actions: map[string]Action{},
+	}
+}
+
+// Register makes the action responsible for action.triggered events with the given name.
+// An already registered action with the same name is replaced
+func (r *ActionRegistry) Register(name string, action Action) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.actions[name] = action
+}
+
+// Get returns the action registered for the given name
+func (r *ActionRegistry) Get(name string) (Action, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	action, ok := r.actions[name]
+	return action, ok
+}
+
+// Names returns the sorted names of all registered actions
+func (r *ActionRegistry) Names() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	names := make([]string, 0, len(r.actions))
+	for name := range r.actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
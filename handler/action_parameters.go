@@ -0,0 +1,258 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParameterType is the type of a value described by a ParameterSchema
+type ParameterType string
+
+const (
+	// ParameterTypeAny accepts every value
+	ParameterTypeAny     ParameterType = ""
+	ParameterTypeObject  ParameterType = "object"
+	ParameterTypeString  ParameterType = "string"
+	ParameterTypeNumber  ParameterType = "number"
+	ParameterTypeInteger ParameterType = "integer"
+	ParameterTypeBoolean ParameterType = "boolean"
+)
+
+// ParameterSchema describes the value of an action, similar to a JSON schema.
+// As values in remediation.yaml files are often quoted, strings are accepted for numbers and booleans
+// and objects may be given as JSON encoded string
+type ParameterSchema struct {
+	Type        ParameterType
+	Description string
+	// Properties describes the properties of an object
+	Properties map[string]*ParameterSchema
+	// Required lists the properties of an object that must be set
+	Required []string
+	// AdditionalProperties allows properties of an object that are not described by Properties
+	AdditionalProperties bool
+	// Enum lists the allowed values
+	Enum []interface{}
+	// Minimum and Maximum limit numbers
+	Minimum *float64
+	Maximum *float64
+	// Pattern is a regular expression strings must match
+	Pattern string
+	// Optional allows omitting a value that is not an object, it is decoded as the zero value
+	Optional bool
+}
+
+// ParameterizedAction is an Action whose value is validated against a schema and decoded before it is executed.
+// The decoded value is passed to Validate and Execute in ActionRequest.Parameters
+type ParameterizedAction interface {
+	Action
+	// ParameterSchema returns the schema the value of the action must match
+	ParameterSchema() *ParameterSchema
+	// NewParameters returns a pointer to the value the validated value is decoded into, e.g. a struct with json tags
+	NewParameters() interface{}
+}
+
+// decodeActionParameters validates the value of the request against the schema of a ParameterizedAction
+// and decodes it into the Parameters of the request
+func decodeActionParameters(action Action, req ActionRequest) (ActionRequest, error) {
+	parameterized, ok := action.(ParameterizedAction)
+	if !ok {
+		return req, nil
+	}
+
+	value, err := parameterized.ParameterSchema().normalize("value", req.Event.Action.Value)
+	if err != nil {
+		return req, err
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return req, fmt.Errorf("could not encode value: %w", err)
+	}
+	parameters := parameterized.NewParameters()
+	if err := json.Unmarshal(encoded, parameters); err != nil {
+		return req, fmt.Errorf("could not decode value: %w", err)
+	}
+
+	req.Parameters = parameters
+	return req, nil
+}
+
+// normalize validates the given value and converts it to the types described by the schema
+func (s *ParameterSchema) normalize(path string, value interface{}) (interface{}, error) {
+	if value == nil {
+		switch {
+		case s.Type == ParameterTypeObject:
+			value = map[string]interface{}{}
+		case s.Optional:
+			return nil, nil
+		default:
+			return nil, fmt.Errorf("%s is required", path)
+		}
+	}
+
+	var normalized interface{}
+	var err error
+	switch s.Type {
+	case ParameterTypeAny:
+		normalized = value
+	case ParameterTypeObject:
+		normalized, err = s.normalizeObject(path, value)
+	case ParameterTypeString:
+		normalized, err = s.normalizeString(path, value)
+	case ParameterTypeNumber, ParameterTypeInteger:
+		normalized, err = s.normalizeNumber(path, value)
+	case ParameterTypeBoolean:
+		normalized, err = normalizeBoolean(path, value)
+	default:
+		err = fmt.Errorf("%s has unsupported type %s in schema", path, s.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.Enum) > 0 && !s.allows(normalized) {
+		allowed := make([]string, 0, len(s.Enum))
+		for _, v := range s.Enum {
+			allowed = append(allowed, fmt.Sprint(v))
+		}
+		return nil, fmt.Errorf("%s must be one of %s, got %v", path, strings.Join(allowed, ", "), normalized)
+	}
+	return normalized, nil
+}
+
+func (s *ParameterSchema) normalizeObject(path string, value interface{}) (map[string]interface{}, error) {
+	if encoded, ok := value.(string); ok {
+		decoded := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(encoded), &decoded); err != nil {
+			return nil, fmt.Errorf("%s must be an object", path)
+		}
+		value = decoded
+	}
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be an object", path)
+	}
+
+	for _, name := range s.Required {
+		if v, ok := object[name]; !ok || v == nil {
+			return nil, fmt.Errorf("%s.%s is required", path, name)
+		}
+	}
+
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	normalized := map[string]interface{}{}
+	for _, name := range names {
+		property, ok := s.Properties[name]
+		if !ok {
+			if !s.AdditionalProperties {
+				return nil, fmt.Errorf("%s.%s is not a known parameter", path, name)
+			}
+			normalized[name] = object[name]
+			continue
+		}
+		if object[name] == nil {
+			continue
+		}
+		v, err := property.normalize(path+"."+name, object[name])
+		if err != nil {
+			return nil, err
+		}
+		normalized[name] = v
+	}
+	return normalized, nil
+}
+
+func (s *ParameterSchema) normalizeString(path string, value interface{}) (string, error) {
+	str, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("%s must be a string, got %v", path, value)
+	}
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return "", fmt.Errorf("%s has an invalid pattern in schema: %w", path, err)
+		}
+		if !pattern.MatchString(str) {
+			return "", fmt.Errorf("%s must match %s, got %q", path, s.Pattern, str)
+		}
+	}
+	return str, nil
+}
+
+func (s *ParameterSchema) normalizeNumber(path string, value interface{}) (float64, error) {
+	var number float64
+	switch v := value.(type) {
+	case float64:
+		number = v
+	case int:
+		number = float64(v)
+	case json.Number:
+		parsed, err := v.Float64()
+		if err != nil {
+			return 0, fmt.Errorf("%s must be a number, got %v", path, v)
+		}
+		number = parsed
+	case string:
+		parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s must be a number, got %q", path, v)
+		}
+		number = parsed
+	default:
+		return 0, fmt.Errorf("%s must be a number, got %v", path, v)
+	}
+
+	if math.IsNaN(number) || math.IsInf(number, 0) {
+		return 0, fmt.Errorf("%s must be a finite number", path)
+	}
+	if s.Type == ParameterTypeInteger && number != math.Trunc(number) {
+		return 0, fmt.Errorf("%s must be an integer, got %v", path, number)
+	}
+	if s.Minimum != nil && number < *s.Minimum {
+		return 0, fmt.Errorf("%s must be at least %v, got %v", path, *s.Minimum, number)
+	}
+	if s.Maximum != nil && number > *s.Maximum {
+		return 0, fmt.Errorf("%s must be at most %v, got %v", path, *s.Maximum, number)
+	}
+	return number, nil
+}
+
+func normalizeBoolean(path string, value interface{}) (bool, error) {
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		parsed, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return false, fmt.Errorf("%s must be a boolean, got %q", path, v)
+		}
+		return parsed, nil
+	default:
+		return false, fmt.Errorf("%s must be a boolean, got %v", path, v)
+	}
+}
+
+// allows returns true if the value is listed in the enum of the schema
+func (s *ParameterSchema) allows(value interface{}) bool {
+	for _, allowed := range s.Enum {
+		if fmt.Sprint(allowed) == fmt.Sprint(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// float64Ptr returns a pointer to the given value, e.g. for the Minimum and Maximum of a ParameterSchema
+func float64Ptr(value float64) *float64 {
+	return &value
+}
@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"context"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/sdk"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type testFeatureToggleParameters struct {
+	Feature string  `json:"feature"`
+	Enabled bool    `json:"enabled"`
+	Percent float64 `json:"percent"`
+}
+
+// testFeatureToggleAction is a ParameterizedAction recording the parameters it was executed with
+type testFeatureToggleAction struct {
+	executed *testFeatureToggleParameters
+}
+
+func (a *testFeatureToggleAction) ParameterSchema() *ParameterSchema {
+	return &ParameterSchema{
+		Type: ParameterTypeObject,
+		Properties: map[string]*ParameterSchema{
+			"feature": {Type: ParameterTypeString, Pattern: "^[a-z-]+$"},
+			"enabled": {Type: ParameterTypeBoolean},
+			"percent": {Type: ParameterTypeNumber, Minimum: float64Ptr(0), Maximum: float64Ptr(100)},
+		},
+		Required: []string{"feature", "enabled"},
+	}
+}
+
+func (a *testFeatureToggleAction) NewParameters() interface{} {
+	return &testFeatureToggleParameters{Percent: 100}
+}
+
+func (a *testFeatureToggleAction) Describe(req ActionRequest) string {
+	return "toggle feature"
+}
+
+func (a *testFeatureToggleAction) Validate(req ActionRequest) error {
+	return nil
+}
+
+func (a *testFeatureToggleAction) Execute(ctx context.Context, k sdk.IKeptn, req ActionRequest) (ActionResult, error) {
+	a.executed = req.Parameters.(*testFeatureToggleParameters)
+	return ActionResult{}, nil
+}
+
+func Test_decodeActionParameters(t *testing.T) {
+	tests := []struct {
+		name           string
+		value          interface{}
+		wantParameters *testFeatureToggleParameters
+		wantErr        string
+	}{
+		{
+			name:           "object",
+			value:          map[string]interface{}{"feature": "promotion", "enabled": false, "percent": 50.0},
+			wantParameters: &testFeatureToggleParameters{Feature: "promotion", Enabled: false, Percent: 50},
+		},
+		{
+			name:           "quoted values and default",
+			value:          map[string]interface{}{"feature": "promotion", "enabled": "true"},
+			wantParameters: &testFeatureToggleParameters{Feature: "promotion", Enabled: true, Percent: 100},
+		},
+		{
+			name:           "JSON encoded object",
+			value:          `{"feature": "promotion", "enabled": true, "percent": "10"}`,
+			wantParameters: &testFeatureToggleParameters{Feature: "promotion", Enabled: true, Percent: 10},
+		},
+		{
+			name:    "missing value",
+			value:   nil,
+			wantErr: "value.feature is required",
+		},
+		{
+			name:    "no object",
+			value:   "promotion",
+			wantErr: "value must be an object",
+		},
+		{
+			name:    "missing required property",
+			value:   map[string]interface{}{"feature": "promotion"},
+			wantErr: "value.enabled is required",
+		},
+		{
+			name:    "unknown property",
+			value:   map[string]interface{}{"feature": "promotion", "enabled": true, "rollout": 10.0},
+			wantErr: "value.rollout is not a known parameter",
+		},
+		{
+			name:    "pattern not matched",
+			value:   map[string]interface{}{"feature": "Promotion", "enabled": true},
+			wantErr: `value.feature must match ^[a-z-]+$, got "Promotion"`,
+		},
+		{
+			name:    "invalid boolean",
+			value:   map[string]interface{}{"feature": "promotion", "enabled": "yes"},
+			wantErr: `value.enabled must be a boolean, got "yes"`,
+		},
+		{
+			name:    "number below minimum",
+			value:   map[string]interface{}{"feature": "promotion", "enabled": true, "percent": -5.0},
+			wantErr: "value.percent must be at least 0, got -5",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := decodeActionParameters(&testFeatureToggleAction{}, newActionRequest(t, tt.value))
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantParameters, req.Parameters)
+		})
+	}
+}
+
+func Test_decodeActionParameters_NotParameterized(t *testing.T) {
+	action := actionFunc(func(ctx context.Context, k sdk.IKeptn, req ActionRequest) (ActionResult, error) {
+		return ActionResult{}, nil
+	})
+	req, err := decodeActionParameters(action, newActionRequest(t, "anything"))
+
+	require.NoError(t, err)
+	require.Nil(t, req.Parameters)
+}
+
+func Test_decodeActionParameters_BuiltInActions(t *testing.T) {
+	tests := []struct {
+		name           string
+		action         Action
+		value          interface{}
+		wantErr        string
+		wantParameters interface{}
+	}{
+		{
+			name:           "rollout-restart without value",
+			action:         NewRolloutRestartAction(nil),
+			wantParameters: &struct{}{},
+		},
+		{
+			name:    "rollout-restart with parameter",
+			action:  NewRolloutRestartAction(nil),
+			value:   map[string]interface{}{"replicas": 2.0},
+			wantErr: "value.replicas is not a known parameter",
+		},
+		{
+			name:    "rollout-restart with scalar",
+			action:  NewRolloutRestartAction(nil),
+			value:   "1",
+			wantErr: "value must be an object",
+		},
+		{
+			name:           "script with string",
+			action:         NewScriptAction("restart-cache"),
+			value:          "redis",
+			wantParameters: stringPtr("redis"),
+		},
+		{
+			name:           "script without value",
+			action:         NewScriptAction("restart-cache"),
+			wantParameters: stringPtr(""),
+		},
+		{
+			name:    "script with object",
+			action:  NewScriptAction("restart-cache"),
+			value:   map[string]interface{}{"cache": "redis"},
+			wantErr: "value must be a string, got map[cache:redis]",
+		},
+		{
+			name:    "webhook without value type",
+			action:  NewWebhookAction(WebhookDefinition{URL: "https://hooks.example.com"}, nil),
+			value:   "1",
+			wantErr: "value must be an object",
+		},
+		{
+			name:    "webhook with value of another type",
+			action:  NewWebhookAction(WebhookDefinition{URL: "https://hooks.example.com", Value: ParameterTypeInteger}, nil),
+			value:   "many",
+			wantErr: `value must be a number, got "many"`,
+		},
+		{
+			name:    "example with object",
+			action:  NewExampleAction(0),
+			value:   map[string]interface{}{"wait": "1s"},
+			wantErr: "value must be a string, got map[wait:1s]",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := decodeActionParameters(tt.action, newActionRequest(t, tt.value))
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantParameters, req.Parameters)
+		})
+	}
+}
+
+func Test_ParameterSchema_Enum(t *testing.T) {
+	schema := &ParameterSchema{Type: ParameterTypeString, Enum: []interface{}{"low", "high"}}
+
+	value, err := schema.normalize("value", "high")
+	require.NoError(t, err)
+	require.Equal(t, "high", value)
+
+	_, err = schema.normalize("value", "medium")
+	require.EqualError(t, err, "value must be one of low, high, got medium")
+}
+
+func Test_Receiving_GetActionTriggeredEvent_InvalidParameters(t *testing.T) {
+	action := &testFeatureToggleAction{}
+	actions := NewActionRegistry()
+	actions.Register("action-xyz", action)
+
+	fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+	fakeKeptn.AddTaskHandler("sh.keptn.event.action.triggered", NewActionTriggeredEventHandler(WithActions(actions)))
+
+	fakeKeptn.NewEvent(newEvent("../test/events/action_triggered.json"))
+
+	fakeKeptn.AssertNumberOfEventSent(t, 2)
+	fakeKeptn.AssertSentEventStatus(t, 1, keptnv2.StatusErrored)
+	fakeKeptn.AssertSentEventResult(t, 1, keptnv2.ResultFailed)
+	require.Equal(t, "invalid action action-xyz: value must be an object", getActionFinishedEventData(t, fakeKeptn.SentEvents[1]).Message)
+	require.Nil(t, action.executed)
+}
@@ -0,0 +1,349 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"io/ioutil"
+	corev1 "k8s.io/api/core/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultActionRecordRetention is the duration records of handled action.triggered events are kept
+const defaultActionRecordRetention = 24 * time.Hour
+
+// maxConfigMapActionRecordSize is the size the data of the ConfigMap of a ConfigMapActionRecordStore is limited to,
+// leaving room for its metadata within the 1 MiB limit of ConfigMaps
+const maxConfigMapActionRecordSize = 900 * 1024
+
+// ActionRecord is stored for an action.triggered event to detect redeliveries of the event
+type ActionRecord struct {
+	// Completed is false while the action is in progress
+	Completed bool `json:"completed"`
+	// Status, Result and Message are the data of the action.finished event sent for a completed action
+	Status  keptnv2.StatusType `json:"status,omitempty"`
+	Result  keptnv2.ResultType `json:"result,omitempty"`
+	Message string             `json:"message,omitempty"`
+	// Time is when the record was stored
+	Time time.Time `json:"time"`
+	// Expires is when an action in progress is considered abandoned, e.g. because the service restarted while executing it,
+	// so that a redelivered event can claim it again. Claims without it are kept until the retention of the store
+	Expires time.Time `json:"expires"`
+}
+
+// abandoned returns whether the record is the claim of an action in progress that expired
+func (r ActionRecord) abandoned(now time.Time) bool {
+	return !r.Completed && !r.Expires.IsZero() && !now.Before(r.Expires)
+}
+
+// ActionRecordStore stores an ActionRecord per action.triggered event, keyed by its shkeptncontext and ID.
+// Records expire after the retention of the store
+type ActionRecordStore interface {
+	// Claim stores the record unless a record exists for the key that is not an abandoned claim.
+	// It returns the existing record or nil if the record was stored
+	Claim(ctx context.Context, key string, record ActionRecord) (*ActionRecord, error)
+	// Put stores the record, replacing an existing record for the key
+	Put(ctx context.Context, key string, record ActionRecord) error
+	// Delete removes the record for the key
+	Delete(ctx context.Context, key string) error
+}
+
+// actionRecordKey returns the key of the records of the given action.triggered event
+func actionRecordKey(shkeptncontext string, eventID string) string {
+	return shkeptncontext + "." + eventID
+}
+
+// actionRecords maps keys to records, it is shared by the ActionRecordStore implementations
+type actionRecords map[string]ActionRecord
+
+// claim stores the record unless a record exists for the key that is not abandoned and returns the existing record
+func (r actionRecords) claim(key string, record ActionRecord, now time.Time) *ActionRecord {
+	if existing, ok := r[key]; ok && !existing.abandoned(now) {
+		return &existing
+	}
+	r[key] = record
+	return nil
+}
+
+// prune removes the records stored longer than the retention ago
+func (r actionRecords) prune(now time.Time, retention time.Duration) {
+	for key, record := range r {
+		if now.Sub(record.Time) > retention {
+			delete(r, key)
+		}
+	}
+}
+
+// encodedActionRecords encodes the records as data of a ConfigMap. If the data exceeds maxSize,
+// the oldest records except the one for the given key are dropped until it fits
+func encodedActionRecords(records actionRecords, key string, maxSize int) (map[string]string, error) {
+	data := make(map[string]string, len(records))
+	size := 0
+	for k, record := range records {
+		encoded, err := json.Marshal(record)
+		if err != nil {
+			return nil, err
+		}
+		data[k] = string(encoded)
+		size += len(k) + len(encoded)
+	}
+
+	if size <= maxSize {
+		return data, nil
+	}
+	keys := make([]string, 0, len(records))
+	for k := range records {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return records[keys[i]].Time.Before(records[keys[j]].Time)
+	})
+	for _, k := range keys {
+		if size <= maxSize {
+			break
+		}
+		if k == key {
+			continue
+		}
+		size -= len(k) + len(data[k])
+		delete(data, k)
+	}
+	return data, nil
+}
+
+// MemoryActionRecordStore keeps the records in memory, they are lost when the service restarts
+type MemoryActionRecordStore struct {
+	mutex     sync.Mutex
+	records   actionRecords
+	retention time.Duration
+	now       func() time.Time
+}
+
+// NewMemoryActionRecordStore creates a MemoryActionRecordStore keeping records for the given retention, 24h if it is 0
+func NewMemoryActionRecordStore(retention time.Duration) *MemoryActionRecordStore {
+	if retention <= 0 {
+		retention = defaultActionRecordRetention
+	}
+	return &MemoryActionRecordStore{
+		records:   actionRecords{},
+		retention: retention,
+		now:       time.Now,
+	}
+}
+
+// Claim stores the record unless a record exists for the key
+func (s *MemoryActionRecordStore) Claim(ctx context.Context, key string, record ActionRecord) (*ActionRecord, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.records.prune(s.now(), s.retention)
+	return s.records.claim(key, record, s.now()), nil
+}
+
+// Put stores the record
+func (s *MemoryActionRecordStore) Put(ctx context.Context, key string, record ActionRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.records[key] = record
+	return nil
+}
+
+// Delete removes the record for the key
+func (s *MemoryActionRecordStore) Delete(ctx context.Context, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+// FileActionRecordStore keeps the records in a JSON file, e.g. on a persistent volume, so they survive restarts.
+// The file must not be shared by several replicas of the service
+type FileActionRecordStore struct {
+	mutex     sync.Mutex
+	path      string
+	retention time.Duration
+	now       func() time.Time
+}
+
+// NewFileActionRecordStore creates a FileActionRecordStore keeping records in the given file for the given retention, 24h if it is 0
+func NewFileActionRecordStore(path string, retention time.Duration) *FileActionRecordStore {
+	if retention <= 0 {
+		retention = defaultActionRecordRetention
+	}
+	return &FileActionRecordStore{
+		path:      path,
+		retention: retention,
+		now:       time.Now,
+	}
+}
+
+// Claim stores the record unless a record exists for the key
+func (s *FileActionRecordStore) Claim(ctx context.Context, key string, record ActionRecord) (*ActionRecord, error) {
+	return s.update(func(records actionRecords) *ActionRecord {
+		return records.claim(key, record, s.now())
+	})
+}
+
+// Put stores the record
+func (s *FileActionRecordStore) Put(ctx context.Context, key string, record ActionRecord) error {
+	_, err := s.update(func(records actionRecords) *ActionRecord {
+		records[key] = record
+		return nil
+	})
+	return err
+}
+
+// Delete removes the record for the key
+func (s *FileActionRecordStore) Delete(ctx context.Context, key string) error {
+	_, err := s.update(func(records actionRecords) *ActionRecord {
+		delete(records, key)
+		return nil
+	})
+	return err
+}
+
+// update reads the records from the file, applies fn and writes them back unless fn returned an existing record
+func (s *FileActionRecordStore) update(fn func(records actionRecords) *ActionRecord) (*ActionRecord, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	records := actionRecords{}
+	content, err := ioutil.ReadFile(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not read action records: %w", err)
+	}
+	if len(content) > 0 {
+		if err := json.Unmarshal(content, &records); err != nil {
+			return nil, fmt.Errorf("could not parse action records in %s: %w", s.path, err)
+		}
+	}
+
+	records.prune(s.now(), s.retention)
+	if existing := fn(records); existing != nil {
+		return existing, nil
+	}
+
+	content, err = json.Marshal(records)
+	if err != nil {
+		return nil, fmt.Errorf("could not encode action records: %w", err)
+	}
+	if err := writeFileAtomic(s.path, content); err != nil {
+		return nil, fmt.Errorf("could not write action records: %w", err)
+	}
+	return nil, nil
+}
+
+// ConfigMapActionRecordStore keeps the records in a Kubernetes ConfigMap, so they are shared by all replicas of the service.
+// The ConfigMap is created if it does not exist, concurrent updates are detected by its resourceVersion
+type ConfigMapActionRecordStore struct {
+	clientset kubernetes.Interface
+	namespace string
+	name      string
+	retention time.Duration
+	maxSize   int
+	now       func() time.Time
+}
+
+// NewConfigMapActionRecordStore creates a ConfigMapActionRecordStore keeping records in the given ConfigMap for the given retention, 24h if it is 0
+func NewConfigMapActionRecordStore(clientset kubernetes.Interface, namespace string, name string, retention time.Duration) *ConfigMapActionRecordStore {
+	if retention <= 0 {
+		retention = defaultActionRecordRetention
+	}
+	return &ConfigMapActionRecordStore{
+		clientset: clientset,
+		namespace: namespace,
+		name:      name,
+		retention: retention,
+		maxSize:   maxConfigMapActionRecordSize,
+		now:       time.Now,
+	}
+}
+
+// Claim stores the record unless a record exists for the key
+func (s *ConfigMapActionRecordStore) Claim(ctx context.Context, key string, record ActionRecord) (*ActionRecord, error) {
+	return s.update(ctx, key, func(records actionRecords) *ActionRecord {
+		return records.claim(key, record, s.now())
+	})
+}
+
+// Put stores the record
+func (s *ConfigMapActionRecordStore) Put(ctx context.Context, key string, record ActionRecord) error {
+	_, err := s.update(ctx, key, func(records actionRecords) *ActionRecord {
+		records[key] = record
+		return nil
+	})
+	return err
+}
+
+// Delete removes the record for the key
+func (s *ConfigMapActionRecordStore) Delete(ctx context.Context, key string) error {
+	_, err := s.update(ctx, key, func(records actionRecords) *ActionRecord {
+		delete(records, key)
+		return nil
+	})
+	return err
+}
+
+// update reads the records from the ConfigMap, applies fn and writes them back unless fn returned an existing record.
+// The oldest records are dropped if the ConfigMap would exceed its size limit. The update is retried if the ConfigMap was modified concurrently
+func (s *ConfigMapActionRecordStore) update(ctx context.Context, key string, fn func(records actionRecords) *ActionRecord) (*ActionRecord, error) {
+	if errs := validation.IsConfigMapKey(key); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid action record key %q: %s", key, strings.Join(errs, ", "))
+	}
+
+	var existing *ActionRecord
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		configMaps := s.clientset.CoreV1().ConfigMaps(s.namespace)
+		configMap, err := configMaps.Get(ctx, s.name, metav1.GetOptions{})
+		create := k8serrors.IsNotFound(err)
+		if create {
+			configMap = &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: s.namespace, Name: s.name}}
+		} else if err != nil {
+			return err
+		}
+
+		records := actionRecords{}
+		for k, v := range configMap.Data {
+			record := ActionRecord{}
+			if err := json.Unmarshal([]byte(v), &record); err != nil {
+				// drop records that cannot be parsed instead of blocking all actions
+				continue
+			}
+			records[k] = record
+		}
+
+		records.prune(s.now(), s.retention)
+		if existing = fn(records); existing != nil {
+			return nil
+		}
+
+		configMap.Data, err = encodedActionRecords(records, key, s.maxSize)
+		if err != nil {
+			return err
+		}
+
+		if create {
+			_, err = configMaps.Create(ctx, configMap, metav1.CreateOptions{})
+			if k8serrors.IsAlreadyExists(err) {
+				// created concurrently, retry with the existing ConfigMap
+				return k8serrors.NewConflict(corev1.Resource("configmaps"), s.name, err)
+			}
+			return err
+		}
+		_, err = configMaps.Update(ctx, configMap, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not update action records in configmap %s in namespace %s: %w", s.name, s.namespace, err)
+	}
+	return existing, nil
+}
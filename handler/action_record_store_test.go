@@ -0,0 +1,260 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/sdk"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_ActionRecordStores(t *testing.T) {
+	now := time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC)
+	clock := func() time.Time { return now }
+
+	tests := []struct {
+		name  string
+		store func(t *testing.T) ActionRecordStore
+	}{
+		{
+			name: "memory",
+			store: func(t *testing.T) ActionRecordStore {
+				store := NewMemoryActionRecordStore(time.Hour)
+				store.now = clock
+				return store
+			},
+		},
+		{
+			name: "file",
+			store: func(t *testing.T) ActionRecordStore {
+				store := NewFileActionRecordStore(filepath.Join(t.TempDir(), "records.json"), time.Hour)
+				store.now = clock
+				return store
+			},
+		},
+		{
+			name: "configmap",
+			store: func(t *testing.T) ActionRecordStore {
+				store := NewConfigMapActionRecordStore(fake.NewSimpleClientset(), "keptn", "action-records", time.Hour)
+				store.now = clock
+				return store
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := tt.store(t)
+			inProgress := ActionRecord{Time: now}
+			completed := ActionRecord{Completed: true, Status: keptnv2.StatusSucceeded, Result: keptnv2.ResultPass, Message: "restarted", Time: now}
+
+			existing, err := store.Claim(ctx, "context.event-1", inProgress)
+			require.NoError(t, err)
+			require.Nil(t, existing)
+
+			existing, err = store.Claim(ctx, "context.event-1", inProgress)
+			require.NoError(t, err)
+			require.Equal(t, &inProgress, existing)
+
+			require.NoError(t, store.Put(ctx, "context.event-1", completed))
+			existing, err = store.Claim(ctx, "context.event-1", inProgress)
+			require.NoError(t, err)
+			require.Equal(t, &completed, existing)
+
+			require.NoError(t, store.Delete(ctx, "context.event-1"))
+			existing, err = store.Claim(ctx, "context.event-1", inProgress)
+			require.NoError(t, err)
+			require.Nil(t, existing)
+
+			// an action in progress for longer than its claim is abandoned and can be claimed again
+			abandoned := ActionRecord{Time: now, Expires: now.Add(time.Minute)}
+			require.NoError(t, store.Put(ctx, "context.event-2", abandoned))
+			existing, err = store.Claim(ctx, "context.event-2", inProgress)
+			require.NoError(t, err)
+			require.Equal(t, &abandoned, existing)
+			now = now.Add(time.Minute)
+			existing, err = store.Claim(ctx, "context.event-2", ActionRecord{Time: now, Expires: now.Add(time.Minute)})
+			require.NoError(t, err)
+			require.Nil(t, existing)
+
+			// records expire after the retention
+			now = now.Add(2 * time.Hour)
+			existing, err = store.Claim(ctx, "context.event-1", ActionRecord{Time: now})
+			require.NoError(t, err)
+			require.Nil(t, existing)
+		})
+	}
+}
+
+func Test_FileActionRecordStore_SurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "records.json")
+	record := ActionRecord{Completed: true, Status: keptnv2.StatusSucceeded, Result: keptnv2.ResultPass, Time: time.Now().UTC().Truncate(time.Second)}
+	require.NoError(t, NewFileActionRecordStore(path, 0).Put(context.Background(), "context.event-1", record))
+
+	existing, err := NewFileActionRecordStore(path, 0).Claim(context.Background(), "context.event-1", ActionRecord{})
+	require.NoError(t, err)
+	require.Equal(t, &record, existing)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("{"), 0600))
+	_, err = NewFileActionRecordStore(path, 0).Claim(context.Background(), "context.event-1", ActionRecord{})
+	require.ErrorContains(t, err, "could not parse action records")
+}
+
+func Test_ConfigMapActionRecordStore(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	store := NewConfigMapActionRecordStore(clientset, "keptn", "action-records", 0)
+
+	_, err := store.Claim(context.Background(), "context.event-1", ActionRecord{Time: time.Now()})
+	require.NoError(t, err)
+
+	configMap, err := clientset.CoreV1().ConfigMaps("keptn").Get(context.Background(), "action-records", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Contains(t, configMap.Data, "context.event-1")
+
+	_, err = store.Claim(context.Background(), "context/event-1", ActionRecord{Time: time.Now()})
+	require.ErrorContains(t, err, `invalid action record key "context/event-1"`)
+}
+
+func Test_ConfigMapActionRecordStore_SizeLimit(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	store := NewConfigMapActionRecordStore(clientset, "keptn", "action-records", 0)
+	store.maxSize = 300
+
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, store.Put(context.Background(), fmt.Sprintf("context.event-%d", i), ActionRecord{Completed: true, Time: start.Add(time.Duration(i) * time.Minute)}))
+	}
+
+	configMap, err := clientset.CoreV1().ConfigMaps("keptn").Get(context.Background(), "action-records", metav1.GetOptions{})
+	require.NoError(t, err)
+	size := 0
+	for k, v := range configMap.Data {
+		size += len(k) + len(v)
+	}
+	require.LessOrEqual(t, size, 300)
+	require.NotContains(t, configMap.Data, "context.event-0")
+	require.Contains(t, configMap.Data, "context.event-4")
+}
+
+func Test_Receiving_GetActionTriggeredEvent_Redelivered(t *testing.T) {
+	tests := []struct {
+		name        string
+		result      ActionResult
+		err         error
+		wantStatus  keptnv2.StatusType
+		wantResult  keptnv2.ResultType
+		wantMessage string
+	}{
+		{
+			name:        "passed",
+			result:      ActionResult{Message: "restarted"},
+			wantStatus:  keptnv2.StatusSucceeded,
+			wantResult:  keptnv2.ResultPass,
+			wantMessage: "restarted",
+		},
+		{
+			name:        "errored",
+			err:         context.Canceled,
+			wantStatus:  keptnv2.StatusErrored,
+			wantResult:  keptnv2.ResultFailed,
+			wantMessage: "action action-xyz failed: context canceled",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var executions int32
+			actions := NewActionRegistry()
+			actions.Register("action-xyz", actionFunc(func(ctx context.Context, k sdk.IKeptn, req ActionRequest) (ActionResult, error) {
+				atomic.AddInt32(&executions, 1)
+				return tt.result, tt.err
+			}))
+
+			fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+			actionHandler := NewActionTriggeredEventHandler(WithActions(actions), WithActionRecords(NewMemoryActionRecordStore(0)))
+			fakeKeptn.AddTaskHandler("sh.keptn.event.action.triggered", actionHandler, actionHandler.Filter)
+
+			fakeKeptn.NewEvent(newEvent("../test/events/action_triggered.json"))
+			fakeKeptn.NewEvent(newEvent("../test/events/action_triggered.json"))
+
+			require.Equal(t, int32(1), atomic.LoadInt32(&executions))
+			fakeKeptn.AssertNumberOfEventSent(t, 4)
+			for _, i := range []int{1, 3} {
+				fakeKeptn.AssertSentEventType(t, i, keptnv2.GetFinishedEventType("action"))
+				fakeKeptn.AssertSentEventStatus(t, i, tt.wantStatus)
+				fakeKeptn.AssertSentEventResult(t, i, tt.wantResult)
+				require.Equal(t, tt.wantMessage, getActionFinishedEventData(t, fakeKeptn.SentEvents[i]).Message)
+			}
+		})
+	}
+}
+
+func Test_Receiving_GetActionTriggeredEvent_RedeliveredInProgress(t *testing.T) {
+	event := newEvent("../test/events/action_triggered.json")
+	records := NewMemoryActionRecordStore(0)
+	_, err := records.Claim(context.Background(), actionRecordKey(event.Shkeptncontext, event.ID), ActionRecord{Time: time.Now()})
+	require.NoError(t, err)
+
+	actions := NewActionRegistry()
+	actions.Register("action-xyz", actionFunc(func(ctx context.Context, k sdk.IKeptn, req ActionRequest) (ActionResult, error) {
+		t.Fatal("action in progress must not be executed again")
+		return ActionResult{}, nil
+	}))
+
+	fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+	actionHandler := NewActionTriggeredEventHandler(WithActions(actions), WithActionRecords(records))
+	fakeKeptn.AddTaskHandler("sh.keptn.event.action.triggered", actionHandler, actionHandler.Filter)
+
+	fakeKeptn.NewEvent(event)
+
+	// neither a second started event nor a finished event is sent, the first delivery finishes the action
+	fakeKeptn.AssertNumberOfEventSent(t, 0)
+}
+
+func Test_Receiving_GetActionTriggeredEvent_RedeliveredAbandoned(t *testing.T) {
+	event := newEvent("../test/events/action_triggered.json")
+	records := NewMemoryActionRecordStore(0)
+	// the service restarted while executing the action, its claim expired
+	claimed := time.Now().Add(-time.Hour)
+	_, err := records.Claim(context.Background(), actionRecordKey(event.Shkeptncontext, event.ID), ActionRecord{Time: claimed, Expires: claimed.Add(time.Minute)})
+	require.NoError(t, err)
+
+	var executions int32
+	actions := NewActionRegistry()
+	actions.Register("action-xyz", actionFunc(func(ctx context.Context, k sdk.IKeptn, req ActionRequest) (ActionResult, error) {
+		atomic.AddInt32(&executions, 1)
+		return ActionResult{Message: "restarted"}, nil
+	}))
+
+	fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+	actionHandler := NewActionTriggeredEventHandler(WithActions(actions), WithActionRecords(records))
+	fakeKeptn.AddTaskHandler("sh.keptn.event.action.triggered", actionHandler, actionHandler.Filter)
+
+	fakeKeptn.NewEvent(event)
+
+	require.Equal(t, int32(1), atomic.LoadInt32(&executions))
+	fakeKeptn.AssertNumberOfEventSent(t, 2)
+	fakeKeptn.AssertSentEventResult(t, 1, keptnv2.ResultPass)
+}
+
+func Test_Receiving_GetActionTriggeredEvent_SkippedEventNotRecorded(t *testing.T) {
+	event := newEvent("../test/events/action_triggered.json")
+	records := NewMemoryActionRecordStore(0)
+
+	fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+	actionHandler := NewActionTriggeredEventHandler(WithActionRecords(records))
+	fakeKeptn.AddTaskHandler("sh.keptn.event.action.triggered", actionHandler, actionHandler.Filter)
+
+	fakeKeptn.NewEvent(event)
+
+	fakeKeptn.AssertNumberOfEventSent(t, 0)
+	existing, err := records.Claim(context.Background(), actionRecordKey(event.Shkeptncontext, event.ID), ActionRecord{})
+	require.NoError(t, err)
+	require.Nil(t, existing)
+}
@@ -0,0 +1,237 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	api "github.com/keptn/go-utils/pkg/api/utils"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/sdk"
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// targetsFile is the location of the target configuration within the config repo of a service
+const targetsFile = "keptn-service-template-go/targets.yaml"
+
+// TargetConfig represents the content of the targets.yaml file stored in the config repo.
+// It derives the workload remediation actions are applied to from the problem of the action.triggered event, e.g.:
+//
+//	spec_version: '1.0'
+//	targets:
+//	  - actions: [rollout-restart]
+//	    match:
+//	      $.rootCause: '^Pod (?P<workload>[a-z0-9-]+)-[a-z0-9]+-[a-z0-9]+ crashed'
+//	    name: '{{.Matches.workload}}'
+//
+// The first rule whose expressions all match is used, the service of the event is the target if no rule matches
+type TargetConfig struct {
+	SpecVersion string       `yaml:"spec_version"`
+	Targets     []TargetRule `yaml:"targets"`
+}
+
+// TargetRule maps matching problems to a target
+type TargetRule struct {
+	// Actions limits the rule to the given actions, it applies to all actions if empty
+	Actions []string `yaml:"actions,omitempty"`
+	// Match maps JSONPath expressions within the problem of the event to regular expressions their values must match.
+	// Named groups of the regular expressions can be used in the templates as .Matches.<name>
+	Match map[string]string `yaml:"match,omitempty"`
+	// Name and Namespace are Go templates for the name and namespace of the target.
+	// The fields Project, Stage, Service, Labels, Problem and Matches can be used, empty templates keep the defaults of the action
+	Name      string `yaml:"name,omitempty"`
+	Namespace string `yaml:"namespace,omitempty"`
+}
+
+// targetTemplateData is passed to the templates of a TargetRule
+type targetTemplateData struct {
+	Project string
+	Stage   string
+	Service string
+	Labels  map[string]string
+	// Problem is the problem of the event including fields unknown to Keptn, e.g. the impacted entity reported by the monitoring tool
+	Problem map[string]interface{}
+	Matches map[string]string
+}
+
+var targetTemplateFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+}
+
+// ParseTargetConfig parses and validates the content of a targets.yaml file
+func ParseTargetConfig(content []byte) (*TargetConfig, error) {
+	config := &TargetConfig{}
+	if err := yaml.Unmarshal(content, config); err != nil {
+		return nil, fmt.Errorf("could not parse target config: %w", err)
+	}
+
+	if config.SpecVersion == "" {
+		return nil, errors.New("invalid target config: spec_version must be set")
+	}
+	for i, rule := range config.Targets {
+		if rule.Name == "" && rule.Namespace == "" {
+			return nil, fmt.Errorf("invalid target config: rule %d must define a name or namespace", i+1)
+		}
+		for expression, pattern := range rule.Match {
+			if _, err := parseJSONPath(expression); err != nil {
+				return nil, fmt.Errorf("invalid target config: rule %d has an invalid expression %q: %w", i+1, expression, err)
+			}
+			if _, err := regexp.Compile(pattern); err != nil {
+				return nil, fmt.Errorf("invalid target config: rule %d has an invalid pattern for %s: %w", i+1, expression, err)
+			}
+		}
+		for name, text := range map[string]string{"name": rule.Name, "namespace": rule.Namespace} {
+			if _, err := template.New(name).Funcs(targetTemplateFuncs).Parse(text); err != nil {
+				return nil, fmt.Errorf("invalid target config: rule %d has an invalid %s template: %w", i+1, name, err)
+			}
+		}
+	}
+	return config, nil
+}
+
+// target returns the target of the first rule matching the given action and problem, nil if no rule matches
+func (c *TargetConfig) target(action string, eventData keptnv2.EventData, problem map[string]interface{}) (*ActionTarget, error) {
+	for i, rule := range c.Targets {
+		if len(rule.Actions) > 0 && !containsString(rule.Actions, action) {
+			continue
+		}
+		matches, ok := rule.matches(problem)
+		if !ok {
+			continue
+		}
+
+		data := targetTemplateData{
+			Project: eventData.Project,
+			Stage:   eventData.Stage,
+			Service: eventData.Service,
+			Labels:  eventData.Labels,
+			Problem: problem,
+			Matches: matches,
+		}
+		name, err := renderTargetTemplate("name", rule.Name, data)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		if errs := validation.IsDNS1123Subdomain(name); name != "" && len(errs) > 0 {
+			return nil, fmt.Errorf("rule %d: invalid name %q: %s", i+1, name, strings.Join(errs, ", "))
+		}
+		namespace, err := renderTargetTemplate("namespace", rule.Namespace, data)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", i+1, err)
+		}
+		if errs := validation.IsDNS1123Label(namespace); namespace != "" && len(errs) > 0 {
+			return nil, fmt.Errorf("rule %d: invalid namespace %q: %s", i+1, namespace, strings.Join(errs, ", "))
+		}
+		return &ActionTarget{Name: name, Namespace: namespace}, nil
+	}
+	return nil, nil
+}
+
+// matches returns the named groups of the patterns if all expressions of the rule match the problem
+func (r TargetRule) matches(problem map[string]interface{}) (map[string]string, bool) {
+	expressions := make([]string, 0, len(r.Match))
+	for expression := range r.Match {
+		expressions = append(expressions, expression)
+	}
+	sort.Strings(expressions)
+
+	matches := map[string]string{}
+	for _, expression := range expressions {
+		path, err := parseJSONPath(expression)
+		if err != nil {
+			return nil, false
+		}
+		value, err := path.extract(problem)
+		if err != nil || value == nil {
+			return nil, false
+		}
+		pattern, err := regexp.Compile(r.Match[expression])
+		if err != nil {
+			return nil, false
+		}
+		submatches := pattern.FindStringSubmatch(targetValueString(value))
+		if submatches == nil {
+			return nil, false
+		}
+		for i, name := range pattern.SubexpNames() {
+			if name != "" {
+				matches[name] = submatches[i]
+			}
+		}
+	}
+	return matches, true
+}
+
+// targetValueString converts a value of the problem to the string matched by a pattern, objects and arrays are JSON encoded
+func targetValueString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(encoded)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func renderTargetTemplate(name string, text string, data targetTemplateData) (string, error) {
+	if text == "" {
+		return "", nil
+	}
+	tmpl, err := template.New(name).Funcs(targetTemplateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("could not parse %s template: %w", name, err)
+	}
+	buf := bytes.Buffer{}
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("could not render %s template: %w", name, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// resolveActionTarget determines the target of the request using the targets.yaml of the service.
+// The request is returned unchanged if there is no targets.yaml or no rule matches
+func resolveActionTarget(k sdk.IKeptn, req ActionRequest, eventData interface{}) (ActionRequest, error) {
+	resourceScope := *api.NewResourceScope().Project(req.Event.Project).Stage(req.Event.Stage).Service(req.Event.Service).Resource(targetsFile)
+	resource, err := k.GetResourceHandler().GetResource(resourceScope)
+	if errors.Is(err, api.ResourceNotFoundError) {
+		return req, nil
+	}
+	if err != nil {
+		return req, fmt.Errorf("error while fetching target file: %w", err)
+	}
+	if resource == nil {
+		return req, nil
+	}
+
+	config, err := ParseTargetConfig([]byte(resource.ResourceContent))
+	if err != nil {
+		return req, err
+	}
+
+	// the problem is decoded again, as keptnv2.ProblemDetails drops fields unknown to Keptn
+	raw := struct {
+		Problem map[string]interface{} `json:"problem"`
+	}{}
+	if err := keptnv2.Decode(eventData, &raw); err != nil {
+		return req, fmt.Errorf("could not decode problem: %w", err)
+	}
+
+	target, err := config.target(req.Name(), req.Event.EventData, raw.Problem)
+	if err != nil {
+		return req, err
+	}
+	if target != nil {
+		req.Target = *target
+	}
+	return req, nil
+}
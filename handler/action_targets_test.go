@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/sdk"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+const testTargetConfig = `spec_version: '1.0'
+targets:
+  - actions: [scaling]
+    match:
+      $.problemTitle: '^Response time'
+    name: frontend
+  - match:
+      $.rootCause: '^Pod (?P<workload>[a-z0-9-]+)-[a-z0-9]+-[a-z0-9]+ crashed'
+    name: '{{.Matches.workload}}'
+  - match:
+      $.ImpactedEntity: '.+'
+      $.Tags: 'namespace:(?P<namespace>[a-z0-9-]+)'
+    name: '{{lower .Problem.ImpactedEntity}}'
+    namespace: '{{.Matches.namespace}}'
+`
+
+func Test_TargetConfig_target(t *testing.T) {
+	config, err := ParseTargetConfig([]byte(testTargetConfig))
+	require.NoError(t, err)
+	eventData := keptnv2.EventData{Project: "sockshop", Stage: "production", Service: "carts"}
+
+	tests := []struct {
+		name       string
+		action     string
+		problem    map[string]interface{}
+		wantTarget *ActionTarget
+		wantErr    string
+	}{
+		{
+			name:       "rule limited to action",
+			action:     "scaling",
+			problem:    map[string]interface{}{"problemTitle": "Response time degradation"},
+			wantTarget: &ActionTarget{Name: "frontend"},
+		},
+		{
+			name:    "rule of other action",
+			action:  "rollout-restart",
+			problem: map[string]interface{}{"problemTitle": "Response time degradation"},
+		},
+		{
+			name:       "named group of root cause",
+			action:     "rollout-restart",
+			problem:    map[string]interface{}{"rootCause": "Pod carts-db-7d4f9b6c8-x2x9z crashed"},
+			wantTarget: &ActionTarget{Name: "carts-db"},
+		},
+		{
+			name:   "impacted entity and tags reported by the monitoring tool",
+			action: "rollout-restart",
+			problem: map[string]interface{}{
+				"problemTitle":   "Failure rate increase",
+				"ImpactedEntity": "Carts-Primary",
+				"Tags":           "keptn_service:carts, namespace:shop-prod",
+			},
+			wantTarget: &ActionTarget{Name: "carts-primary", Namespace: "shop-prod"},
+		},
+		{
+			name:    "invalid name rendered",
+			action:  "rollout-restart",
+			problem: map[string]interface{}{"ImpactedEntity": "Carts Service", "Tags": "namespace:shop"},
+			wantErr: `rule 3: invalid name "carts service"`,
+		},
+		{
+			name:    "no problem",
+			action:  "rollout-restart",
+			problem: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := config.target(tt.action, eventData, tt.problem)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantTarget, target)
+		})
+	}
+}
+
+func Test_ParseTargetConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "missing spec_version",
+			content: "targets: []",
+			wantErr: "invalid target config: spec_version must be set",
+		},
+		{
+			name:    "rule without target",
+			content: "spec_version: '1.0'\ntargets:\n  - match:\n      $.rootCause: db\n",
+			wantErr: "invalid target config: rule 1 must define a name or namespace",
+		},
+		{
+			name:    "invalid expression",
+			content: "spec_version: '1.0'\ntargets:\n  - match:\n      rootCause: db\n    name: db\n",
+			wantErr: `invalid target config: rule 1 has an invalid expression "rootCause": expression must start with $`,
+		},
+		{
+			name:    "invalid pattern",
+			content: "spec_version: '1.0'\ntargets:\n  - match:\n      $.rootCause: '(db'\n    name: db\n",
+			wantErr: "invalid target config: rule 1 has an invalid pattern for $.rootCause",
+		},
+		{
+			name:    "invalid template",
+			content: "spec_version: '1.0'\ntargets:\n  - name: '{{.Matches.db'\n",
+			wantErr: "invalid target config: rule 1 has an invalid name template",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseTargetConfig([]byte(tt.content))
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
+
+func Test_Receiving_GetActionTriggeredEvent_ProblemTarget(t *testing.T) {
+	tests := []struct {
+		name        string
+		resources   resourcesHandler
+		wantStatus  keptnv2.StatusType
+		wantMessage string
+	}{
+		{
+			name:        "target of matching rule",
+			resources:   resourcesHandler{targetsFile: "spec_version: '1.0'\ntargets:\n  - match:\n      $.rootCause: '^high load on (?P<db>.+)$'\n    name: '{{.Matches.db}}'\n    namespace: databases\n"},
+			wantStatus:  keptnv2.StatusSucceeded,
+			wantMessage: "applied to carts-db in databases",
+		},
+		{
+			name:        "service without targets.yaml",
+			resources:   resourcesHandler{},
+			wantStatus:  keptnv2.StatusSucceeded,
+			wantMessage: "applied to nginx in user-managed-dev",
+		},
+		{
+			name:        "invalid targets.yaml",
+			resources:   resourcesHandler{targetsFile: "targets: []"},
+			wantStatus:  keptnv2.StatusErrored,
+			wantMessage: "could not determine target of action action-xyz: invalid target config: spec_version must be set",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actions := NewActionRegistry()
+			actions.Register("action-xyz", actionFunc(func(ctx context.Context, k sdk.IKeptn, req ActionRequest) (ActionResult, error) {
+				namespace, err := req.TargetNamespace(defaultNamespaceTemplate())
+				return ActionResult{Message: fmt.Sprintf("applied to %s in %s", req.TargetName(), namespace)}, err
+			}))
+
+			event := newEvent("../test/events/action_triggered.json")
+			eventData := keptnv2.ActionTriggeredEventData{}
+			require.NoError(t, keptnv2.EventDataAs(event, &eventData))
+			eventData.Problem = keptnv2.ProblemDetails{ProblemTitle: "Response time degradation", RootCause: "high load on carts-db"}
+			event.Data = eventData
+
+			fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+			fakeKeptn.SetResourceHandler(tt.resources)
+			fakeKeptn.AddTaskHandler("sh.keptn.event.action.triggered", NewActionTriggeredEventHandler(WithActions(actions), WithProblemTargets()))
+
+			fakeKeptn.NewEvent(event)
+
+			fakeKeptn.AssertNumberOfEventSent(t, 2)
+			fakeKeptn.AssertSentEventStatus(t, 1, tt.wantStatus)
+			require.Equal(t, tt.wantMessage, getActionFinishedEventData(t, fakeKeptn.SentEvents[1]).Message)
+		})
+	}
+}
@@ -1,21 +1,248 @@
 package handler
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
 	"github.com/keptn/go-utils/pkg/sdk"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
+// defaultActionTimeout is the deadline of actions without a configured timeout
+const defaultActionTimeout = 15 * time.Minute
+
+// timeoutParameter is the property of object values overriding the timeout of the action for a single event
+const timeoutParameter = "timeout"
+
+// actionClaimGracePeriod is added to the timeout of an action, which includes its verification, for recording and sending its result.
+// A redelivered event may execute the action again if it is in progress for longer
+const actionClaimGracePeriod = 5 * time.Minute
+
+// dryRunLabel is the label of action.triggered events enabling or disabling the dry-run mode for a single event
+const dryRunLabel = "dryRun"
+
+// actionClaim is the outcome of claiming the record of an action.triggered event
+type actionClaim struct {
+	existing *ActionRecord
+	err      error
+}
+
 type ActionTriggeredEventHandler struct {
+	actions              *ActionRegistry
+	reportUnknownActions bool
+	dryRun               bool
+	verifier             *actionVerifier
+	ctx                  context.Context
+	timeout              time.Duration
+	timeouts             map[string]time.Duration
+	records              ActionRecordStore
+	claims               sync.Map
+	problemTargets       bool
+	now                  func() time.Time
+}
+
+// ActionTriggeredEventHandlerOption can be used to configure the ActionTriggeredEventHandler
+type ActionTriggeredEventHandlerOption func(*ActionTriggeredEventHandler)
+
+// WithActions configures the remediation actions executed for action.triggered events, keyed by action name
+func WithActions(actions *ActionRegistry) ActionTriggeredEventHandlerOption {
+	return func(a *ActionTriggeredEventHandler) {
+		a.actions = actions
+	}
+}
+
+// WithReportUnknownActions configures whether action.triggered events for actions that are not registered
+// are answered with a failed action.finished event instead of being skipped.
+// Only enable this if no other service handles remediation actions for the same projects
+func WithReportUnknownActions(report bool) ActionTriggeredEventHandlerOption {
+	return func(a *ActionTriggeredEventHandler) {
+		a.reportUnknownActions = report
+	}
+}
+
+// WithDryRun configures whether actions are only validated and described in the action.finished event instead of being executed.
+// The label dryRun of an action.triggered event overrides this setting for the event
+func WithDryRun(dryRun bool) ActionTriggeredEventHandlerOption {
+	return func(a *ActionTriggeredEventHandler) {
+		a.dryRun = dryRun
+	}
+}
+
+// WithActionTimeout configures the deadline of actions without a timeout configured by WithActionTimeouts
+func WithActionTimeout(timeout time.Duration) ActionTriggeredEventHandlerOption {
+	return func(a *ActionTriggeredEventHandler) {
+		a.timeout = timeout
+	}
+}
+
+// WithActionTimeouts configures the deadline of actions by their name.
+// The property timeout of an object value, e.g. {"timeout": "10m"}, overrides the configured timeout for a single event
+func WithActionTimeouts(timeouts map[string]time.Duration) ActionTriggeredEventHandlerOption {
+	return func(a *ActionTriggeredEventHandler) {
+		a.timeouts = timeouts
+	}
+}
+
+// WithShutdownContext configures a context that is cancelled when the service shuts down.
+// Actions and verifications in progress are cancelled and reported as errored when it is done
+func WithShutdownContext(ctx context.Context) ActionTriggeredEventHandlerOption {
+	return func(a *ActionTriggeredEventHandler) {
+		a.ctx = ctx
+	}
+}
+
+// WithActionRecords enables deduplicating redelivered action.triggered events using the given store.
+// A redelivered event is answered with the result of the first delivery, or ignored while the action is still in progress
+func WithActionRecords(records ActionRecordStore) ActionTriggeredEventHandlerOption {
+	return func(a *ActionTriggeredEventHandler) {
+		a.records = records
+	}
+}
+
+// WithProblemTargets enables deriving the workload actions are applied to from the problem of the event.
+// The rules are read from keptn-service-template-go/targets.yaml, the service of the event is the target if no rule matches
+func WithProblemTargets() ActionTriggeredEventHandlerOption {
+	return func(a *ActionTriggeredEventHandler) {
+		a.problemTargets = true
+	}
+}
+
+// WithVerification enables verifying the SLIs of the service after an action passed, using the backends of the given handler.
+// The criteria are read from keptn-service-template-go/verification.yaml, actions without criteria are not verified
+func WithVerification(slis *GetSliEventHandler) ActionTriggeredEventHandlerOption {
+	return func(a *ActionTriggeredEventHandler) {
+		a.verifier = &actionVerifier{slis: slis, now: time.Now}
+	}
 }
 
-func NewActionTriggeredEventHandler() *ActionTriggeredEventHandler {
-	return &ActionTriggeredEventHandler{}
+func NewActionTriggeredEventHandler(opts ...ActionTriggeredEventHandlerOption) *ActionTriggeredEventHandler {
+	handler := &ActionTriggeredEventHandler{
+		actions: NewActionRegistry(),
+		ctx:     context.Background(),
+		timeout: defaultActionTimeout,
+		now:     time.Now,
+	}
+	for _, opt := range opts {
+		opt(handler)
+	}
+	return handler
 }
 
-// Execute handles action.triggered events
-// TODO: Add in your handler code
+// Filter accepts action.triggered events for registered actions, and for unknown actions if they are reported.
+// It has to be registered along with the handler, so that skipped events are neither started nor finished by this service
+func (g *ActionTriggeredEventHandler) Filter(k sdk.IKeptn, event sdk.KeptnEvent) bool {
+	actionTriggeredEvent := &keptnv2.ActionTriggeredEventData{}
+	if err := keptnv2.Decode(event.Data, actionTriggeredEvent); err != nil {
+		// let Execute report the malformed event
+		return true
+	}
+
+	req := ActionRequest{Event: *actionTriggeredEvent}
+	if _, ok := g.actions.Get(req.Name()); !ok && !g.reportUnknownActions {
+		k.Logger().Infof("Skipping action.triggered event %s: action %s is not supported, supported actions: %s", event.ID, req.Name(), strings.Join(g.actions.Names(), ", "))
+		return false
+	}
+
+	if g.records == nil {
+		return true
+	}
+
+	// the event is claimed before it is started, so that a redelivery of an action in progress is not started again
+	key := actionRecordKey(event.Shkeptncontext, event.ID)
+	claim := g.claim(event, key)
+	if claim.existing != nil && !claim.existing.Completed {
+		k.Logger().Infof("Ignoring redelivered event %s, its action is in progress since %s", event.ID, claim.existing.Time.Format(time.RFC3339))
+		return false
+	}
+	g.claims.Store(key, claim)
+	return true
+}
+
+// Execute handles action.triggered events accepted by Filter by executing the registered action of the same name.
+// If an ActionRecordStore is configured, each event is executed only once
 func (g *ActionTriggeredEventHandler) Execute(k sdk.IKeptn, event sdk.KeptnEvent) (interface{}, *sdk.Error) {
+	if g.records == nil {
+		return g.handle(k, event)
+	}
+
+	key := actionRecordKey(event.Shkeptncontext, event.ID)
+	var claim actionClaim
+	if claimed, ok := g.claims.LoadAndDelete(key); ok {
+		claim = claimed.(actionClaim)
+	} else {
+		// the event was not claimed by Filter as it is not registered
+		claim = g.claim(event, key)
+	}
+	if claim.err != nil {
+		// executing an action twice is preferred over not executing it at all
+		k.Logger().Errorf("Could not check whether event %s was already handled: %v", event.ID, claim.err)
+		return g.handle(k, event)
+	}
+	if claim.existing != nil {
+		return g.replay(k, event, *claim.existing)
+	}
+
+	result, sdkErr := g.handle(k, event)
+
+	record := ActionRecord{Completed: true, Time: g.now()}
+	if sdkErr != nil {
+		record.Status, record.Result, record.Message = sdkErr.StatusType, sdkErr.ResultType, sdkErr.Message
+	} else {
+		finished := result.(keptnv2.ActionFinishedEventData)
+		record.Status, record.Result, record.Message = finished.Status, finished.Result, finished.Message
+	}
+	if err := g.records.Put(g.ctx, key, record); err != nil {
+		k.Logger().Errorf("Could not record the result of event %s: %v", event.ID, err)
+	}
+	return result, sdkErr
+}
+
+// claim records that the action of the event is in progress and returns the record of an earlier delivery if there is one
+func (g *ActionTriggeredEventHandler) claim(event sdk.KeptnEvent, key string) actionClaim {
+	now := g.now()
+	existing, err := g.records.Claim(g.ctx, key, ActionRecord{Time: now, Expires: now.Add(g.claimTimeout(event) + actionClaimGracePeriod)})
+	return actionClaim{existing: existing, err: err}
+}
+
+// claimTimeout returns the timeout of the action requested by the event, the default timeout if the event is invalid
+func (g *ActionTriggeredEventHandler) claimTimeout(event sdk.KeptnEvent) time.Duration {
+	actionTriggeredEvent := &keptnv2.ActionTriggeredEventData{}
+	if err := keptnv2.Decode(event.Data, actionTriggeredEvent); err != nil {
+		return g.timeout
+	}
+	_, timeout, err := g.actionTimeout(ActionRequest{Event: *actionTriggeredEvent})
+	if err != nil {
+		return g.timeout
+	}
+	return timeout
+}
+
+// replay answers a redelivered action.triggered event with the result of its first delivery
+func (g *ActionTriggeredEventHandler) replay(k sdk.IKeptn, event sdk.KeptnEvent, record ActionRecord) (interface{}, *sdk.Error) {
+	if !record.Completed {
+		// only reached if Filter is not registered, which ignores redeliveries of actions in progress before they are started
+		k.Logger().Infof("Ignoring redelivered event %s, its action is in progress since %s", event.ID, record.Time.Format(time.RFC3339))
+		return nil, nil
+	}
+
+	k.Logger().Infof("Event %s was already handled at %s, sending its result again", event.ID, record.Time.Format(time.RFC3339))
+	if record.Status == keptnv2.StatusErrored {
+		return nil, &sdk.Error{Err: errors.New(record.Message), StatusType: record.Status, ResultType: record.Result, Message: record.Message}
+	}
+
+	actionTriggeredEvent := &keptnv2.ActionTriggeredEventData{}
+	if err := keptnv2.Decode(event.Data, actionTriggeredEvent); err != nil {
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: "failed to decode action.triggered event: " + err.Error()}
+	}
+	return getActionFinishedEvent(record.Result, record.Status, *actionTriggeredEvent, record.Message), nil
+}
+
+// handle executes the action requested by the action.triggered event
+func (g *ActionTriggeredEventHandler) handle(k sdk.IKeptn, event sdk.KeptnEvent) (interface{}, *sdk.Error) {
 	k.Logger().Infof("Handling Action Triggered Event: %s", event.ID)
 	actionTriggeredEvent := &keptnv2.ActionTriggeredEventData{}
 
@@ -23,24 +250,184 @@ func (g *ActionTriggeredEventHandler) Execute(k sdk.IKeptn, event sdk.KeptnEvent
 		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: "failed to decode action.triggered event: " + err.Error()}
 	}
 
-	k.Logger().Infof("Action=%s", actionTriggeredEvent.Action.Action)
+	req := ActionRequest{Event: *actionTriggeredEvent}
+	k.Logger().Infof("Action=%s", req.Name())
 
 	// check if action is supported
-	if actionTriggeredEvent.Action.Action == "action-xyz" {
-		k.Logger().Info("Action remediation triggered")
-		// -----------------------------------------------------
-		// TODO: Implement your remediation action here
-		// -----------------------------------------------------
-		time.Sleep(1 * time.Second) // Example: Wait 5 seconds. Maybe the problem fixes itself.
+	action, ok := g.actions.Get(req.Name())
+	if !ok {
+		// unknown actions only reach the handler if they are reported, or if its Filter is not registered
+		err := fmt.Errorf("action %s is not supported, supported actions: %s", req.Name(), strings.Join(g.actions.Names(), ", "))
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+	}
+
+	req, timeout, err := g.actionTimeout(req)
+	if err != nil {
+		err = fmt.Errorf("invalid action %s: %w", req.Name(), err)
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+	}
+
+	req, err = decodeActionParameters(action, req)
+	if err != nil {
+		err = fmt.Errorf("invalid action %s: %w", req.Name(), err)
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+	}
+
+	if g.problemTargets {
+		if req, err = resolveActionTarget(k, req, event.Data); err != nil {
+			err = fmt.Errorf("could not determine target of action %s: %w", req.Name(), err)
+			return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+		}
+		if req.Target != (ActionTarget{}) {
+			k.Logger().Infof("Action %s targets %s in namespace %q derived from the problem", req.Name(), req.TargetName(), req.Target.Namespace)
+		}
+	}
 
-		// Return finished event
-		finishedEventData := getActionFinishedEvent(keptnv2.ResultPass, keptnv2.StatusSucceeded, *actionTriggeredEvent, "")
+	if err := action.Validate(req); err != nil {
+		err = fmt.Errorf("invalid action %s: %w", req.Name(), err)
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+	}
+
+	dryRun, err := g.isDryRun(req)
+	if err != nil {
+		err = fmt.Errorf("invalid action %s: %w", req.Name(), err)
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+	}
+	if dryRun {
+		k.Logger().Infof("Skipping execution of action %s in dry-run mode: %s", req.Name(), action.Describe(req))
+		message := fmt.Sprintf("dry run: action %s would %s", req.Name(), action.Describe(req))
+		return getActionFinishedEvent(keptnv2.ResultPass, keptnv2.StatusSucceeded, *actionTriggeredEvent, message), nil
+	}
 
-		return finishedEventData, nil
+	k.Logger().Infof("Executing action %s with a timeout of %s: %s", req.Name(), timeout, action.Describe(req))
+	ctx, cancel := context.WithTimeout(g.ctx, timeout)
+	defer cancel()
+	actionResult, err := executeAction(ctx, k, action, req)
+	if err != nil {
+		switch {
+		case g.ctx.Err() != nil:
+			err = fmt.Errorf("action %s was cancelled because the service is shutting down: %w", req.Name(), err)
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			err = fmt.Errorf("action %s did not complete within %s: %w", req.Name(), timeout, err)
+		default:
+			err = fmt.Errorf("action %s failed: %w", req.Name(), err)
+		}
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
 	}
 
-	k.Logger().Infof("Retrieved unknown action %s, skipping...", actionTriggeredEvent.Action.Action)
-	return nil, nil
+	if actionResult.Result == "" {
+		actionResult.Result = keptnv2.ResultPass
+	}
+
+	if g.verifier != nil && actionResult.Result != keptnv2.ResultFailed {
+		// the verification is part of the action, so that it does not outlast its deadline
+		verification, err := g.verifier.verify(ctx, k, req)
+		if err != nil {
+			switch {
+			case g.ctx.Err() != nil:
+				err = fmt.Errorf("verification of action %s was cancelled because the service is shutting down: %w", req.Name(), err)
+			case errors.Is(ctx.Err(), context.DeadlineExceeded):
+				err = fmt.Errorf("verification of action %s did not complete within %s: %w", req.Name(), timeout, err)
+			default:
+				err = fmt.Errorf("could not verify action %s: %w", req.Name(), err)
+			}
+			return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+		}
+		if verification != nil {
+			if verification.Result == keptnv2.ResultFailed {
+				actionResult.Result = keptnv2.ResultFailed
+			}
+			actionResult.Message = joinMessages(actionResult.Message, verification.Message)
+		}
+	}
+
+	// Return finished event
+	finishedEventData := getActionFinishedEvent(actionResult.Result, keptnv2.StatusSucceeded, *actionTriggeredEvent, actionResult.Message)
+
+	return finishedEventData, nil
+}
+
+// executeAction executes the action and returns when it completed or the context is done,
+// so that actions ignoring the context do not block the handler beyond their deadline
+func executeAction(ctx context.Context, k sdk.IKeptn, action Action, req ActionRequest) (ActionResult, error) {
+	type outcome struct {
+		result ActionResult
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, err := action.Execute(ctx, k, req)
+		done <- outcome{result: result, err: err}
+	}()
+
+	select {
+	case o := <-done:
+		return o.result, o.err
+	case <-ctx.Done():
+		return ActionResult{}, ctx.Err()
+	}
+}
+
+// actionTimeout returns the deadline of the requested action and removes a timeout given in its value from the request.
+// A value only containing the timeout is removed entirely, as if the action had no value
+func (g *ActionTriggeredEventHandler) actionTimeout(req ActionRequest) (ActionRequest, time.Duration, error) {
+	timeout := g.timeout
+	if configured, ok := g.timeouts[req.Name()]; ok {
+		timeout = configured
+	}
+
+	value, ok := req.Event.Action.Value.(map[string]interface{})
+	if !ok {
+		return req, timeout, nil
+	}
+	override, ok := value[timeoutParameter]
+	if !ok {
+		return req, timeout, nil
+	}
+	str, ok := override.(string)
+	if !ok {
+		return req, 0, fmt.Errorf("value.%s must be a duration, got %v", timeoutParameter, override)
+	}
+	timeout, err := time.ParseDuration(strings.TrimSpace(str))
+	if err != nil || timeout <= 0 {
+		return req, 0, fmt.Errorf("value.%s must be a positive duration, got %q", timeoutParameter, str)
+	}
+
+	remaining := make(map[string]interface{}, len(value)-1)
+	for name, v := range value {
+		if name != timeoutParameter {
+			remaining[name] = v
+		}
+	}
+	req.Event.Action.Value = remaining
+	if len(remaining) == 0 {
+		req.Event.Action.Value = nil
+	}
+	return req, timeout, nil
+}
+
+// isDryRun returns whether the action must not be executed for the given request
+func (g *ActionTriggeredEventHandler) isDryRun(req ActionRequest) (bool, error) {
+	value, ok := req.Event.Labels[dryRunLabel]
+	if !ok {
+		return g.dryRun, nil
+	}
+	dryRun, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return false, fmt.Errorf("label %s must be true or false, got %q", dryRunLabel, value)
+	}
+	return dryRun, nil
+}
+
+// joinMessages joins the non-empty messages
+func joinMessages(messages ...string) string {
+	var nonEmpty []string
+	for _, message := range messages {
+		if message != "" {
+			nonEmpty = append(nonEmpty, message)
+		}
+	}
+	return strings.Join(nonEmpty, "; ")
 }
 
 func getActionFinishedEvent(result keptnv2.ResultType, status keptnv2.StatusType, actionTriggeredEvent keptnv2.ActionTriggeredEventData, message string) keptnv2.ActionFinishedEventData {
@@ -1,16 +1,21 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	keptnapi "github.com/keptn/go-utils/pkg/api/models"
 	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
 	"github.com/keptn/go-utils/pkg/sdk"
+	"github.com/stretchr/testify/require"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 )
 
 func newEvent(filename string) keptnapi.KeptnContextExtendedCE {
@@ -48,7 +53,9 @@ func Test_Receiving_GetActionTriggeredEvent(t *testing.T) {
 	defer ts.Close()
 
 	fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
-	fakeKeptn.AddTaskHandler("sh.keptn.event.action.triggered", NewActionTriggeredEventHandler())
+	actions := NewActionRegistry()
+	actions.Register("action-xyz", NewExampleAction(10*time.Millisecond))
+	fakeKeptn.AddTaskHandler("sh.keptn.event.action.triggered", NewActionTriggeredEventHandler(WithActions(actions)))
 
 	fakeKeptn.NewEvent(newEvent("../test/events/action_triggered.json"))
 
@@ -60,3 +67,345 @@ func Test_Receiving_GetActionTriggeredEvent(t *testing.T) {
 	fakeKeptn.AssertSentEventStatus(t, 1, keptnv2.StatusSucceeded)
 	fakeKeptn.AssertSentEventResult(t, 1, keptnv2.ResultPass)
 }
+
+// actionFunc allows using a function as Action in tests
+type actionFunc func(ctx context.Context, k sdk.IKeptn, req ActionRequest) (ActionResult, error)
+
+func (f actionFunc) Describe(req ActionRequest) string {
+	return "test action"
+}
+
+func (f actionFunc) Validate(req ActionRequest) error {
+	if req.Event.Action.Value == nil {
+		return errors.New("value must be set")
+	}
+	return nil
+}
+
+func (f actionFunc) Execute(ctx context.Context, k sdk.IKeptn, req ActionRequest) (ActionResult, error) {
+	return f(ctx, k, req)
+}
+
+func Test_Receiving_GetActionTriggeredEvent_DispatchesByActionName(t *testing.T) {
+	tests := []struct {
+		name        string
+		action      string
+		actionFunc  actionFunc
+		wantResult  keptnv2.ResultType
+		wantStatus  keptnv2.StatusType
+		wantMessage string
+	}{
+		{
+			name:   "action passes",
+			action: "action-xyz",
+			actionFunc: func(ctx context.Context, k sdk.IKeptn, req ActionRequest) (ActionResult, error) {
+				return ActionResult{Message: "restarted " + req.Event.Service}, nil
+			},
+			wantResult:  keptnv2.ResultPass,
+			wantStatus:  keptnv2.StatusSucceeded,
+			wantMessage: "restarted nginx",
+		},
+		{
+			name:   "action reports failure",
+			action: "action-xyz",
+			actionFunc: func(ctx context.Context, k sdk.IKeptn, req ActionRequest) (ActionResult, error) {
+				return ActionResult{Result: keptnv2.ResultFailed, Message: "problem still present"}, nil
+			},
+			wantResult:  keptnv2.ResultFailed,
+			wantStatus:  keptnv2.StatusSucceeded,
+			wantMessage: "problem still present",
+		},
+		{
+			name:   "action errors",
+			action: "action-xyz",
+			actionFunc: func(ctx context.Context, k sdk.IKeptn, req ActionRequest) (ActionResult, error) {
+				return ActionResult{}, errors.New("connection refused")
+			},
+			wantResult:  keptnv2.ResultFailed,
+			wantStatus:  keptnv2.StatusErrored,
+			wantMessage: "action action-xyz failed: connection refused",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actions := NewActionRegistry()
+			actions.Register(tt.action, tt.actionFunc)
+
+			fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+			fakeKeptn.AddTaskHandler("sh.keptn.event.action.triggered", NewActionTriggeredEventHandler(WithActions(actions)))
+
+			fakeKeptn.NewEvent(newEvent("../test/events/action_triggered.json"))
+
+			fakeKeptn.AssertNumberOfEventSent(t, 2)
+			fakeKeptn.AssertSentEventType(t, 1, keptnv2.GetFinishedEventType("action"))
+			fakeKeptn.AssertSentEventStatus(t, 1, tt.wantStatus)
+			fakeKeptn.AssertSentEventResult(t, 1, tt.wantResult)
+
+			finishedEventData := keptnv2.ActionFinishedEventData{}
+			require.NoError(t, keptnv2.EventDataAs(fakeKeptn.SentEvents[1], &finishedEventData))
+			require.Equal(t, tt.wantMessage, finishedEventData.Message)
+		})
+	}
+}
+
+func Test_Receiving_GetActionTriggeredEvent_InvalidRequest(t *testing.T) {
+	actions := NewActionRegistry()
+	actions.Register("action-xyz", actionFunc(func(ctx context.Context, k sdk.IKeptn, req ActionRequest) (ActionResult, error) {
+		t.Fatal("invalid action must not be executed")
+		return ActionResult{}, nil
+	}))
+
+	event := newEvent("../test/events/action_triggered.json")
+	eventData := keptnv2.ActionTriggeredEventData{}
+	require.NoError(t, keptnv2.EventDataAs(event, &eventData))
+	eventData.Action.Value = nil
+	event.Data = eventData
+
+	fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+	fakeKeptn.AddTaskHandler("sh.keptn.event.action.triggered", NewActionTriggeredEventHandler(WithActions(actions)))
+
+	fakeKeptn.NewEvent(event)
+
+	fakeKeptn.AssertNumberOfEventSent(t, 2)
+	fakeKeptn.AssertSentEventStatus(t, 1, keptnv2.StatusErrored)
+	fakeKeptn.AssertSentEventResult(t, 1, keptnv2.ResultFailed)
+
+	finishedEventData := keptnv2.ActionFinishedEventData{}
+	require.NoError(t, keptnv2.EventDataAs(fakeKeptn.SentEvents[1], &finishedEventData))
+	require.Equal(t, "invalid action action-xyz: value must be set", finishedEventData.Message)
+}
+
+func Test_Receiving_GetActionTriggeredEvent_DryRun(t *testing.T) {
+	tests := []struct {
+		name         string
+		dryRun       bool
+		label        *string
+		wantExecuted bool
+		wantStatus   keptnv2.StatusType
+		wantMessage  string
+	}{
+		{
+			name:        "enabled globally",
+			dryRun:      true,
+			wantStatus:  keptnv2.StatusSucceeded,
+			wantMessage: "dry run: action action-xyz would wait 1s for service nginx in stage dev",
+		},
+		{
+			name:        "enabled by label",
+			label:       stringPtr("true"),
+			wantStatus:  keptnv2.StatusSucceeded,
+			wantMessage: "dry run: action action-xyz would wait 1s for service nginx in stage dev",
+		},
+		{
+			name:         "disabled by label",
+			dryRun:       true,
+			label:        stringPtr("false"),
+			wantExecuted: true,
+			wantStatus:   keptnv2.StatusSucceeded,
+			wantMessage:  "executed",
+		},
+		{
+			name:        "invalid label",
+			label:       stringPtr("maybe"),
+			wantStatus:  keptnv2.StatusErrored,
+			wantMessage: `invalid action action-xyz: label dryRun must be true or false, got "maybe"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executed := false
+			actions := NewActionRegistry()
+			actions.Register("action-xyz", &dryRunTestAction{
+				Action: NewExampleAction(time.Second),
+				execute: func() (ActionResult, error) {
+					executed = true
+					return ActionResult{Message: "executed"}, nil
+				},
+			})
+
+			event := newEvent("../test/events/action_triggered.json")
+			if tt.label != nil {
+				eventData := keptnv2.ActionTriggeredEventData{}
+				require.NoError(t, keptnv2.EventDataAs(event, &eventData))
+				eventData.Labels[dryRunLabel] = *tt.label
+				event.Data = eventData
+			}
+
+			fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+			fakeKeptn.AddTaskHandler("sh.keptn.event.action.triggered", NewActionTriggeredEventHandler(WithActions(actions), WithDryRun(tt.dryRun)))
+
+			fakeKeptn.NewEvent(event)
+
+			fakeKeptn.AssertNumberOfEventSent(t, 2)
+			fakeKeptn.AssertSentEventStatus(t, 1, tt.wantStatus)
+			require.Equal(t, tt.wantMessage, getActionFinishedEventData(t, fakeKeptn.SentEvents[1]).Message)
+			require.Equal(t, tt.wantExecuted, executed)
+		})
+	}
+}
+
+// dryRunTestAction describes itself like the wrapped Action but records whether it was executed
+type dryRunTestAction struct {
+	Action
+	execute func() (ActionResult, error)
+}
+
+func (a *dryRunTestAction) Execute(ctx context.Context, k sdk.IKeptn, req ActionRequest) (ActionResult, error) {
+	return a.execute()
+}
+
+func stringPtr(value string) *string {
+	return &value
+}
+
+func Test_Receiving_GetActionTriggeredEvent_Timeout(t *testing.T) {
+	blocked := make(chan struct{})
+	defer close(blocked)
+
+	tests := []struct {
+		name        string
+		actionFunc  actionFunc
+		opts        []ActionTriggeredEventHandlerOption
+		value       interface{}
+		wantStatus  keptnv2.StatusType
+		wantMessage string
+	}{
+		{
+			name: "deadline exceeded",
+			actionFunc: func(ctx context.Context, k sdk.IKeptn, req ActionRequest) (ActionResult, error) {
+				<-ctx.Done()
+				return ActionResult{}, ctx.Err()
+			},
+			opts:        []ActionTriggeredEventHandlerOption{WithActionTimeout(10 * time.Millisecond)},
+			value:       "1",
+			wantStatus:  keptnv2.StatusErrored,
+			wantMessage: "action action-xyz did not complete within 10ms: context deadline exceeded",
+		},
+		{
+			name: "context ignored by action",
+			actionFunc: func(ctx context.Context, k sdk.IKeptn, req ActionRequest) (ActionResult, error) {
+				<-blocked
+				return ActionResult{}, nil
+			},
+			opts:        []ActionTriggeredEventHandlerOption{WithActionTimeouts(map[string]time.Duration{"action-xyz": 10 * time.Millisecond})},
+			value:       "1",
+			wantStatus:  keptnv2.StatusErrored,
+			wantMessage: "action action-xyz did not complete within 10ms: context deadline exceeded",
+		},
+		{
+			name: "timeout of value",
+			actionFunc: func(ctx context.Context, k sdk.IKeptn, req ActionRequest) (ActionResult, error) {
+				deadline, _ := ctx.Deadline()
+				return ActionResult{Message: fmt.Sprintf("%v, %v", req.Event.Action.Value, time.Until(deadline) > time.Hour)}, nil
+			},
+			opts:        []ActionTriggeredEventHandlerOption{WithActionTimeout(10 * time.Millisecond)},
+			value:       map[string]interface{}{"timeout": "2h", "replicas": 2.0},
+			wantStatus:  keptnv2.StatusSucceeded,
+			wantMessage: "map[replicas:2], true",
+		},
+		{
+			name:        "invalid timeout of value",
+			value:       map[string]interface{}{"timeout": "soon"},
+			wantStatus:  keptnv2.StatusErrored,
+			wantMessage: `invalid action action-xyz: value.timeout must be a positive duration, got "soon"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actions := NewActionRegistry()
+			actions.Register("action-xyz", tt.actionFunc)
+
+			event := newEvent("../test/events/action_triggered.json")
+			eventData := keptnv2.ActionTriggeredEventData{}
+			require.NoError(t, keptnv2.EventDataAs(event, &eventData))
+			eventData.Action.Value = tt.value
+			event.Data = eventData
+
+			fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+			fakeKeptn.AddTaskHandler("sh.keptn.event.action.triggered", NewActionTriggeredEventHandler(append(tt.opts, WithActions(actions))...))
+
+			fakeKeptn.NewEvent(event)
+
+			fakeKeptn.AssertNumberOfEventSent(t, 2)
+			fakeKeptn.AssertSentEventStatus(t, 1, tt.wantStatus)
+			require.Equal(t, tt.wantMessage, getActionFinishedEventData(t, fakeKeptn.SentEvents[1]).Message)
+		})
+	}
+}
+
+func Test_actionTimeout_OnlyTimeoutInValue(t *testing.T) {
+	req, timeout, err := NewActionTriggeredEventHandler().actionTimeout(newActionRequest(t, map[string]interface{}{"timeout": "2h"}))
+
+	require.NoError(t, err)
+	require.Equal(t, 2*time.Hour, timeout)
+	require.Nil(t, req.Event.Action.Value)
+}
+
+func Test_Receiving_GetActionTriggeredEvent_Shutdown(t *testing.T) {
+	ctx, shutdown := context.WithCancel(context.Background())
+	actions := NewActionRegistry()
+	actions.Register("action-xyz", actionFunc(func(ctx context.Context, k sdk.IKeptn, req ActionRequest) (ActionResult, error) {
+		shutdown()
+		<-ctx.Done()
+		return ActionResult{}, ctx.Err()
+	}))
+
+	fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+	fakeKeptn.AddTaskHandler("sh.keptn.event.action.triggered", NewActionTriggeredEventHandler(WithActions(actions), WithShutdownContext(ctx)))
+
+	fakeKeptn.NewEvent(newEvent("../test/events/action_triggered.json"))
+
+	fakeKeptn.AssertNumberOfEventSent(t, 2)
+	fakeKeptn.AssertSentEventStatus(t, 1, keptnv2.StatusErrored)
+	fakeKeptn.AssertSentEventResult(t, 1, keptnv2.ResultFailed)
+	require.Equal(t, "action action-xyz was cancelled because the service is shutting down: context canceled",
+		getActionFinishedEventData(t, fakeKeptn.SentEvents[1]).Message)
+}
+
+func Test_Receiving_GetActionTriggeredEvent_UnknownAction(t *testing.T) {
+	actions := NewActionRegistry()
+	actions.Register("scale", NewExampleAction(0))
+	actions.Register("restart", NewExampleAction(0))
+
+	t.Run("skipped by default", func(t *testing.T) {
+		fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+		actionHandler := NewActionTriggeredEventHandler(WithActions(actions))
+		fakeKeptn.AddTaskHandler("sh.keptn.event.action.triggered", actionHandler, actionHandler.Filter)
+
+		fakeKeptn.NewEvent(newEvent("../test/events/action_triggered.json"))
+
+		// neither the started nor the finished event is sent, the action is left to other services
+		fakeKeptn.AssertNumberOfEventSent(t, 0)
+	})
+
+	t.Run("reported", func(t *testing.T) {
+		fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+		actionHandler := NewActionTriggeredEventHandler(WithActions(actions), WithReportUnknownActions(true))
+		fakeKeptn.AddTaskHandler("sh.keptn.event.action.triggered", actionHandler, actionHandler.Filter)
+
+		fakeKeptn.NewEvent(newEvent("../test/events/action_triggered.json"))
+
+		fakeKeptn.AssertNumberOfEventSent(t, 2)
+		fakeKeptn.AssertSentEventType(t, 1, keptnv2.GetFinishedEventType("action"))
+		fakeKeptn.AssertSentEventStatus(t, 1, keptnv2.StatusErrored)
+		fakeKeptn.AssertSentEventResult(t, 1, keptnv2.ResultFailed)
+
+		finishedEventData := keptnv2.ActionFinishedEventData{}
+		require.NoError(t, keptnv2.EventDataAs(fakeKeptn.SentEvents[1], &finishedEventData))
+		require.Equal(t, "action action-xyz is not supported, supported actions: restart, scale", finishedEventData.Message)
+	})
+}
+
+func Test_ActionRegistry(t *testing.T) {
+	actions := NewActionRegistry()
+	require.Empty(t, actions.Names())
+
+	actions.Register("scale", NewExampleAction(0))
+	actions.Register("restart", NewExampleAction(0))
+
+	_, ok := actions.Get("scale")
+	require.True(t, ok)
+	_, ok = actions.Get("rollback")
+	require.False(t, ok)
+	require.Equal(t, []string{"restart", "scale"}, actions.Names())
+}
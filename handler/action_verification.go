@@ -0,0 +1,254 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	api "github.com/keptn/go-utils/pkg/api/utils"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/sdk"
+	"gopkg.in/yaml.v3"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// verificationFile is the location of the verification configuration within the config repo of a service
+const verificationFile = "keptn-service-template-go/verification.yaml"
+
+const defaultVerificationSLIProvider = "keptn-service-template-go"
+const defaultVerificationWait = 2 * time.Minute
+
+// maxVerificationWait limits the wait of verifications, so that a redelivered event does not execute the action again
+// while it is still verified
+const maxVerificationWait = 5 * time.Minute
+
+// VerificationConfig represents the content of the verification.yaml file stored in the config repo.
+// It defines the SLI thresholds that must be met after a remediation action was executed, e.g.:
+//
+//	spec_version: '1.0'
+//	wait: 2m
+//	criteria:
+//	  - indicator: response_time_p95
+//	    threshold: "<=500"
+//	    actions: [scaling]
+type VerificationConfig struct {
+	SpecVersion string `yaml:"spec_version"`
+	// SLIProvider selects the SLI backend the indicators are retrieved from
+	SLIProvider string `yaml:"sliProvider,omitempty"`
+	// Wait is the time between the execution of the action and the verification
+	Wait time.Duration `yaml:"wait,omitempty"`
+	// Window is the length of the time window ending with the verification the indicators are evaluated for, Wait if not set
+	Window   time.Duration           `yaml:"window,omitempty"`
+	Criteria []VerificationCriterion `yaml:"criteria"`
+}
+
+// VerificationCriterion defines the threshold an indicator must meet
+type VerificationCriterion struct {
+	Indicator string `yaml:"indicator"`
+	// Threshold is a comparison like <=500, <0.05, >=0.99 or =0
+	Threshold string `yaml:"threshold"`
+	// Actions limits the criterion to the given actions, it applies to all actions if empty
+	Actions []string `yaml:"actions,omitempty"`
+}
+
+// ParseVerificationConfig parses and validates the content of a verification.yaml file
+func ParseVerificationConfig(content []byte) (*VerificationConfig, error) {
+	config := &VerificationConfig{}
+	if err := yaml.Unmarshal(content, config); err != nil {
+		return nil, fmt.Errorf("could not parse verification config: %w", err)
+	}
+
+	if config.SpecVersion == "" {
+		return nil, errors.New("invalid verification config: spec_version must be set")
+	}
+	if len(config.Criteria) == 0 {
+		return nil, errors.New("invalid verification config: no criteria defined")
+	}
+	for i, criterion := range config.Criteria {
+		if strings.TrimSpace(criterion.Indicator) == "" {
+			return nil, fmt.Errorf("invalid verification config: criterion %d does not define an indicator", i+1)
+		}
+		if _, err := parseSLIThreshold(criterion.Threshold); err != nil {
+			return nil, fmt.Errorf("invalid verification config: criterion for %s %w", criterion.Indicator, err)
+		}
+	}
+
+	if config.SLIProvider == "" {
+		config.SLIProvider = defaultVerificationSLIProvider
+	}
+	if config.Wait <= 0 {
+		config.Wait = defaultVerificationWait
+	}
+	if config.Wait > maxVerificationWait {
+		return nil, fmt.Errorf("invalid verification config: wait %s exceeds the maximum of %s", config.Wait, maxVerificationWait)
+	}
+	if config.Window <= 0 {
+		config.Window = config.Wait
+	}
+	return config, nil
+}
+
+// criteriaFor returns the criteria applying to the given action
+func (c *VerificationConfig) criteriaFor(action string) []VerificationCriterion {
+	var criteria []VerificationCriterion
+	for _, criterion := range c.Criteria {
+		if len(criterion.Actions) == 0 || containsString(criterion.Actions, action) {
+			criteria = append(criteria, criterion)
+		}
+	}
+	return criteria
+}
+
+// sliThreshold is a parsed VerificationCriterion threshold
+type sliThreshold struct {
+	operator string
+	value    float64
+}
+
+// parseSLIThreshold parses thresholds like <=500
+func parseSLIThreshold(text string) (sliThreshold, error) {
+	text = strings.TrimSpace(text)
+	for _, operator := range []string{"<=", ">=", "<", ">", "="} {
+		if strings.HasPrefix(text, operator) {
+			value, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimPrefix(text, operator)), 64)
+			if err != nil {
+				return sliThreshold{}, fmt.Errorf("has an invalid threshold %q: value is not a number", text)
+			}
+			return sliThreshold{operator: operator, value: value}, nil
+		}
+	}
+	return sliThreshold{}, fmt.Errorf("has an invalid threshold %q: must start with <=, >=, <, > or =", text)
+}
+
+// isMet returns true if the value meets the threshold
+func (t sliThreshold) isMet(value float64) bool {
+	switch t.operator {
+	case "<=":
+		return value <= t.value
+	case ">=":
+		return value >= t.value
+	case "<":
+		return value < t.value
+	case ">":
+		return value > t.value
+	default:
+		return value == t.value
+	}
+}
+
+// actionVerifier checks the SLIs of a service after a remediation action was executed
+type actionVerifier struct {
+	slis *GetSliEventHandler
+	now  func() time.Time
+}
+
+// verify waits as configured in the verification.yaml of the service and evaluates its criteria within the deadline of ctx.
+// It returns nil if no criteria apply to the action
+func (v *actionVerifier) verify(ctx context.Context, k sdk.IKeptn, req ActionRequest) (*ActionResult, error) {
+	resourceScope := *api.NewResourceScope().Project(req.Event.Project).Stage(req.Event.Stage).Service(req.Event.Service).Resource(verificationFile)
+	resource, err := k.GetResourceHandler().GetResource(resourceScope)
+	if errors.Is(err, api.ResourceNotFoundError) {
+		resource, err = nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while fetching verification file: %w", err)
+	}
+	if resource == nil {
+		k.Logger().Debugf("Not verifying action %s as there is no %s", req.Name(), verificationFile)
+		return nil, nil
+	}
+
+	config, err := ParseVerificationConfig([]byte(resource.ResourceContent))
+	if err != nil {
+		return nil, err
+	}
+	criteria := config.criteriaFor(req.Name())
+	if len(criteria) == 0 {
+		return nil, nil
+	}
+
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < config.Wait {
+		return nil, fmt.Errorf("waiting %s before the verification exceeds the deadline of the action at %s", config.Wait, deadline.Format(time.RFC3339))
+	}
+
+	k.Logger().Infof("Waiting %s before verifying action %s", config.Wait, req.Name())
+	select {
+	case <-time.After(config.Wait):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	end := v.now().UTC()
+	start := end.Add(-config.Window)
+	indicators := make([]string, 0, len(criteria))
+	for _, criterion := range criteria {
+		if !containsString(indicators, criterion.Indicator) {
+			indicators = append(indicators, criterion.Indicator)
+		}
+	}
+
+	sliResults, err := v.slis.retrieveSLIs(ctx, k, keptnv2.GetSLITriggeredEventData{
+		EventData: keptnv2.EventData{
+			Project: req.Event.Project,
+			Stage:   req.Event.Stage,
+			Service: req.Event.Service,
+			Labels:  req.Event.Labels,
+		},
+		GetSLI: keptnv2.GetSLI{
+			SLIProvider: config.SLIProvider,
+			Start:       start.Format(time.RFC3339),
+			End:         end.Format(time.RFC3339),
+			Indicators:  indicators,
+		},
+	}, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	return evaluateVerificationCriteria(criteria, sliResults), nil
+}
+
+// evaluateVerificationCriteria returns pass if all criteria are met and fail otherwise, listing the observed values
+func evaluateVerificationCriteria(criteria []VerificationCriterion, sliResults []*keptnv2.SLIResult) *ActionResult {
+	values := map[string]*keptnv2.SLIResult{}
+	for _, sliResult := range sliResults {
+		values[sliResult.Metric] = sliResult
+	}
+
+	passed := true
+	observations := make([]string, 0, len(criteria))
+	for _, criterion := range criteria {
+		threshold, _ := parseSLIThreshold(criterion.Threshold)
+		sliResult := values[criterion.Indicator]
+
+		switch {
+		case sliResult == nil || !sliResult.Success:
+			passed = false
+			message := "no value"
+			if sliResult != nil {
+				message = sliResult.Message
+			}
+			observations = append(observations, fmt.Sprintf("%s could not be retrieved (%s)", criterion.Indicator, message))
+		case !threshold.isMet(sliResult.Value):
+			passed = false
+			observations = append(observations, fmt.Sprintf("%s=%v violates %s", criterion.Indicator, sliResult.Value, criterion.Threshold))
+		default:
+			observations = append(observations, fmt.Sprintf("%s=%v meets %s", criterion.Indicator, sliResult.Value, criterion.Threshold))
+		}
+	}
+
+	if !passed {
+		return &ActionResult{Result: keptnv2.ResultFailed, Message: "verification failed: " + strings.Join(observations, ", ")}
+	}
+	return &ActionResult{Result: keptnv2.ResultPass, Message: "verification passed: " + strings.Join(observations, ", ")}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,233 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	keptnapi "github.com/keptn/go-utils/pkg/api/models"
+	api "github.com/keptn/go-utils/pkg/api/utils"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/sdk"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// resourcesHandler serves the given resources by their URI in the config repo.
+// Like the resource service, it returns api.ResourceNotFoundError for missing resources
+type resourcesHandler map[string]string
+
+func (r resourcesHandler) GetResource(scope api.ResourceScope, options ...api.URIOption) (*keptnapi.Resource, error) {
+	resource, err := url.QueryUnescape(strings.TrimPrefix(scope.GetResourcePath(), "/resource/"))
+	if err != nil {
+		return nil, err
+	}
+	content, ok := r[resource]
+	if !ok {
+		return nil, api.ResourceNotFoundError
+	}
+	return &keptnapi.Resource{ResourceContent: content}, nil
+}
+
+const testVerificationConfig = `spec_version: '1.0'
+wait: 10ms
+criteria:
+  - indicator: response_time_p95
+    threshold: "<=0.5"
+  - indicator: some_other_metric
+    threshold: ">=100"
+    actions: [scaling]
+`
+
+func newVerifyingActionHandler(t *testing.T, resources resourcesHandler, backend SLIBackend, result ActionResult) *sdk.FakeKeptn {
+	actions := NewActionRegistry()
+	actions.Register("action-xyz", actionFunc(func(ctx context.Context, k sdk.IKeptn, req ActionRequest) (ActionResult, error) {
+		return result, nil
+	}))
+
+	fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+	fakeKeptn.SetResourceHandler(resources)
+	fakeKeptn.AddTaskHandler("sh.keptn.event.action.triggered", NewActionTriggeredEventHandler(
+		WithActions(actions),
+		WithVerification(NewGetSliEventHandler(withTestSLIBackend(backend)))))
+	return fakeKeptn
+}
+
+func getActionFinishedEventData(t *testing.T, ce keptnapi.KeptnContextExtendedCE) keptnv2.ActionFinishedEventData {
+	eventData := keptnv2.ActionFinishedEventData{}
+	require.NoError(t, keptnv2.EventDataAs(ce, &eventData))
+	return eventData
+}
+
+func Test_Receiving_GetActionTriggeredEvent_Verification(t *testing.T) {
+	tests := []struct {
+		name         string
+		value        float64
+		actionResult ActionResult
+		wantResult   keptnv2.ResultType
+		wantMessage  string
+	}{
+		{
+			name:         "thresholds met",
+			value:        0.3,
+			actionResult: ActionResult{Message: "restarted"},
+			wantResult:   keptnv2.ResultPass,
+			wantMessage:  "restarted; verification passed: response_time_p95=0.3 meets <=0.5",
+		},
+		{
+			name:         "thresholds violated",
+			value:        0.8,
+			actionResult: ActionResult{Message: "restarted"},
+			wantResult:   keptnv2.ResultFailed,
+			wantMessage:  "restarted; verification failed: response_time_p95=0.8 violates <=0.5",
+		},
+		{
+			name:         "warning of action is kept",
+			value:        0.3,
+			actionResult: ActionResult{Result: keptnv2.ResultWarning},
+			wantResult:   keptnv2.ResultWarning,
+			wantMessage:  "verification passed: response_time_p95=0.3 meets <=0.5",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var start, end time.Time
+			backend := sliBackendFunc(func(ctx context.Context, query SLIQuery) (float64, error) {
+				start, end = query.Start, query.End
+				return tt.value, nil
+			})
+			fakeKeptn := newVerifyingActionHandler(t, resourcesHandler{sliFile: testSLIConfig, verificationFile: testVerificationConfig}, backend, tt.actionResult)
+
+			fakeKeptn.NewEvent(newEvent("../test/events/action_triggered.json"))
+
+			fakeKeptn.AssertNumberOfEventSent(t, 2)
+			fakeKeptn.AssertSentEventStatus(t, 1, keptnv2.StatusSucceeded)
+			fakeKeptn.AssertSentEventResult(t, 1, tt.wantResult)
+			require.Equal(t, tt.wantMessage, getActionFinishedEventData(t, fakeKeptn.SentEvents[1]).Message)
+			require.Equal(t, 10*time.Millisecond, end.Sub(start))
+		})
+	}
+}
+
+func Test_Receiving_GetActionTriggeredEvent_VerificationSkipped(t *testing.T) {
+	tests := []struct {
+		name         string
+		resources    resourcesHandler
+		actionResult ActionResult
+		wantResult   keptnv2.ResultType
+	}{
+		{
+			name:         "no verification config",
+			resources:    resourcesHandler{sliFile: testSLIConfig},
+			actionResult: ActionResult{Message: "restarted"},
+			wantResult:   keptnv2.ResultPass,
+		},
+		{
+			name:         "no criteria for the action",
+			resources:    resourcesHandler{sliFile: testSLIConfig, verificationFile: "spec_version: '1.0'\ncriteria:\n  - indicator: response_time_p95\n    threshold: '<1'\n    actions: [scaling]\n"},
+			actionResult: ActionResult{Message: "restarted"},
+			wantResult:   keptnv2.ResultPass,
+		},
+		{
+			name:         "action failed",
+			resources:    resourcesHandler{sliFile: testSLIConfig, verificationFile: testVerificationConfig},
+			actionResult: ActionResult{Result: keptnv2.ResultFailed, Message: "restarted"},
+			wantResult:   keptnv2.ResultFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var queries int32
+			backend := sliBackendFunc(func(ctx context.Context, query SLIQuery) (float64, error) {
+				atomic.AddInt32(&queries, 1)
+				return 0, nil
+			})
+			fakeKeptn := newVerifyingActionHandler(t, tt.resources, backend, tt.actionResult)
+
+			fakeKeptn.NewEvent(newEvent("../test/events/action_triggered.json"))
+
+			fakeKeptn.AssertSentEventResult(t, 1, tt.wantResult)
+			require.Equal(t, "restarted", getActionFinishedEventData(t, fakeKeptn.SentEvents[1]).Message)
+			require.Zero(t, atomic.LoadInt32(&queries))
+		})
+	}
+}
+
+func Test_Receiving_GetActionTriggeredEvent_VerificationErrors(t *testing.T) {
+	fakeKeptn := newVerifyingActionHandler(t, resourcesHandler{verificationFile: testVerificationConfig}, constantSLIBackend(0), ActionResult{})
+
+	fakeKeptn.NewEvent(newEvent("../test/events/action_triggered.json"))
+
+	fakeKeptn.AssertSentEventStatus(t, 1, keptnv2.StatusErrored)
+	fakeKeptn.AssertSentEventResult(t, 1, keptnv2.ResultFailed)
+	require.Equal(t, "could not verify action action-xyz: error while fetching SLI file: Resource not found",
+		getActionFinishedEventData(t, fakeKeptn.SentEvents[1]).Message)
+}
+
+func Test_Receiving_GetActionTriggeredEvent_VerificationExceedsDeadline(t *testing.T) {
+	actions := NewActionRegistry()
+	actions.Register("action-xyz", actionFunc(func(ctx context.Context, k sdk.IKeptn, req ActionRequest) (ActionResult, error) {
+		return ActionResult{}, nil
+	}))
+
+	fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+	fakeKeptn.SetResourceHandler(resourcesHandler{sliFile: testSLIConfig, verificationFile: testVerificationConfig})
+	fakeKeptn.AddTaskHandler("sh.keptn.event.action.triggered", NewActionTriggeredEventHandler(
+		WithActions(actions),
+		WithActionTimeout(5*time.Millisecond),
+		WithVerification(NewGetSliEventHandler(withTestSLIBackend(constantSLIBackend(0))))))
+
+	fakeKeptn.NewEvent(newEvent("../test/events/action_triggered.json"))
+
+	fakeKeptn.AssertSentEventStatus(t, 1, keptnv2.StatusErrored)
+	fakeKeptn.AssertSentEventResult(t, 1, keptnv2.ResultFailed)
+	require.Contains(t, getActionFinishedEventData(t, fakeKeptn.SentEvents[1]).Message,
+		"could not verify action action-xyz: waiting 10ms before the verification exceeds the deadline of the action at")
+}
+
+func Test_evaluateVerificationCriteria(t *testing.T) {
+	criteria := []VerificationCriterion{
+		{Indicator: "response_time_p95", Threshold: "<500"},
+		{Indicator: "error_rate", Threshold: "=0"},
+		{Indicator: "throughput", Threshold: ">10"},
+	}
+
+	result := evaluateVerificationCriteria(criteria, []*keptnv2.SLIResult{
+		{Metric: "response_time_p95", Value: 500, Success: true},
+		failedSLIResult("error_rate", errors.New("connection refused")),
+	})
+
+	require.Equal(t, &ActionResult{
+		Result:  keptnv2.ResultFailed,
+		Message: "verification failed: response_time_p95=500 violates <500, error_rate could not be retrieved (connection refused), throughput could not be retrieved (no value)",
+	}, result)
+}
+
+func Test_ParseVerificationConfig(t *testing.T) {
+	config, err := ParseVerificationConfig([]byte(testVerificationConfig))
+	require.NoError(t, err)
+	require.Equal(t, &VerificationConfig{
+		SpecVersion: "1.0",
+		SLIProvider: "keptn-service-template-go",
+		Wait:        10 * time.Millisecond,
+		Window:      10 * time.Millisecond,
+		Criteria: []VerificationCriterion{
+			{Indicator: "response_time_p95", Threshold: "<=0.5"},
+			{Indicator: "some_other_metric", Threshold: ">=100", Actions: []string{"scaling"}},
+		},
+	}, config)
+
+	_, err = ParseVerificationConfig([]byte("criteria: []"))
+	require.EqualError(t, err, "invalid verification config: spec_version must be set")
+
+	_, err = ParseVerificationConfig([]byte("spec_version: '1.0'\ncriteria:\n  - indicator: error_rate\n    threshold: '0.05'\n"))
+	require.EqualError(t, err, `invalid verification config: criterion for error_rate has an invalid threshold "0.05": must start with <=, >=, <, > or =`)
+
+	_, err = ParseVerificationConfig([]byte("spec_version: '1.0'\ncriteria:\n  - indicator: error_rate\n    threshold: '<five'\n"))
+	require.EqualError(t, err, `invalid verification config: criterion for error_rate has an invalid threshold "<five": value is not a number`)
+
+	_, err = ParseVerificationConfig([]byte("spec_version: '1.0'\nwait: 10m\ncriteria:\n  - indicator: error_rate\n    threshold: '<0.05'\n"))
+	require.EqualError(t, err, "invalid verification config: wait 10m0s exceeds the maximum of 5m0s")
+}
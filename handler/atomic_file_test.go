@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func Test_writeFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "records.json")
+
+	require.NoError(t, writeFileAtomic(path, []byte("first")))
+	require.NoError(t, writeFileAtomic(path, []byte("second")))
+
+	content, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "second", string(content))
+	// the temporary files are removed
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+}
+
+func Test_writeFileAtomic_MissingDirectory(t *testing.T) {
+	err := writeFileAtomic(filepath.Join(t.TempDir(), "missing", "records.json"), []byte("content"))
+
+	require.Error(t, err)
+}
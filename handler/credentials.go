@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Credentials contains the key/value pairs stored in a credentials secret
+type Credentials map[string]string
+
+const (
+	// CredentialsKeyURL overrides the URL of the monitoring tool. Backends sending requests to URLs defined in sli.yaml
+	// only send the credentials to URLs below it
+	CredentialsKeyURL = "url"
+	// CredentialsKeyUser and CredentialsKeyPassword are used for basic authentication
+	CredentialsKeyUser     = "user"
+	CredentialsKeyPassword = "password"
+	// CredentialsKeyToken is sent as bearer token
+	CredentialsKeyToken = "token"
+)
+
+// applyTo authenticates the request with the credentials, unless it already carries an Authorization header
+func (c Credentials) applyTo(req *http.Request) {
+	if req.Header.Get("Authorization") != "" {
+		return
+	}
+	if token := c[CredentialsKeyToken]; token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return
+	}
+	if user := c[CredentialsKeyUser]; user != "" {
+		req.SetBasicAuth(user, c[CredentialsKeyPassword])
+	}
+}
+
+// allowURL returns whether the credentials may be sent to the given URL, i.e. it has the scheme and host of their url
+// and a path below its path. Credentials without a url are not sent to any URL
+func (c Credentials) allowURL(u *url.URL) bool {
+	allowed, err := url.Parse(c[CredentialsKeyURL])
+	if err != nil || allowed.Host == "" {
+		return false
+	}
+	if !strings.EqualFold(u.Scheme, allowed.Scheme) || !strings.EqualFold(u.Host, allowed.Host) {
+		return false
+	}
+	// dot segments are resolved, so that e.g. /api/../admin is not considered to be below /api
+	prefix := path.Clean("/" + allowed.Path)
+	requested := path.Clean("/" + u.Path)
+	return prefix == "/" || requested == prefix || strings.HasPrefix(requested, prefix+"/")
+}
+
+// CredentialsProvider resolves the credentials an SLIBackend uses for a project
+type CredentialsProvider interface {
+	// GetCredentials returns the credentials for the given sliProvider and project or nil if there are none
+	GetCredentials(ctx context.Context, sliProvider string, project string) (Credentials, error)
+	// Invalidate drops cached credentials of the given sliProvider and project, e.g. after they were rejected
+	Invalidate(sliProvider string, project string)
+}
+
+const defaultCredentialsCacheTTL = 5 * time.Minute
+
+type cachedCredentials struct {
+	credentials Credentials
+	expiresAt   time.Time
+}
+
+// SecretCredentialsProvider reads credentials from Kubernetes secrets in the namespace of the service.
+// The secret <sliProvider>-credentials-<project> is used if it exists, <sliProvider>-credentials otherwise.
+// Resolved credentials, including the absence of a secret, are cached for the configured TTL
+type SecretCredentialsProvider struct {
+	clientset kubernetes.Interface
+	namespace string
+	ttl       time.Duration
+	now       func() time.Time
+
+	mutex sync.Mutex
+	cache map[string]cachedCredentials
+}
+
+// NewSecretCredentialsProvider creates a new SecretCredentialsProvider reading secrets from the given namespace.
+// A ttl <= 0 uses the default of 5 minutes
+func NewSecretCredentialsProvider(clientset kubernetes.Interface, namespace string, ttl time.Duration) *SecretCredentialsProvider {
+	if ttl <= 0 {
+		ttl = defaultCredentialsCacheTTL
+	}
+	return &SecretCredentialsProvider{
+		clientset: clientset,
+		namespace: namespace,
+		ttl:       ttl,
+		now:       time.Now,
+		cache:     map[string]cachedCredentials{},
+	}
+}
+
+// GetCredentials returns the credentials for the given sliProvider and project or nil if no secret exists
+func (p *SecretCredentialsProvider) GetCredentials(ctx context.Context, sliProvider string, project string) (Credentials, error) {
+	key := credentialsCacheKey(sliProvider, project)
+
+	p.mutex.Lock()
+	cached, ok := p.cache[key]
+	p.mutex.Unlock()
+	if ok && p.now().Before(cached.expiresAt) {
+		return cached.credentials, nil
+	}
+
+	credentials, err := p.readSecret(ctx, fmt.Sprintf("%s-credentials-%s", sliProvider, project))
+	if err == nil && credentials == nil {
+		credentials, err = p.readSecret(ctx, fmt.Sprintf("%s-credentials", sliProvider))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	p.cache[key] = cachedCredentials{credentials: credentials, expiresAt: p.now().Add(p.ttl)}
+	p.mutex.Unlock()
+
+	return credentials, nil
+}
+
+// Invalidate drops the cached credentials of the given sliProvider and project
+func (p *SecretCredentialsProvider) Invalidate(sliProvider string, project string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	delete(p.cache, credentialsCacheKey(sliProvider, project))
+}
+
+// readSecret returns the content of the given secret or nil if it does not exist
+func (p *SecretCredentialsProvider) readSecret(ctx context.Context, name string) (Credentials, error) {
+	secret, err := p.clientset.CoreV1().Secrets(p.namespace).Get(ctx, name, metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read secret %s: %w", name, err)
+	}
+
+	credentials := Credentials{}
+	for key, value := range secret.Data {
+		credentials[key] = string(value)
+	}
+	for key, value := range secret.StringData {
+		credentials[key] = value
+	}
+	return credentials, nil
+}
+
+func credentialsCacheKey(sliProvider string, project string) string {
+	return sliProvider + "/" + project
+}
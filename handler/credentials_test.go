@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func newCredentialsSecret(name string, data map[string]string) *v1.Secret {
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "keptn"},
+		Data:       map[string][]byte{},
+	}
+	for key, value := range data {
+		secret.Data[key] = []byte(value)
+	}
+	return secret
+}
+
+// countSecretReads returns the number of get requests for secrets the fake clientset received
+func countSecretReads(clientset *fake.Clientset) int {
+	count := 0
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "get" && action.GetResource().Resource == "secrets" {
+			count++
+		}
+	}
+	return count
+}
+
+func Test_SecretCredentialsProvider_GetCredentials(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		newCredentialsSecret("prometheus-credentials-sockshop", map[string]string{"user": "sockshop", "password": "secret"}),
+		newCredentialsSecret("prometheus-credentials", map[string]string{"token": "global-token"}),
+	)
+	provider := NewSecretCredentialsProvider(clientset, "keptn", time.Minute)
+
+	credentials, err := provider.GetCredentials(context.Background(), "prometheus", "sockshop")
+	require.NoError(t, err)
+	require.Equal(t, Credentials{"user": "sockshop", "password": "secret"}, credentials)
+
+	credentials, err = provider.GetCredentials(context.Background(), "prometheus", "podtato-head")
+	require.NoError(t, err)
+	require.Equal(t, Credentials{"token": "global-token"}, credentials)
+
+	credentials, err = provider.GetCredentials(context.Background(), "in-house", "sockshop")
+	require.NoError(t, err)
+	require.Nil(t, credentials)
+}
+
+func Test_SecretCredentialsProvider_Caching(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		newCredentialsSecret("prometheus-credentials-sockshop", map[string]string{"token": "first"}),
+	)
+	provider := NewSecretCredentialsProvider(clientset, "keptn", time.Minute)
+	now := time.Date(2021, 1, 15, 15, 0, 0, 0, time.UTC)
+	provider.now = func() time.Time { return now }
+
+	credentials, err := provider.GetCredentials(context.Background(), "prometheus", "sockshop")
+	require.NoError(t, err)
+	require.Equal(t, Credentials{"token": "first"}, credentials)
+	require.Equal(t, 1, countSecretReads(clientset))
+
+	// rotate the secret, the cached credentials are still returned
+	_, err = clientset.CoreV1().Secrets("keptn").Update(context.Background(), newCredentialsSecret("prometheus-credentials-sockshop", map[string]string{"token": "second"}), metav1.UpdateOptions{})
+	require.NoError(t, err)
+
+	credentials, err = provider.GetCredentials(context.Background(), "prometheus", "sockshop")
+	require.NoError(t, err)
+	require.Equal(t, Credentials{"token": "first"}, credentials)
+	require.Equal(t, 1, countSecretReads(clientset))
+
+	// invalidating the cache reads the secret again
+	provider.Invalidate("prometheus", "sockshop")
+	credentials, err = provider.GetCredentials(context.Background(), "prometheus", "sockshop")
+	require.NoError(t, err)
+	require.Equal(t, Credentials{"token": "second"}, credentials)
+	require.Equal(t, 2, countSecretReads(clientset))
+
+	// expired entries are read again
+	now = now.Add(2 * time.Minute)
+	_, err = provider.GetCredentials(context.Background(), "prometheus", "sockshop")
+	require.NoError(t, err)
+	require.Equal(t, 3, countSecretReads(clientset))
+}
+
+func Test_SecretCredentialsProvider_CachesMissingSecrets(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	provider := NewSecretCredentialsProvider(clientset, "keptn", time.Minute)
+
+	for i := 0; i < 3; i++ {
+		credentials, err := provider.GetCredentials(context.Background(), "prometheus", "sockshop")
+		require.NoError(t, err)
+		require.Nil(t, credentials)
+	}
+
+	// the project and the global secret are looked up once
+	require.Equal(t, 2, countSecretReads(clientset))
+}
+
+func Test_Credentials_applyTo(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodGet, "http://prometheus", nil)
+	Credentials{"token": "abc", "user": "admin"}.applyTo(req)
+	require.Equal(t, "Bearer abc", req.Header.Get("Authorization"))
+
+	req, _ = http.NewRequest(http.MethodGet, "http://prometheus", nil)
+	Credentials{"user": "admin", "password": "secret"}.applyTo(req)
+	user, password, ok := req.BasicAuth()
+	require.True(t, ok)
+	require.Equal(t, "admin", user)
+	require.Equal(t, "secret", password)
+
+	req, _ = http.NewRequest(http.MethodGet, "http://prometheus", nil)
+	req.Header.Set("Authorization", "Api-Token xyz")
+	Credentials{"token": "abc"}.applyTo(req)
+	require.Equal(t, "Api-Token xyz", req.Header.Get("Authorization"))
+
+	req, _ = http.NewRequest(http.MethodGet, "http://prometheus", nil)
+	Credentials(nil).applyTo(req)
+	require.Empty(t, req.Header.Get("Authorization"))
+}
+
+func Test_Credentials_allowURL(t *testing.T) {
+	tests := []struct {
+		credentialsURL string
+		requestURL     string
+		want           bool
+	}{
+		{credentialsURL: "https://tickets.example.com", requestURL: "https://tickets.example.com/api/stats?service=carts", want: true},
+		{credentialsURL: "https://tickets.example.com/api/", requestURL: "https://tickets.example.com/api/stats", want: true},
+		{credentialsURL: "https://tickets.example.com/api", requestURL: "https://tickets.example.com/api", want: true},
+		{credentialsURL: "https://tickets.example.com/api", requestURL: "https://tickets.example.com/apix", want: false},
+		{credentialsURL: "https://tickets.example.com/api", requestURL: "https://tickets.example.com/api/../admin", want: false},
+		{credentialsURL: "https://tickets.example.com/api", requestURL: "https://tickets.example.com/api/%2e%2e/admin", want: false},
+		{credentialsURL: "https://tickets.example.com/api/", requestURL: "https://tickets.example.com/api/./stats/", want: true},
+		{credentialsURL: "https://tickets.example.com/api/v1/..", requestURL: "https://tickets.example.com/api/stats", want: true},
+		{credentialsURL: "https://tickets.example.com/api", requestURL: "https://tickets.example.com", want: false},
+		{credentialsURL: "https://tickets.example.com", requestURL: "http://tickets.example.com/api", want: false},
+		{credentialsURL: "https://tickets.example.com", requestURL: "https://tickets.example.com:8443/api", want: false},
+		{credentialsURL: "https://tickets.example.com", requestURL: "https://attacker.example.com/api", want: false},
+		{credentialsURL: "", requestURL: "https://tickets.example.com/api", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.credentialsURL+" "+tt.requestURL, func(t *testing.T) {
+			requestURL, err := url.Parse(tt.requestURL)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, Credentials{"url": tt.credentialsURL, "token": "abc"}.allowURL(requestURL))
+		})
+	}
+}
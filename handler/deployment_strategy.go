@@ -0,0 +1,366 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"strconv"
+	"time"
+)
+
+// deployment strategies maintaining a primary and a canary track of the workloads of a service
+const blueGreenStrategy = "blue_green_service"
+const canaryStrategy = "canary"
+
+// serviceLabel marks the objects deployed for a service, so that they can be found when the release is promoted
+const serviceLabel = "keptn.sh/service"
+
+// trackLabel distinguishes the primary and canary copies of the workloads and services of a chart
+const trackLabel = "keptn.sh/deployment-track"
+const primaryTrack = "primary"
+const canaryTrack = "canary"
+
+// annotations of the ingress-nginx controller sending a share of the traffic of a host to the canary ingress
+const canaryIngressAnnotation = "nginx.ingress.kubernetes.io/canary"
+const canaryWeightAnnotation = "nginx.ingress.kubernetes.io/canary-weight"
+
+var defaultCanaryWeights = []int{10, 25, 50}
+
+const defaultCanaryStepInterval = 1 * time.Minute
+
+// defaultDeploymentReplicas is the number of replicas Kubernetes defaults to for deployments without replicas
+const defaultDeploymentReplicas = 1
+
+var deploymentResource = schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+var serviceResource = schema.GroupVersionResource{Version: "v1", Resource: "services"}
+var ingressResource = schema.GroupVersionResource{Group: "networking.k8s.io", Version: "v1", Resource: "ingresses"}
+
+// isTrackedStrategy returns whether the deployment strategy maintains a primary and a canary track
+func isTrackedStrategy(strategy string) bool {
+	return strategy == blueGreenStrategy || strategy == canaryStrategy
+}
+
+// trackedObjects splits the objects of a chart into a primary and a canary track, following the conventions of the Keptn helm-service:
+//
+//   - a deployment keeps its name for the canary track, a copy named <name>-primary is the primary track
+//   - a service gets the copies <name>-canary and <name>-primary selecting the pods of either track,
+//     the service itself selects the track receiving the traffic
+//   - an ingress routes to the primary services, a copy named <name>-canary routes the canary weight to the canary services
+//
+// The primary deployments are returned separately, as they are only created for the first deployment and updated when the release is promoted
+func trackedObjects(objects []*unstructured.Unstructured) ([]*unstructured.Unstructured, []*unstructured.Unstructured, error) {
+	services := map[string]bool{}
+	for _, object := range objects {
+		if object.GroupVersionKind().Group == "" && object.GetKind() == "Service" {
+			services[object.GetName()] = true
+		}
+	}
+
+	var tracked []*unstructured.Unstructured
+	var primaries []*unstructured.Unstructured
+	for _, object := range objects {
+		gvk := object.GroupVersionKind()
+		switch {
+		case gvk.Group == "apps" && gvk.Kind == "Deployment":
+			canary := object.DeepCopy()
+			// the canary is scaled down when it is promoted or rolled back, as the chart is merged into the existing deployment
+			// its replicas are set explicitly, so that the next version is not deployed with 0 replicas
+			if _, found, _ := unstructured.NestedFieldNoCopy(canary.Object, "spec", "replicas"); !found {
+				if err := unstructured.SetNestedField(canary.Object, int64(defaultDeploymentReplicas), "spec", "replicas"); err != nil {
+					return nil, nil, fmt.Errorf("invalid %s: %w", describeObject(object), err)
+				}
+			}
+			if err := setPodTrack(canary, canaryTrack); err != nil {
+				return nil, nil, err
+			}
+			primary := object.DeepCopy()
+			primary.SetName(object.GetName() + "-" + primaryTrack)
+			if err := setPodTrack(primary, primaryTrack); err != nil {
+				return nil, nil, err
+			}
+			tracked = append(tracked, canary)
+			primaries = append(primaries, primary)
+		case gvk.Group == "apps" && (gvk.Kind == "StatefulSet" || gvk.Kind == "DaemonSet"):
+			return nil, nil, fmt.Errorf("%s cannot be deployed with a primary and a canary track, only deployments are supported", describeObject(object))
+		case gvk.Group == "" && gvk.Kind == "Service":
+			service := object.DeepCopy()
+			if err := setServiceTrack(service, primaryTrack); err != nil {
+				return nil, nil, err
+			}
+			tracked = append(tracked, service)
+			for _, track := range []string{primaryTrack, canaryTrack} {
+				copied := object.DeepCopy()
+				copied.SetName(object.GetName() + "-" + track)
+				setObjectLabel(copied, trackLabel, track)
+				if err := setServiceTrack(copied, track); err != nil {
+					return nil, nil, err
+				}
+				tracked = append(tracked, copied)
+			}
+		case gvk.Group == "networking.k8s.io" && gvk.Kind == "Ingress":
+			primary := object.DeepCopy()
+			if err := renameIngressBackends(primary, services, primaryTrack); err != nil {
+				return nil, nil, err
+			}
+			canary := object.DeepCopy()
+			canary.SetName(object.GetName() + "-" + canaryTrack)
+			setObjectLabel(canary, trackLabel, canaryTrack)
+			annotations := canary.GetAnnotations()
+			if annotations == nil {
+				annotations = map[string]string{}
+			}
+			annotations[canaryIngressAnnotation] = "true"
+			annotations[canaryWeightAnnotation] = "0"
+			canary.SetAnnotations(annotations)
+			if err := renameIngressBackends(canary, services, canaryTrack); err != nil {
+				return nil, nil, err
+			}
+			tracked = append(tracked, primary, canary)
+		default:
+			tracked = append(tracked, object)
+		}
+	}
+	return tracked, primaries, nil
+}
+
+// setObjectLabel sets a label in the metadata of the object
+func setObjectLabel(object *unstructured.Unstructured, name string, value string) {
+	labels := object.GetLabels()
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[name] = value
+	object.SetLabels(labels)
+}
+
+// setPodTrack adds the track to the selector and pod template of a deployment
+func setPodTrack(deployment *unstructured.Unstructured, track string) error {
+	setObjectLabel(deployment, trackLabel, track)
+	for _, path := range [][]string{{"spec", "selector", "matchLabels"}, {"spec", "template", "metadata", "labels"}} {
+		labels, _, err := unstructured.NestedStringMap(deployment.Object, path...)
+		if err != nil {
+			return fmt.Errorf("invalid %s: %w", describeObject(deployment), err)
+		}
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[trackLabel] = track
+		if err := unstructured.SetNestedStringMap(deployment.Object, labels, path...); err != nil {
+			return fmt.Errorf("invalid %s: %w", describeObject(deployment), err)
+		}
+	}
+	return nil
+}
+
+// setServiceTrack adds the track to the selector of a service
+func setServiceTrack(service *unstructured.Unstructured, track string) error {
+	selector, _, err := unstructured.NestedStringMap(service.Object, "spec", "selector")
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", describeObject(service), err)
+	}
+	if selector == nil {
+		return fmt.Errorf("%s without selector cannot be deployed with a primary and a canary track", describeObject(service))
+	}
+	selector[trackLabel] = track
+	return unstructured.SetNestedStringMap(service.Object, selector, "spec", "selector")
+}
+
+// renameIngressBackends makes the backends of the ingress referring to the given services refer to the copies of the services for the track
+func renameIngressBackends(ingress *unstructured.Unstructured, services map[string]bool, track string) error {
+	rename := func(backend map[string]interface{}) {
+		name, _, _ := unstructured.NestedString(backend, "service", "name")
+		if services[name] {
+			_ = unstructured.SetNestedField(backend, name+"-"+track, "service", "name")
+		}
+	}
+
+	if backend, ok, _ := unstructured.NestedMap(ingress.Object, "spec", "defaultBackend"); ok {
+		rename(backend)
+		if err := unstructured.SetNestedMap(ingress.Object, backend, "spec", "defaultBackend"); err != nil {
+			return fmt.Errorf("invalid %s: %w", describeObject(ingress), err)
+		}
+	}
+	rules, _, err := unstructured.NestedSlice(ingress.Object, "spec", "rules")
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", describeObject(ingress), err)
+	}
+	for _, rule := range rules {
+		rule, ok := rule.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		paths, _, _ := unstructured.NestedSlice(rule, "http", "paths")
+		for _, path := range paths {
+			if path, ok := path.(map[string]interface{}); ok {
+				if backend, ok := path["backend"].(map[string]interface{}); ok {
+					rename(backend)
+				}
+			}
+		}
+		if paths != nil {
+			_ = unstructured.SetNestedSlice(rule, paths, "http", "paths")
+		}
+	}
+	if rules != nil {
+		return unstructured.SetNestedSlice(ingress.Object, rules, "spec", "rules")
+	}
+	return nil
+}
+
+// trackSelector returns the label selector of the objects of the given track of the service, all untracked objects if track is empty
+func trackSelector(service string, track string) string {
+	if track == "" {
+		return fmt.Sprintf("%s=%s,!%s", serviceLabel, service, trackLabel)
+	}
+	return fmt.Sprintf("%s=%s,%s=%s", serviceLabel, service, trackLabel, track)
+}
+
+// routeTraffic sends the given percentage of the traffic of the service to the canary track.
+// The ingresses of the service are weighted using the canary annotations of ingress-nginx,
+// its services select the canary track if it receives all traffic and the primary track otherwise
+func routeTraffic(ctx context.Context, client dynamic.Interface, namespace string, service string, weight int) error {
+	track := primaryTrack
+	if weight >= 100 {
+		track = canaryTrack
+	}
+	services, err := client.Resource(serviceResource).Namespace(namespace).List(ctx, metav1.ListOptions{LabelSelector: trackSelector(service, "")})
+	if err != nil {
+		return fmt.Errorf("could not list services of %s: %w", service, err)
+	}
+	for _, item := range services.Items {
+		patch := fmt.Sprintf(`{"spec":{"selector":{%q:%q}}}`, trackLabel, track)
+		if _, err := client.Resource(serviceResource).Namespace(namespace).Patch(ctx, item.GetName(), types.MergePatchType, []byte(patch), metav1.PatchOptions{}); err != nil {
+			return fmt.Errorf("could not route service %s to the %s track: %w", item.GetName(), track, err)
+		}
+	}
+
+	ingresses, err := client.Resource(ingressResource).Namespace(namespace).List(ctx, metav1.ListOptions{LabelSelector: trackSelector(service, canaryTrack)})
+	if err != nil {
+		return fmt.Errorf("could not list ingresses of %s: %w", service, err)
+	}
+	for _, item := range ingresses.Items {
+		patch := fmt.Sprintf(`{"metadata":{"annotations":{%q:%q}}}`, canaryWeightAnnotation, strconv.Itoa(weight))
+		if _, err := client.Resource(ingressResource).Namespace(namespace).Patch(ctx, item.GetName(), types.MergePatchType, []byte(patch), metav1.PatchOptions{}); err != nil {
+			return fmt.Errorf("could not set canary weight of ingress %s: %w", item.GetName(), err)
+		}
+	}
+	return nil
+}
+
+// promoteCanary updates the primary deployments of the service to the pod template of their canaries,
+// waits for their rollout, routes all traffic to the primary track and scales the canaries down
+func promoteCanary(ctx context.Context, client dynamic.Interface, namespace string, service string, waitForPrimary func(workload *appliedWorkload) error) ([]string, error) {
+	canaries, err := canaryDeployments(ctx, client, namespace, service)
+	if err != nil {
+		return nil, err
+	}
+
+	var promoted []string
+	for _, canary := range canaries {
+		template, _, err := unstructured.NestedMap(canary.Object, "spec", "template")
+		if err != nil {
+			return nil, fmt.Errorf("invalid deployment %s: %w", canary.GetName(), err)
+		}
+		if err := unstructured.SetNestedField(template, primaryTrack, "metadata", "labels", trackLabel); err != nil {
+			return nil, fmt.Errorf("invalid deployment %s: %w", canary.GetName(), err)
+		}
+		spec := map[string]interface{}{"template": template}
+		if replicas, ok, _ := unstructured.NestedInt64(canary.Object, "spec", "replicas"); ok && replicas > 0 {
+			spec["replicas"] = replicas
+		}
+		patch, err := (&unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}).MarshalJSON()
+		if err != nil {
+			return nil, fmt.Errorf("could not encode deployment %s: %w", canary.GetName(), err)
+		}
+
+		name := canary.GetName() + "-" + primaryTrack
+		if _, err := client.Resource(deploymentResource).Namespace(namespace).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			return nil, fmt.Errorf("could not update deployment %s: %w", name, err)
+		}
+		if err := waitForPrimary(&appliedWorkload{client: client, kind: "Deployment", namespace: namespace, name: name, resource: deploymentResource}); err != nil {
+			return nil, err
+		}
+		promoted = append(promoted, name)
+	}
+
+	if err := routeTraffic(ctx, client, namespace, service, 0); err != nil {
+		return nil, err
+	}
+	for _, canary := range canaries {
+		if err := scaleDeployment(ctx, client, namespace, canary.GetName(), 0); err != nil {
+			return nil, err
+		}
+	}
+	return promoted, nil
+}
+
+// rollbackCanary routes all traffic of the service back to its primary track, which still runs the previous version,
+// and scales the canaries down. It returns the names of the primary deployments serving the traffic
+func rollbackCanary(ctx context.Context, client dynamic.Interface, namespace string, service string) ([]string, error) {
+	canaries, err := canaryDeployments(ctx, client, namespace, service)
+	if err != nil {
+		return nil, err
+	}
+
+	var primaries []string
+	for _, canary := range canaries {
+		name := canary.GetName() + "-" + primaryTrack
+		_, err := client.Resource(deploymentResource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("could not get deployment %s to roll back to: %w", name, err)
+		}
+		primaries = append(primaries, name)
+	}
+
+	if err := routeTraffic(ctx, client, namespace, service, 0); err != nil {
+		return nil, err
+	}
+	for _, canary := range canaries {
+		if err := scaleDeployment(ctx, client, namespace, canary.GetName(), 0); err != nil {
+			return nil, err
+		}
+	}
+	return primaries, nil
+}
+
+// canaryDeployments returns the deployments of the canary track of the service
+func canaryDeployments(ctx context.Context, client dynamic.Interface, namespace string, service string) ([]unstructured.Unstructured, error) {
+	canaries, err := client.Resource(deploymentResource).Namespace(namespace).List(ctx, metav1.ListOptions{LabelSelector: trackSelector(service, canaryTrack)})
+	if err != nil {
+		return nil, fmt.Errorf("could not list deployments of %s: %w", service, err)
+	}
+	if len(canaries.Items) == 0 {
+		return nil, fmt.Errorf("no canary deployment of %s found in namespace %s", service, namespace)
+	}
+	return canaries.Items, nil
+}
+
+// scaleDeployment sets the number of replicas of a deployment
+func scaleDeployment(ctx context.Context, client dynamic.Interface, namespace string, name string, replicas int) error {
+	patch := fmt.Sprintf(`{"spec":{"replicas":%d}}`, replicas)
+	if _, err := client.Resource(deploymentResource).Namespace(namespace).Patch(ctx, name, types.MergePatchType, []byte(patch), metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("could not scale deployment %s to %d replicas: %w", name, replicas, err)
+	}
+	return nil
+}
+
+// ValidateCanaryWeights checks that the weights of the canary steps are ascending percentages
+func ValidateCanaryWeights(weights []int) error {
+	if len(weights) == 0 {
+		return errors.New("at least one canary weight is required")
+	}
+	for i, weight := range weights {
+		if weight < 1 || weight > 100 {
+			return fmt.Errorf("canary weight %d must be between 1 and 100", weight)
+		}
+		if i > 0 && weight <= weights[i-1] {
+			return fmt.Errorf("canary weights must be ascending, got %d after %d", weight, weights[i-1])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"github.com/keptn/go-utils/pkg/sdk"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"testing"
+	"time"
+)
+
+func Test_trackedObjects(t *testing.T) {
+	objects, err := renderChart([]byte(packageTestChart(t, "../test/charts/carts")), "carts", "sockshop-dev", nil)
+	require.NoError(t, err)
+
+	tracked, primaries, err := trackedObjects(objects)
+	require.NoError(t, err)
+
+	names := map[string]*unstructured.Unstructured{}
+	for _, object := range tracked {
+		names[describeObject(object)] = object
+	}
+	require.Len(t, names, 6)
+
+	for name, wantTrack := range map[string]string{"service carts": primaryTrack, "service carts-primary": primaryTrack, "service carts-canary": canaryTrack} {
+		selector, _, _ := unstructured.NestedStringMap(names[name].Object, "spec", "selector")
+		require.Equal(t, wantTrack, selector[trackLabel], name)
+	}
+
+	for name, wantBackend := range map[string]string{"ingress carts": "carts-primary", "ingress carts-canary": "carts-canary"} {
+		rules, _, _ := unstructured.NestedSlice(names[name].Object, "spec", "rules")
+		paths, _, _ := unstructured.NestedSlice(rules[0].(map[string]interface{}), "http", "paths")
+		backend, _, _ := unstructured.NestedString(paths[0].(map[string]interface{}), "backend", "service", "name")
+		require.Equal(t, wantBackend, backend, name)
+	}
+	require.Equal(t, "true", names["ingress carts-canary"].GetAnnotations()[canaryIngressAnnotation])
+
+	canarySelector, _, _ := unstructured.NestedStringMap(names["deployment carts"].Object, "spec", "selector", "matchLabels")
+	require.Equal(t, canaryTrack, canarySelector[trackLabel])
+	require.Len(t, primaries, 1)
+	require.Equal(t, "carts-primary", primaries[0].GetName())
+	primaryPodLabels, _, _ := unstructured.NestedStringMap(primaries[0].Object, "spec", "template", "metadata", "labels")
+	require.Equal(t, primaryTrack, primaryPodLabels[trackLabel])
+}
+
+func Test_trackedObjects_DefaultReplicas(t *testing.T) {
+	deployment := &unstructured.Unstructured{}
+	deployment.SetAPIVersion("apps/v1")
+	deployment.SetKind("Deployment")
+	deployment.SetName("carts")
+
+	tracked, _, err := trackedObjects([]*unstructured.Unstructured{deployment})
+	require.NoError(t, err)
+
+	// a canary scaled down by the last promotion is scaled up again by the merge patch
+	replicas, found, _ := unstructured.NestedInt64(tracked[0].Object, "spec", "replicas")
+	require.True(t, found)
+	require.Equal(t, int64(1), replicas)
+}
+
+func Test_trackedObjects_StatefulSet(t *testing.T) {
+	statefulSet := &unstructured.Unstructured{}
+	statefulSet.SetAPIVersion("apps/v1")
+	statefulSet.SetKind("StatefulSet")
+	statefulSet.SetName("carts-db")
+
+	_, _, err := trackedObjects([]*unstructured.Unstructured{statefulSet})
+	require.EqualError(t, err, "statefulset carts-db cannot be deployed with a primary and a canary track, only deployments are supported")
+}
+
+func Test_ValidateCanaryWeights(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights []int
+		wantErr string
+	}{
+		{name: "valid", weights: []int{10, 25, 100}},
+		{name: "empty", weights: nil, wantErr: "at least one canary weight is required"},
+		{name: "out of range", weights: []int{0, 10}, wantErr: "canary weight 0 must be between 1 and 100"},
+		{name: "descending", weights: []int{50, 25}, wantErr: "canary weights must be ascending, got 25 after 50"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateCanaryWeights(tt.weights)
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+// testRolloutStatus reports the given rollout statuses one after another
+type testRolloutStatus struct {
+	statuses []bool
+}
+
+func (s *testRolloutStatus) rolloutStatus(ctx context.Context) (bool, string, error) {
+	if len(s.statuses) == 0 {
+		return false, "", errors.New("no status")
+	}
+	done := s.statuses[0]
+	s.statuses = s.statuses[1:]
+	if !done {
+		return false, "0 of 1 updated replicas are available", nil
+	}
+	return true, "all replicas are updated and available", nil
+}
+
+func (s *testRolloutStatus) String() string {
+	return "deployment carts in namespace sockshop-dev"
+}
+
+func Test_shiftCanaryTraffic_CanaryUnavailable(t *testing.T) {
+	client := newTestDynamicClient()
+	ingress := &unstructured.Unstructured{}
+	ingress.SetAPIVersion("networking.k8s.io/v1")
+	ingress.SetKind("Ingress")
+	ingress.SetName("carts-canary")
+	ingress.SetLabels(map[string]string{serviceLabel: "carts", trackLabel: canaryTrack})
+	require.NoError(t, applyObject(context.Background(), client, defaultRESTMapper(), "sockshop-dev", ingress))
+
+	deploymentHandler := NewDeploymentTriggeredEventHandler(client, WithCanaryWeights([]int{10, 25, 50}, time.Millisecond))
+	failure, err := deploymentHandler.shiftCanaryTraffic(context.Background(), sdk.NewFakeKeptn("test").Keptn, "sockshop-dev", "carts",
+		[]rolloutStatusChecker{&testRolloutStatus{statuses: []bool{true, false}}})
+	require.NoError(t, err)
+	require.Equal(t, "deployment carts in namespace sockshop-dev became unavailable at a canary weight of 25%, all traffic was routed back to the primary: 0 of 1 updated replicas are available", failure)
+
+	ingress, err = client.Resource(ingressResource).Namespace("sockshop-dev").Get(context.Background(), "carts-canary", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "0", ingress.GetAnnotations()[canaryWeightAnnotation])
+}
+
+func Test_shiftCanaryTraffic_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	deploymentHandler := NewDeploymentTriggeredEventHandler(newTestDynamicClient(), WithCanaryWeights([]int{10, 50}, time.Hour))
+	_, err := deploymentHandler.shiftCanaryTraffic(ctx, sdk.NewFakeKeptn("test").Keptn, "sockshop-dev", "carts",
+		[]rolloutStatusChecker{&testRolloutStatus{statuses: []bool{true}}})
+	require.EqualError(t, err, "shifting traffic to the canary was cancelled: context canceled")
+}
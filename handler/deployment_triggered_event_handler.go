@@ -0,0 +1,423 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	api "github.com/keptn/go-utils/pkg/api/utils"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/sdk"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"strings"
+	"time"
+)
+
+// supportedDeploymentStrategies are the deployment strategies applying the chart of the service as it is,
+// blue_green_service and canary maintain a primary and a canary track, see trackedObjects
+var supportedDeploymentStrategies = []string{"", "direct", "user_managed"}
+
+// DeploymentTriggeredEventHandler deploys the Helm chart stored as helm/<service>.tgz in the config repo of a service.
+// The chart is rendered with the values of the configuration change of the event and applied to the namespace of the stage
+type DeploymentTriggeredEventHandler struct {
+	client         dynamic.Interface
+	mapper         meta.RESTMapper
+	namespace      *NamespaceTemplate
+	ctx            context.Context
+	rolloutTimeout time.Duration
+	pollInterval   time.Duration
+	// canaryWeights are the percentages of the traffic routed to the canary step by step for the canary strategy
+	canaryWeights      []int
+	canaryStepInterval time.Duration
+}
+
+// DeploymentTriggeredEventHandlerOption can be used to configure the DeploymentTriggeredEventHandler
+type DeploymentTriggeredEventHandlerOption func(*DeploymentTriggeredEventHandler)
+
+// WithDeploymentNamespaceTemplate configures the namespace the chart is deployed to, the default is {{.Project}}-{{.Stage}}
+func WithDeploymentNamespaceTemplate(namespace *NamespaceTemplate) DeploymentTriggeredEventHandlerOption {
+	return func(d *DeploymentTriggeredEventHandler) {
+		d.namespace = namespace
+	}
+}
+
+// WithDeploymentRESTMapper configures how the kinds of the objects of charts are mapped to their resources.
+// The default only knows the built-in kinds of Kubernetes, charts with custom resources require a mapper using the discovery API of the cluster
+func WithDeploymentRESTMapper(mapper meta.RESTMapper) DeploymentTriggeredEventHandlerOption {
+	return func(d *DeploymentTriggeredEventHandler) {
+		d.mapper = mapper
+	}
+}
+
+// WithDeploymentShutdownContext configures a context that is cancelled when the service shuts down.
+// A deployment in progress is cancelled and reported as errored when it is done
+func WithDeploymentShutdownContext(ctx context.Context) DeploymentTriggeredEventHandlerOption {
+	return func(d *DeploymentTriggeredEventHandler) {
+		d.ctx = ctx
+	}
+}
+
+// WithDeploymentRolloutTimeout configures how long to wait for the rollout of the deployed workloads before the deployment fails
+func WithDeploymentRolloutTimeout(timeout time.Duration) DeploymentTriggeredEventHandlerOption {
+	return func(d *DeploymentTriggeredEventHandler) {
+		if timeout > 0 {
+			d.rolloutTimeout = timeout
+		}
+	}
+}
+
+// WithCanaryWeights configures the percentages of the traffic routed to the canary by the canary strategy, e.g. 10, 25 and 50,
+// and how long each weight is kept before the next one is applied. The last weight is kept until the release.
+// The weights must be valid according to ValidateCanaryWeights
+func WithCanaryWeights(weights []int, stepInterval time.Duration) DeploymentTriggeredEventHandlerOption {
+	return func(d *DeploymentTriggeredEventHandler) {
+		if ValidateCanaryWeights(weights) == nil {
+			d.canaryWeights = weights
+		}
+		if stepInterval > 0 {
+			d.canaryStepInterval = stepInterval
+		}
+	}
+}
+
+// NewDeploymentTriggeredEventHandler creates a new DeploymentTriggeredEventHandler applying charts using the given client
+func NewDeploymentTriggeredEventHandler(client dynamic.Interface, opts ...DeploymentTriggeredEventHandlerOption) *DeploymentTriggeredEventHandler {
+	handler := &DeploymentTriggeredEventHandler{
+		client:             client,
+		mapper:             defaultRESTMapper(),
+		namespace:          defaultNamespaceTemplate(),
+		ctx:                context.Background(),
+		rolloutTimeout:     defaultRolloutTimeout,
+		pollInterval:       defaultRolloutPollInterval,
+		canaryWeights:      defaultCanaryWeights,
+		canaryStepInterval: defaultCanaryStepInterval,
+	}
+	for _, opt := range opts {
+		opt(handler)
+	}
+	return handler
+}
+
+// Execute deploys the chart of the service and waits until its workloads are rolled out
+func (d *DeploymentTriggeredEventHandler) Execute(k sdk.IKeptn, event sdk.KeptnEvent) (interface{}, *sdk.Error) {
+	k.Logger().Infof("Handling deployment.triggered Event: %s", event.ID)
+	deploymentTriggeredEvent := &keptnv2.DeploymentTriggeredEventData{}
+
+	if err := keptnv2.Decode(event.Data, deploymentTriggeredEvent); err != nil {
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: "failed to decode deployment.triggered event: " + err.Error()}
+	}
+
+	strategy := deploymentTriggeredEvent.Deployment.DeploymentStrategy
+	if !containsString(supportedDeploymentStrategies, strategy) && !isTrackedStrategy(strategy) {
+		err := fmt.Errorf("deployment strategy %s is not supported", strategy)
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+	}
+
+	namespace, err := d.namespace.Namespace(deploymentTriggeredEvent.EventData)
+	if err != nil {
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+	}
+
+	objects, err := d.renderServiceChart(k, *deploymentTriggeredEvent, namespace)
+	if err != nil {
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+	}
+	for _, object := range objects {
+		object.SetNamespace(namespace)
+		setObjectLabel(object, serviceLabel, deploymentTriggeredEvent.Service)
+	}
+
+	deployment := keptnv2.DeploymentFinishedData{
+		DeploymentStrategy:   strategy,
+		DeploymentURIsLocal:  deploymentURIsLocal(objects),
+		DeploymentURIsPublic: deploymentURIsPublic(objects),
+		DeploymentNames:      []string{},
+	}
+
+	var primaries []*unstructured.Unstructured
+	if isTrackedStrategy(strategy) {
+		if objects, primaries, err = trackedObjects(objects); err != nil {
+			err = fmt.Errorf("deployment strategy %s is not supported by the chart: %w", strategy, err)
+			return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+		}
+		// tests and evaluations of the new version address the canary track directly
+		deployment.DeploymentURIsLocal = deploymentURIsLocal(trackObjects(objects, canaryTrack))
+	}
+
+	ctx := d.ctx
+	if err := ensureNamespace(ctx, d.client, namespace); err != nil {
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+	}
+	for _, object := range objects {
+		if err := applyObject(ctx, d.client, d.mapper, namespace, object); err != nil {
+			return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+		}
+		k.Logger().Infof("Applied %s in namespace %s", describeObject(object), namespace)
+	}
+	// objects removed from the chart since the previous deployment are deleted
+	deleted, err := pruneObjects(ctx, d.client, d.mapper, namespace, deploymentTriggeredEvent.Service, objects)
+	for _, object := range deleted {
+		k.Logger().Infof("Deleted %s as it is not part of the chart anymore", object)
+	}
+	if err != nil {
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+	}
+
+	workloads := d.workloads(objects)
+	for _, workload := range workloads {
+		deployment.DeploymentNames = append(deployment.DeploymentNames, workload.name)
+	}
+	// the primary track is created from the first version deployed, later versions reach it when the release is promoted
+	for _, primary := range primaries {
+		created, err := createObject(ctx, d.client, namespace, primary)
+		if err != nil {
+			return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+		}
+		if created {
+			k.Logger().Infof("Created %s in namespace %s", describeObject(primary), namespace)
+			workloads = append(workloads, d.workloads([]*unstructured.Unstructured{primary})...)
+		}
+	}
+
+	for _, workload := range workloads {
+		status, err := waitForRollout(ctx, k, workload, d.rolloutTimeout, d.pollInterval)
+		if errors.Is(err, errRolloutFailed) {
+			message := fmt.Sprintf("rollout of %s failed: %s", workload, status)
+			return getDeploymentFinishedEvent(keptnv2.ResultFailed, keptnv2.StatusSucceeded, *deploymentTriggeredEvent, message, deployment), nil
+		}
+		if err != nil && d.ctx.Err() != nil {
+			err = fmt.Errorf("deployment of %s was cancelled because the service is shutting down: %w", deploymentTriggeredEvent.Service, err)
+			return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+		}
+		if err != nil {
+			message := fmt.Sprintf("rollout of %s did not complete within %s: %s", workload, d.rolloutTimeout, status)
+			return getDeploymentFinishedEvent(keptnv2.ResultFailed, keptnv2.StatusSucceeded, *deploymentTriggeredEvent, message, deployment), nil
+		}
+	}
+
+	message := fmt.Sprintf("deployed %s to namespace %s", deploymentTriggeredEvent.Service, namespace)
+	switch strategy {
+	case blueGreenStrategy:
+		if err := routeTraffic(ctx, d.client, namespace, deploymentTriggeredEvent.Service, 100); err != nil {
+			return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+		}
+		message += ", the canary receives all traffic until the release"
+	case canaryStrategy:
+		var canaries []rolloutStatusChecker
+		for _, workload := range d.workloads(objects) {
+			canaries = append(canaries, workload)
+		}
+		failure, err := d.shiftCanaryTraffic(ctx, k, namespace, deploymentTriggeredEvent.Service, canaries)
+		if err != nil {
+			return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+		}
+		if failure != "" {
+			return getDeploymentFinishedEvent(keptnv2.ResultFailed, keptnv2.StatusSucceeded, *deploymentTriggeredEvent, failure, deployment), nil
+		}
+		message += fmt.Sprintf(", the canary receives %d%% of the traffic until the release", d.canaryWeights[len(d.canaryWeights)-1])
+	}
+
+	return getDeploymentFinishedEvent(keptnv2.ResultPass, keptnv2.StatusSucceeded, *deploymentTriggeredEvent, message, deployment), nil
+}
+
+// shiftCanaryTraffic routes the configured canary weights to the canary track one after another.
+// Before each further step the canaries must still be rolled out, otherwise all traffic is routed back to the primary track
+// and a message describing the failure is returned
+func (d *DeploymentTriggeredEventHandler) shiftCanaryTraffic(ctx context.Context, k sdk.IKeptn, namespace string, service string, canaries []rolloutStatusChecker) (string, error) {
+	for i, weight := range d.canaryWeights {
+		if i > 0 {
+			select {
+			case <-time.After(d.canaryStepInterval):
+			case <-ctx.Done():
+				return "", fmt.Errorf("shifting traffic to the canary was cancelled: %w", ctx.Err())
+			}
+			for _, canary := range canaries {
+				done, status, err := canary.rolloutStatus(ctx)
+				if err == nil && done {
+					continue
+				}
+				if err != nil {
+					status = err.Error()
+				}
+				if err := routeTraffic(ctx, d.client, namespace, service, 0); err != nil {
+					return "", err
+				}
+				return fmt.Sprintf("%s became unavailable at a canary weight of %d%%, all traffic was routed back to the primary: %s", canary, d.canaryWeights[i-1], status), nil
+			}
+		}
+		if err := routeTraffic(ctx, d.client, namespace, service, weight); err != nil {
+			return "", err
+		}
+		k.Logger().Infof("Routed %d%% of the traffic of %s to the canary", weight, service)
+	}
+	return "", nil
+}
+
+// renderServiceChart fetches the chart of the service from the config repo and renders it for the given namespace.
+// The release is named like the service
+func (d *DeploymentTriggeredEventHandler) renderServiceChart(k sdk.IKeptn, eventData keptnv2.DeploymentTriggeredEventData, namespace string) ([]*unstructured.Unstructured, error) {
+	chartFile := chartResource(eventData.Service)
+	resourceScope := *api.NewResourceScope().Project(eventData.Project).Stage(eventData.Stage).Service(eventData.Service).Resource(chartFile)
+	resource, err := k.GetResourceHandler().GetResource(resourceScope)
+	if err != nil {
+		return nil, fmt.Errorf("error while fetching chart: %w", err)
+	}
+	if resource == nil {
+		return nil, fmt.Errorf("error while fetching chart: could not find %s", chartFile)
+	}
+
+	return renderChart([]byte(resource.ResourceContent), eventData.Service, namespace, eventData.ConfigurationChange.Values)
+}
+
+// workloads returns the deployments, statefulsets and daemonsets among the objects
+func (d *DeploymentTriggeredEventHandler) workloads(objects []*unstructured.Unstructured) []*appliedWorkload {
+	var workloads []*appliedWorkload
+	for _, object := range objects {
+		if object.GroupVersionKind().Group != appsv1.GroupName {
+			continue
+		}
+		switch object.GetKind() {
+		case "Deployment", "StatefulSet", "DaemonSet":
+			workloads = append(workloads, &appliedWorkload{
+				client:    d.client,
+				kind:      object.GetKind(),
+				namespace: object.GetNamespace(),
+				name:      object.GetName(),
+				resource:  objectResource(object),
+			})
+		}
+	}
+	return workloads
+}
+
+// appliedWorkload reports the rollout status of a workload applied by the DeploymentTriggeredEventHandler
+type appliedWorkload struct {
+	client    dynamic.Interface
+	kind      string
+	namespace string
+	name      string
+	resource  schema.GroupVersionResource
+}
+
+func (w *appliedWorkload) rolloutStatus(ctx context.Context) (bool, string, error) {
+	object, err := w.client.Resource(w.resource).Namespace(w.namespace).Get(ctx, w.name, metav1.GetOptions{})
+	if err != nil {
+		return false, "", err
+	}
+
+	switch w.kind {
+	case "Deployment":
+		deployment := &appsv1.Deployment{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(object.Object, deployment); err != nil {
+			return false, "", err
+		}
+		return deploymentRolloutStatus(deployment)
+	case "StatefulSet":
+		statefulSet := &appsv1.StatefulSet{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(object.Object, statefulSet); err != nil {
+			return false, "", err
+		}
+		return statefulSetRolloutStatus(statefulSet)
+	default:
+		daemonSet := &appsv1.DaemonSet{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(object.Object, daemonSet); err != nil {
+			return false, "", err
+		}
+		return daemonSetRolloutStatus(daemonSet)
+	}
+}
+
+func (w *appliedWorkload) String() string {
+	return fmt.Sprintf("%s %s in namespace %s", strings.ToLower(w.kind), w.name, w.namespace)
+}
+
+// trackObjects returns the objects of the given track
+func trackObjects(objects []*unstructured.Unstructured, track string) []*unstructured.Unstructured {
+	var tracked []*unstructured.Unstructured
+	for _, object := range objects {
+		if object.GetLabels()[trackLabel] == track {
+			tracked = append(tracked, object)
+		}
+	}
+	return tracked
+}
+
+// deploymentURIsLocal returns the cluster-internal URL of each service among the objects, using its first port
+func deploymentURIsLocal(objects []*unstructured.Unstructured) []string {
+	uris := []string{}
+	for _, object := range objects {
+		if object.GroupVersionKind().Group != "" || object.GetKind() != "Service" {
+			continue
+		}
+		ports, _, _ := unstructured.NestedSlice(object.Object, "spec", "ports")
+		if len(ports) == 0 {
+			continue
+		}
+		port, ok := ports[0].(map[string]interface{})["port"]
+		if !ok {
+			continue
+		}
+		uris = append(uris, fmt.Sprintf("http://%s.%s:%v", object.GetName(), object.GetNamespace(), port))
+	}
+	return uris
+}
+
+// deploymentURIsPublic returns the URL of each host of the ingresses among the objects, https is used for hosts with TLS
+func deploymentURIsPublic(objects []*unstructured.Unstructured) []string {
+	var uris []string
+	for _, object := range objects {
+		if object.GetKind() != "Ingress" {
+			continue
+		}
+		tlsHosts := map[string]bool{}
+		tls, _, _ := unstructured.NestedSlice(object.Object, "spec", "tls")
+		for _, entry := range tls {
+			entry, ok := entry.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			hosts, _, _ := unstructured.NestedStringSlice(entry, "hosts")
+			for _, host := range hosts {
+				tlsHosts[host] = true
+			}
+		}
+		rules, _, _ := unstructured.NestedSlice(object.Object, "spec", "rules")
+		for _, rule := range rules {
+			rule, ok := rule.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			host, _, _ := unstructured.NestedString(rule, "host")
+			if host == "" {
+				continue
+			}
+			if tlsHosts[host] {
+				uris = append(uris, "https://"+host)
+			} else {
+				uris = append(uris, "http://"+host)
+			}
+		}
+	}
+	return uris
+}
+
+func getDeploymentFinishedEvent(result keptnv2.ResultType, status keptnv2.StatusType, deploymentTriggeredEvent keptnv2.DeploymentTriggeredEventData, message string, deployment keptnv2.DeploymentFinishedData) keptnv2.DeploymentFinishedEventData {
+
+	return keptnv2.DeploymentFinishedEventData{
+		EventData: keptnv2.EventData{
+			Project: deploymentTriggeredEvent.Project,
+			Stage:   deploymentTriggeredEvent.Stage,
+			Service: deploymentTriggeredEvent.Service,
+			Labels:  deploymentTriggeredEvent.Labels,
+			Status:  status,
+			Result:  result,
+			Message: message,
+		},
+		Deployment: deployment,
+	}
+}
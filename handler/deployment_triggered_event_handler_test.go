@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"context"
+	keptnapi "github.com/keptn/go-utils/pkg/api/models"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/sdk"
+	"github.com/stretchr/testify/require"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"testing"
+	"time"
+)
+
+func getDeploymentFinishedEventData(t *testing.T, ce keptnapi.KeptnContextExtendedCE) keptnv2.DeploymentFinishedEventData {
+	eventData := keptnv2.DeploymentFinishedEventData{}
+	require.NoError(t, keptnv2.EventDataAs(ce, &eventData))
+	return eventData
+}
+
+// newTestDynamicClient creates a fake dynamic client that can list the objects of tracked deployment strategies
+func newTestDynamicClient() *fakedynamic.FakeDynamicClient {
+	return fakedynamic.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		deploymentResource: "DeploymentList",
+		serviceResource:    "ServiceList",
+		ingressResource:    "IngressList",
+	})
+}
+
+// rolledOutOnCreate makes the fake client report created deployments as rolled out
+func rolledOutOnCreate(action k8stesting.Action) (bool, runtime.Object, error) {
+	object := action.(k8stesting.CreateAction).GetObject().(*unstructured.Unstructured)
+	replicas, found, _ := unstructured.NestedInt64(object.Object, "spec", "replicas")
+	if !found {
+		replicas = 1
+	}
+	for _, field := range []string{"replicas", "updatedReplicas", "availableReplicas"} {
+		_ = unstructured.SetNestedField(object.Object, replicas, "status", field)
+	}
+	return false, nil, nil
+}
+
+func Test_Receiving_DeploymentTriggeredEvent(t *testing.T) {
+	chart := packageTestChart(t, "../test/charts/carts")
+
+	tests := []struct {
+		name           string
+		resources      resourcesHandler
+		strategy       string
+		rolledOut      bool
+		wantStatus     keptnv2.StatusType
+		wantResult     keptnv2.ResultType
+		wantMessage    string
+		wantDeployment keptnv2.DeploymentFinishedData
+		// wantTrack and wantWeight are the track selected by the service and the weight of the canary ingress for tracked strategies
+		wantTrack  string
+		wantWeight string
+	}{
+		{
+			name:        "deployed",
+			resources:   resourcesHandler{"helm/carts.tgz": chart},
+			strategy:    "direct",
+			rolledOut:   true,
+			wantStatus:  keptnv2.StatusSucceeded,
+			wantResult:  keptnv2.ResultPass,
+			wantMessage: "deployed carts to namespace sockshop-dev",
+			wantDeployment: keptnv2.DeploymentFinishedData{
+				DeploymentStrategy:   "direct",
+				DeploymentURIsLocal:  []string{"http://carts.sockshop-dev:80"},
+				DeploymentURIsPublic: []string{"https://carts.example.com"},
+				DeploymentNames:      []string{"carts"},
+			},
+		},
+		{
+			name:        "rollout not completed in time",
+			resources:   resourcesHandler{"helm/carts.tgz": chart},
+			strategy:    "direct",
+			wantStatus:  keptnv2.StatusSucceeded,
+			wantResult:  keptnv2.ResultFailed,
+			wantMessage: "rollout of deployment carts in namespace sockshop-dev did not complete within 100ms: 0 of 1 replicas have been updated",
+			wantDeployment: keptnv2.DeploymentFinishedData{
+				DeploymentStrategy:   "direct",
+				DeploymentURIsLocal:  []string{"http://carts.sockshop-dev:80"},
+				DeploymentURIsPublic: []string{"https://carts.example.com"},
+				DeploymentNames:      []string{"carts"},
+			},
+		},
+		{
+			name:        "chart missing",
+			resources:   resourcesHandler{},
+			strategy:    "direct",
+			wantStatus:  keptnv2.StatusErrored,
+			wantResult:  keptnv2.ResultFailed,
+			wantMessage: "error while fetching chart: Resource not found",
+		},
+		{
+			name:        "blue/green",
+			resources:   resourcesHandler{"helm/carts.tgz": chart},
+			strategy:    "blue_green_service",
+			rolledOut:   true,
+			wantStatus:  keptnv2.StatusSucceeded,
+			wantResult:  keptnv2.ResultPass,
+			wantMessage: "deployed carts to namespace sockshop-dev, the canary receives all traffic until the release",
+			wantDeployment: keptnv2.DeploymentFinishedData{
+				DeploymentStrategy:   "blue_green_service",
+				DeploymentURIsLocal:  []string{"http://carts-canary.sockshop-dev:80"},
+				DeploymentURIsPublic: []string{"https://carts.example.com"},
+				DeploymentNames:      []string{"carts"},
+			},
+			wantTrack:  canaryTrack,
+			wantWeight: "100",
+		},
+		{
+			name:        "canary",
+			resources:   resourcesHandler{"helm/carts.tgz": chart},
+			strategy:    "canary",
+			rolledOut:   true,
+			wantStatus:  keptnv2.StatusSucceeded,
+			wantResult:  keptnv2.ResultPass,
+			wantMessage: "deployed carts to namespace sockshop-dev, the canary receives 50% of the traffic until the release",
+			wantDeployment: keptnv2.DeploymentFinishedData{
+				DeploymentStrategy:   "canary",
+				DeploymentURIsLocal:  []string{"http://carts-canary.sockshop-dev:80"},
+				DeploymentURIsPublic: []string{"https://carts.example.com"},
+				DeploymentNames:      []string{"carts"},
+			},
+			wantTrack:  primaryTrack,
+			wantWeight: "50",
+		},
+		{
+			name:        "unsupported strategy",
+			resources:   resourcesHandler{"helm/carts.tgz": chart},
+			strategy:    "rolling",
+			wantStatus:  keptnv2.StatusErrored,
+			wantResult:  keptnv2.ResultFailed,
+			wantMessage: "deployment strategy rolling is not supported",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestDynamicClient()
+			if tt.rolledOut {
+				client.PrependReactor("create", "deployments", rolledOutOnCreate)
+			}
+			deploymentHandler := NewDeploymentTriggeredEventHandler(client,
+				WithDeploymentRolloutTimeout(100*time.Millisecond),
+				WithCanaryWeights([]int{10, 50}, time.Millisecond))
+			deploymentHandler.pollInterval = 10 * time.Millisecond
+
+			event := newEvent("../test/events/deployment_triggered.json")
+			eventData := keptnv2.DeploymentTriggeredEventData{}
+			require.NoError(t, keptnv2.EventDataAs(event, &eventData))
+			eventData.Deployment.DeploymentStrategy = tt.strategy
+			event.Data = eventData
+
+			fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+			fakeKeptn.SetResourceHandler(tt.resources)
+			fakeKeptn.AddTaskHandler("sh.keptn.event.deployment.triggered", deploymentHandler)
+
+			fakeKeptn.NewEvent(event)
+
+			fakeKeptn.AssertNumberOfEventSent(t, 2)
+			fakeKeptn.AssertSentEventType(t, 1, keptnv2.GetFinishedEventType("deployment"))
+			fakeKeptn.AssertSentEventStatus(t, 1, tt.wantStatus)
+			fakeKeptn.AssertSentEventResult(t, 1, tt.wantResult)
+			finishedEventData := getDeploymentFinishedEventData(t, fakeKeptn.SentEvents[1])
+			require.Equal(t, tt.wantMessage, finishedEventData.Message)
+			if tt.wantStatus == keptnv2.StatusSucceeded {
+				require.Equal(t, tt.wantDeployment, finishedEventData.Deployment)
+			}
+			if tt.wantTrack != "" {
+				ctx := context.Background()
+				service, err := client.Resource(serviceResource).Namespace("sockshop-dev").Get(ctx, "carts", metav1.GetOptions{})
+				require.NoError(t, err)
+				selector, _, _ := unstructured.NestedStringMap(service.Object, "spec", "selector")
+				require.Equal(t, tt.wantTrack, selector[trackLabel])
+
+				ingress, err := client.Resource(ingressResource).Namespace("sockshop-dev").Get(ctx, "carts-canary", metav1.GetOptions{})
+				require.NoError(t, err)
+				require.Equal(t, tt.wantWeight, ingress.GetAnnotations()[canaryWeightAnnotation])
+
+				_, err = client.Resource(deploymentResource).Namespace("sockshop-dev").Get(ctx, "carts-primary", metav1.GetOptions{})
+				require.NoError(t, err)
+			}
+		})
+	}
+}
+
+func Test_Receiving_DeploymentTriggeredEvent_ShuttingDown(t *testing.T) {
+	shutdownCtx, shutdown := context.WithCancel(context.Background())
+	shutdown()
+
+	deploymentHandler := NewDeploymentTriggeredEventHandler(newTestDynamicClient(),
+		WithDeploymentShutdownContext(shutdownCtx),
+		WithDeploymentRolloutTimeout(time.Minute))
+
+	fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+	fakeKeptn.SetResourceHandler(resourcesHandler{"helm/carts.tgz": packageTestChart(t, "../test/charts/carts")})
+	fakeKeptn.AddTaskHandler("sh.keptn.event.deployment.triggered", deploymentHandler)
+
+	fakeKeptn.NewEvent(newEvent("../test/events/deployment_triggered.json"))
+
+	fakeKeptn.AssertNumberOfEventSent(t, 2)
+	fakeKeptn.AssertSentEventStatus(t, 1, keptnv2.StatusErrored)
+	fakeKeptn.AssertSentEventResult(t, 1, keptnv2.ResultFailed)
+	require.Contains(t, getDeploymentFinishedEventData(t, fakeKeptn.SentEvents[1]).Message,
+		"deployment of carts was cancelled because the service is shutting down")
+}
+
+func Test_Receiving_DeploymentTriggeredEvent_RemovedFromChart(t *testing.T) {
+	client := newTestDynamicClient()
+	client.PrependReactor("create", "deployments", rolledOutOnCreate)
+	deploymentHandler := NewDeploymentTriggeredEventHandler(client, WithDeploymentRolloutTimeout(100*time.Millisecond))
+	deploymentHandler.pollInterval = 10 * time.Millisecond
+
+	fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+	fakeKeptn.SetResourceHandler(resourcesHandler{"helm/carts.tgz": packageTestChart(t, "../test/charts/carts")})
+	fakeKeptn.AddTaskHandler("sh.keptn.event.deployment.triggered", deploymentHandler)
+
+	fakeKeptn.NewEvent(newEvent("../test/events/deployment_triggered.json"))
+	_, err := client.Resource(ingressResource).Namespace("sockshop-dev").Get(context.Background(), "carts", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	// the second version of the chart has no ingress
+	event := newEvent("../test/events/deployment_triggered.json")
+	eventData := keptnv2.DeploymentTriggeredEventData{}
+	require.NoError(t, keptnv2.EventDataAs(event, &eventData))
+	eventData.ConfigurationChange.Values = map[string]interface{}{"ingress": map[string]interface{}{"host": ""}}
+	event.Data = eventData
+	fakeKeptn.NewEvent(event)
+
+	fakeKeptn.AssertNumberOfEventSent(t, 4)
+	fakeKeptn.AssertSentEventResult(t, 3, keptnv2.ResultPass)
+	_, err = client.Resource(ingressResource).Namespace("sockshop-dev").Get(context.Background(), "carts", metav1.GetOptions{})
+	require.True(t, k8serrors.IsNotFound(err))
+	_, err = client.Resource(serviceResource).Namespace("sockshop-dev").Get(context.Background(), "carts", metav1.GetOptions{})
+	require.NoError(t, err)
+}
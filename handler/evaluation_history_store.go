@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+)
+
+// maxEvaluationHistory is the number of evaluations kept per service, the most number_of_comparison_results of slo.yaml may request
+const maxEvaluationHistory = 50
+
+// EvaluationRecord is stored for each evaluation to compare later evaluations with
+type EvaluationRecord struct {
+	// EventID is the ID of the evaluation.triggered event
+	EventID string `json:"eventId"`
+	// Result is pass, warning or fail
+	Result string  `json:"result"`
+	Score  float64 `json:"score"`
+	// Values are the values of the indicators that could be retrieved
+	Values map[string]float64 `json:"values"`
+	Time   time.Time          `json:"time"`
+}
+
+// EvaluationHistoryStore stores the EvaluationRecords of each service, keyed by its project, stage and service.
+// Only the newest records are kept
+type EvaluationHistoryStore interface {
+	// Previous returns the records for the key, newest first
+	Previous(ctx context.Context, key string) ([]EvaluationRecord, error)
+	// Add stores the record, replacing an existing record of the same event
+	Add(ctx context.Context, key string, record EvaluationRecord) error
+}
+
+// evaluationHistoryKey returns the key of the records of the given service
+func evaluationHistoryKey(project string, stage string, service string) string {
+	return project + "." + stage + "." + service
+}
+
+// evaluationHistory maps keys to records ordered newest first, it is shared by the EvaluationHistoryStore implementations
+type evaluationHistory map[string][]EvaluationRecord
+
+// add prepends the record, drops an existing record of the same event and the records beyond maxEvaluationHistory
+func (h evaluationHistory) add(key string, record EvaluationRecord) {
+	records := []EvaluationRecord{record}
+	for _, existing := range h[key] {
+		if existing.EventID != record.EventID && len(records) < maxEvaluationHistory {
+			records = append(records, existing)
+		}
+	}
+	h[key] = records
+}
+
+// MemoryEvaluationHistoryStore keeps the records in memory, they are lost when the service restarts
+type MemoryEvaluationHistoryStore struct {
+	mutex   sync.Mutex
+	history evaluationHistory
+}
+
+// NewMemoryEvaluationHistoryStore creates an empty MemoryEvaluationHistoryStore
+func NewMemoryEvaluationHistoryStore() *MemoryEvaluationHistoryStore {
+	return &MemoryEvaluationHistoryStore{
+		history: evaluationHistory{},
+	}
+}
+
+// Previous returns the records for the key
+func (s *MemoryEvaluationHistoryStore) Previous(ctx context.Context, key string) ([]EvaluationRecord, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]EvaluationRecord{}, s.history[key]...), nil
+}
+
+// Add stores the record
+func (s *MemoryEvaluationHistoryStore) Add(ctx context.Context, key string, record EvaluationRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.history.add(key, record)
+	return nil
+}
+
+// FileEvaluationHistoryStore keeps the records in a JSON file, e.g. on a persistent volume, so they survive restarts.
+// The file must not be shared by several replicas of the service
+type FileEvaluationHistoryStore struct {
+	mutex sync.Mutex
+	path  string
+}
+
+// NewFileEvaluationHistoryStore creates a FileEvaluationHistoryStore keeping records in the given file
+func NewFileEvaluationHistoryStore(path string) *FileEvaluationHistoryStore {
+	return &FileEvaluationHistoryStore{
+		path: path,
+	}
+}
+
+// Previous returns the records for the key
+func (s *FileEvaluationHistoryStore) Previous(ctx context.Context, key string) ([]EvaluationRecord, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	history, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	return history[key], nil
+}
+
+// Add stores the record
+func (s *FileEvaluationHistoryStore) Add(ctx context.Context, key string, record EvaluationRecord) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	history, err := s.read()
+	if err != nil {
+		return err
+	}
+	history.add(key, record)
+	return s.write(history)
+}
+
+func (s *FileEvaluationHistoryStore) read() (evaluationHistory, error) {
+	history := evaluationHistory{}
+	content, err := ioutil.ReadFile(s.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not read evaluation history: %w", err)
+	}
+	if len(content) > 0 {
+		if err := json.Unmarshal(content, &history); err != nil {
+			return nil, fmt.Errorf("could not parse evaluation history in %s: %w", s.path, err)
+		}
+	}
+	return history, nil
+}
+
+// write replaces the file with the given history
+func (s *FileEvaluationHistoryStore) write(history evaluationHistory) error {
+	content, err := json.Marshal(history)
+	if err != nil {
+		return fmt.Errorf("could not encode evaluation history: %w", err)
+	}
+	if err := writeFileAtomic(s.path, content); err != nil {
+		return fmt.Errorf("could not write evaluation history: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_EvaluationHistoryStores(t *testing.T) {
+	now := time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		store func(t *testing.T) EvaluationHistoryStore
+	}{
+		{
+			name: "memory",
+			store: func(t *testing.T) EvaluationHistoryStore {
+				return NewMemoryEvaluationHistoryStore()
+			},
+		},
+		{
+			name: "file",
+			store: func(t *testing.T) EvaluationHistoryStore {
+				return NewFileEvaluationHistoryStore(filepath.Join(t.TempDir(), "history.json"))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := tt.store(t)
+			key := evaluationHistoryKey("sockshop", "staging", "carts")
+
+			records, err := store.Previous(ctx, key)
+			require.NoError(t, err)
+			require.Empty(t, records)
+
+			for i := 1; i <= maxEvaluationHistory+1; i++ {
+				record := EvaluationRecord{EventID: fmt.Sprintf("event-%d", i), Result: "pass", Score: 100, Values: map[string]float64{"response_time_p95": float64(i)}, Time: now}
+				require.NoError(t, store.Add(ctx, key, record))
+			}
+			// a redelivered event replaces its record
+			require.NoError(t, store.Add(ctx, key, EvaluationRecord{EventID: "event-50", Result: "fail", Time: now}))
+
+			records, err = store.Previous(ctx, key)
+			require.NoError(t, err)
+			require.Len(t, records, maxEvaluationHistory)
+			require.Equal(t, "event-50", records[0].EventID)
+			require.Equal(t, "fail", records[0].Result)
+			require.Equal(t, "event-51", records[1].EventID)
+			require.Equal(t, float64(51), records[1].Values["response_time_p95"])
+			require.Equal(t, "event-2", records[maxEvaluationHistory-1].EventID)
+
+			records, err = store.Previous(ctx, evaluationHistoryKey("sockshop", "production", "carts"))
+			require.NoError(t, err)
+			require.Empty(t, records)
+		})
+	}
+}
+
+func Test_FileEvaluationHistoryStore_InvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.json")
+	require.NoError(t, ioutil.WriteFile(path, []byte("not json"), 0600))
+
+	_, err := NewFileEvaluationHistoryStore(path).Previous(context.Background(), "sockshop.staging.carts")
+	require.ErrorContains(t, err, "could not parse evaluation history in "+path)
+}
@@ -0,0 +1,250 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	api "github.com/keptn/go-utils/pkg/api/utils"
+	keptn "github.com/keptn/go-utils/pkg/lib"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/sdk"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultEvaluationSLIProvider = "keptn-service-template-go"
+
+// EvaluationTriggeredEventHandler evaluates the slo.yaml of a service without the lighthouse-service of Keptn.
+// The SLIs are retrieved by the SLI backends of the GetSliEventHandler, the results are kept in an EvaluationHistoryStore
+// for the relative criteria of later evaluations
+type EvaluationTriggeredEventHandler struct {
+	slis        *GetSliEventHandler
+	history     EvaluationHistoryStore
+	sliProvider string
+	now         func() time.Time
+}
+
+// EvaluationTriggeredEventHandlerOption can be used to configure the EvaluationTriggeredEventHandler
+type EvaluationTriggeredEventHandlerOption func(*EvaluationTriggeredEventHandler)
+
+// WithEvaluationHistory configures where the results of evaluations are kept, the default keeps them in memory
+func WithEvaluationHistory(history EvaluationHistoryStore) EvaluationTriggeredEventHandlerOption {
+	return func(e *EvaluationTriggeredEventHandler) {
+		e.history = history
+	}
+}
+
+// WithEvaluationSLIProvider configures the SLI backend the SLIs are retrieved from, the default is keptn-service-template-go
+func WithEvaluationSLIProvider(sliProvider string) EvaluationTriggeredEventHandlerOption {
+	return func(e *EvaluationTriggeredEventHandler) {
+		if sliProvider != "" {
+			e.sliProvider = sliProvider
+		}
+	}
+}
+
+// NewEvaluationTriggeredEventHandler creates a new EvaluationTriggeredEventHandler retrieving the SLIs using the given handler
+func NewEvaluationTriggeredEventHandler(slis *GetSliEventHandler, opts ...EvaluationTriggeredEventHandlerOption) *EvaluationTriggeredEventHandler {
+	handler := &EvaluationTriggeredEventHandler{
+		slis:        slis,
+		history:     NewMemoryEvaluationHistoryStore(),
+		sliProvider: defaultEvaluationSLIProvider,
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(handler)
+	}
+	return handler
+}
+
+// Execute retrieves the SLIs of the objectives of the service for the time window of the event and scores them.
+// The evaluation passes without scoring if the service has no slo.yaml
+func (e *EvaluationTriggeredEventHandler) Execute(k sdk.IKeptn, event sdk.KeptnEvent) (interface{}, *sdk.Error) {
+	k.Logger().Infof("Handling evaluation.triggered Event: %s", event.ID)
+	evaluationTriggeredEvent := &keptnv2.EvaluationTriggeredEventData{}
+
+	if err := keptnv2.Decode(event.Data, evaluationTriggeredEvent); err != nil {
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: "failed to decode evaluation.triggered event: " + err.Error()}
+	}
+
+	start, end, err := evaluationTimeWindow(*evaluationTriggeredEvent, e.now())
+	if err != nil {
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+	}
+	evaluation := keptnv2.EvaluationDetails{
+		TimeStart:        start.Format(time.RFC3339),
+		TimeEnd:          end.Format(time.RFC3339),
+		IndicatorResults: []*keptnv2.SLIEvaluationResult{},
+	}
+
+	resourceScope := *api.NewResourceScope().Project(evaluationTriggeredEvent.Project).Stage(evaluationTriggeredEvent.Stage).Service(evaluationTriggeredEvent.Service).Resource(sloFile)
+	resource, err := k.GetResourceHandler().GetResource(resourceScope)
+	if errors.Is(err, api.ResourceNotFoundError) {
+		resource, err = nil, nil
+	}
+	if err != nil {
+		err = fmt.Errorf("error while fetching SLO file: %w", err)
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+	}
+	if resource == nil {
+		evaluation.Result = sloStatusPass
+		message := fmt.Sprintf("no evaluation performed as there is no %s", sloFile)
+		return getEvaluationFinishedEvent(keptnv2.ResultPass, keptnv2.StatusSucceeded, *evaluationTriggeredEvent, message, evaluation), nil
+	}
+
+	slo, err := ParseSLO([]byte(resource.ResourceContent))
+	if err != nil {
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+	}
+	evaluation.SLOFileContent = base64.StdEncoding.EncodeToString([]byte(resource.ResourceContent))
+
+	ctx := context.Background()
+	sliResults, err := e.slis.retrieveSLIs(ctx, k, e.getSLITriggeredEventData(*evaluationTriggeredEvent, slo, start, end), start, end)
+	if err != nil {
+		err = fmt.Errorf("could not retrieve SLIs: %w", err)
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+	}
+
+	key := evaluationHistoryKey(evaluationTriggeredEvent.Project, evaluationTriggeredEvent.Stage, evaluationTriggeredEvent.Service)
+	previous, err := e.history.Previous(ctx, key)
+	if err != nil {
+		// relative criteria are met without previous results, so the evaluation can still be scored
+		k.Logger().Errorf("Could not read previous evaluations of %s: %v", evaluationTriggeredEvent.Service, err)
+	}
+	var comparable []EvaluationRecord
+	for _, record := range previous {
+		// a redelivered event is not compared with its own result
+		if record.EventID != event.ID {
+			comparable = append(comparable, record)
+		}
+	}
+	compared, comparedEvents := comparedSLIValues(slo.Comparison, comparable)
+
+	scored := evaluateSLO(slo, sliResults, compared)
+	evaluation.Result = scored.Result
+	evaluation.Score = scored.Score
+	evaluation.IndicatorResults = scored.IndicatorResults
+	if len(comparedEvents) > 0 {
+		evaluation.ComparedEvents = comparedEvents
+	}
+
+	record := EvaluationRecord{EventID: event.ID, Result: evaluation.Result, Score: evaluation.Score, Values: map[string]float64{}, Time: e.now()}
+	for _, sliResult := range sliResults {
+		if sliResult.Success {
+			record.Values[sliResult.Metric] = sliResult.Value
+		}
+	}
+	if err := e.history.Add(ctx, key, record); err != nil {
+		k.Logger().Errorf("Could not record the evaluation of event %s: %v", event.ID, err)
+	}
+
+	result := keptnv2.ResultFailed
+	switch evaluation.Result {
+	case sloStatusPass:
+		result = keptnv2.ResultPass
+	case sloStatusWarning:
+		result = keptnv2.ResultWarning
+	}
+	return getEvaluationFinishedEvent(result, keptnv2.StatusSucceeded, *evaluationTriggeredEvent, describeEvaluation(evaluation), evaluation), nil
+}
+
+// getSLITriggeredEventData builds the get-sli request for the objectives of the SLOs, the filters of the SLOs are passed as custom filters
+func (e *EvaluationTriggeredEventHandler) getSLITriggeredEventData(eventData keptnv2.EvaluationTriggeredEventData, slo *keptn.ServiceLevelObjectives, start time.Time, end time.Time) keptnv2.GetSLITriggeredEventData {
+	var indicators []string
+	for _, objective := range slo.Objectives {
+		if !containsString(indicators, objective.SLI) {
+			indicators = append(indicators, objective.SLI)
+		}
+	}
+
+	filterKeys := make([]string, 0, len(slo.Filter))
+	for filterKey := range slo.Filter {
+		filterKeys = append(filterKeys, filterKey)
+	}
+	sort.Strings(filterKeys)
+	var filters []*keptnv2.SLIFilter
+	for _, filterKey := range filterKeys {
+		filters = append(filters, &keptnv2.SLIFilter{Key: filterKey, Value: slo.Filter[filterKey]})
+	}
+
+	return keptnv2.GetSLITriggeredEventData{
+		EventData: keptnv2.EventData{
+			Project: eventData.Project,
+			Stage:   eventData.Stage,
+			Service: eventData.Service,
+			Labels:  eventData.Labels,
+		},
+		GetSLI: keptnv2.GetSLI{
+			SLIProvider:   e.sliProvider,
+			Start:         start.Format(time.RFC3339),
+			End:           end.Format(time.RFC3339),
+			Indicators:    indicators,
+			CustomFilters: filters,
+		},
+	}
+}
+
+// evaluationTimeWindow returns the time window to evaluate: the start and end of the evaluation, its timeframe
+// ending with its end or now, or the start and end of the tests
+func evaluationTimeWindow(eventData keptnv2.EvaluationTriggeredEventData, now time.Time) (time.Time, time.Time, error) {
+	switch {
+	case eventData.Evaluation.Timeframe != "":
+		timeframe, err := time.ParseDuration(eventData.Evaluation.Timeframe)
+		if err != nil || timeframe <= 0 {
+			return time.Time{}, time.Time{}, fmt.Errorf("could not parse timeframe %q of the evaluation", eventData.Evaluation.Timeframe)
+		}
+		end := now.UTC()
+		if eventData.Evaluation.End != "" {
+			if end, err = time.Parse(time.RFC3339, eventData.Evaluation.End); err != nil {
+				return time.Time{}, time.Time{}, fmt.Errorf("could not parse end of the time window %q: %w", eventData.Evaluation.End, err)
+			}
+		}
+		return end.Add(-timeframe), end, nil
+	case eventData.Evaluation.Start != "" || eventData.Evaluation.End != "":
+		return parseSLITimeWindow(keptnv2.GetSLI{Start: eventData.Evaluation.Start, End: eventData.Evaluation.End})
+	case eventData.Test.Start != "" || eventData.Test.End != "":
+		return parseSLITimeWindow(keptnv2.GetSLI{Start: eventData.Test.Start, End: eventData.Test.End})
+	default:
+		return time.Time{}, time.Time{}, errors.New("the event defines no time window to evaluate, neither by the start and end or timeframe of the evaluation nor by the start and end of the tests")
+	}
+}
+
+// describeEvaluation returns the message of the evaluation.finished event, listing the objectives that did not pass
+func describeEvaluation(evaluation keptnv2.EvaluationDetails) string {
+	message := fmt.Sprintf("evaluation %s with a score of %s", evaluation.Result, strconv.FormatFloat(evaluation.Score, 'f', -1, 64))
+	var observations []string
+	for _, indicatorResult := range evaluation.IndicatorResults {
+		switch {
+		case indicatorResult.Status != sloStatusWarning && indicatorResult.Status != sloStatusFail:
+			continue
+		case !indicatorResult.Value.Success:
+			observations = append(observations, fmt.Sprintf("%s is %s (%s)", indicatorResult.Value.Metric, indicatorResult.Status, indicatorResult.Value.Message))
+		default:
+			value := strconv.FormatFloat(indicatorResult.Value.Value, 'f', -1, 64)
+			observations = append(observations, fmt.Sprintf("%s=%s is %s", indicatorResult.Value.Metric, value, indicatorResult.Status))
+		}
+	}
+	if len(observations) > 0 {
+		message += ": " + strings.Join(observations, ", ")
+	}
+	return message
+}
+
+func getEvaluationFinishedEvent(result keptnv2.ResultType, status keptnv2.StatusType, evaluationTriggeredEvent keptnv2.EvaluationTriggeredEventData, message string, evaluation keptnv2.EvaluationDetails) keptnv2.EvaluationFinishedEventData {
+
+	return keptnv2.EvaluationFinishedEventData{
+		EventData: keptnv2.EventData{
+			Project: evaluationTriggeredEvent.Project,
+			Stage:   evaluationTriggeredEvent.Stage,
+			Service: evaluationTriggeredEvent.Service,
+			Labels:  evaluationTriggeredEvent.Labels,
+			Status:  status,
+			Result:  result,
+			Message: message,
+		},
+		Evaluation: evaluation,
+	}
+}
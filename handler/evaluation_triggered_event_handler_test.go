@@ -0,0 +1,187 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	keptnapi "github.com/keptn/go-utils/pkg/api/models"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/sdk"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+const testEvaluationSLIConfig = `---
+spec_version: '1.0'
+indicators:
+  response_time_p95: "histogram_quantile(0.95, sum(rate(http_response_time_bucket{job='$SERVICE-$PROJECT-$STAGE'}[$DURATION])) by (le))"
+  error_rate: "sum(rate(http_requests_total{job='$SERVICE-$PROJECT-$STAGE',status!~'2..'}[$DURATION]))"
+  throughput: "sum(rate(http_requests_total{job='$SERVICE-$PROJECT-$STAGE'}[$DURATION]))"
+`
+
+func getEvaluationFinishedEventData(t *testing.T, ce keptnapi.KeptnContextExtendedCE) keptnv2.EvaluationFinishedEventData {
+	eventData := keptnv2.EvaluationFinishedEventData{}
+	require.NoError(t, keptnv2.EventDataAs(ce, &eventData))
+	return eventData
+}
+
+// sliValuesBackend answers the queries of each indicator with the given value
+func sliValuesBackend(values map[string]float64) SLIBackend {
+	return sliBackendFunc(func(ctx context.Context, query SLIQuery) (float64, error) {
+		return values[query.Indicator], nil
+	})
+}
+
+func Test_Receiving_EvaluationTriggeredEvent(t *testing.T) {
+	resources := resourcesHandler{sloFile: testSLO, sliFile: testEvaluationSLIConfig}
+	responseTime := float64(400)
+	var queryStart, queryEnd time.Time
+	backend := sliBackendFunc(func(ctx context.Context, query SLIQuery) (float64, error) {
+		// the indicators are retrieved concurrently
+		if query.Indicator == "error_rate" {
+			queryStart, queryEnd = query.Start, query.End
+		}
+		return map[string]float64{"response_time_p95": responseTime, "error_rate": 0.001, "throughput": 120}[query.Indicator], nil
+	})
+	evaluationHandler := NewEvaluationTriggeredEventHandler(NewGetSliEventHandler(withTestSLIBackend(backend)))
+
+	evaluate := func(eventID string) keptnv2.EvaluationFinishedEventData {
+		event := newEvent("../test/events/evaluation_triggered.json")
+		event.ID = eventID
+
+		fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+		fakeKeptn.SetResourceHandler(resources)
+		fakeKeptn.AddTaskHandler("sh.keptn.event.evaluation.triggered", evaluationHandler)
+		fakeKeptn.NewEvent(event)
+
+		fakeKeptn.AssertNumberOfEventSent(t, 2)
+		fakeKeptn.AssertSentEventType(t, 1, keptnv2.GetFinishedEventType("evaluation"))
+		fakeKeptn.AssertSentEventStatus(t, 1, keptnv2.StatusSucceeded)
+		return getEvaluationFinishedEventData(t, fakeKeptn.SentEvents[1])
+	}
+
+	// the first evaluation has nothing to compare with
+	first := evaluate("event-1")
+	require.Equal(t, keptnv2.ResultPass, first.Result)
+	require.Equal(t, "evaluation pass with a score of 100", first.Message)
+	require.Equal(t, "2021-01-15T15:04:45Z", first.Evaluation.TimeStart)
+	require.Equal(t, "2021-01-15T15:09:45Z", first.Evaluation.TimeEnd)
+	require.Equal(t, 5*time.Minute, queryEnd.Sub(queryStart))
+	require.Empty(t, first.Evaluation.ComparedEvents)
+	slo, err := base64.StdEncoding.DecodeString(first.Evaluation.SLOFileContent)
+	require.NoError(t, err)
+	require.Equal(t, testSLO, string(slo))
+	require.Len(t, first.Evaluation.IndicatorResults, 3)
+	require.Equal(t, "info", first.Evaluation.IndicatorResults[2].Status)
+
+	// the response time increased by more than 10%
+	responseTime = 550
+	second := evaluate("event-2")
+	require.Equal(t, keptnv2.ResultWarning, second.Result)
+	require.Equal(t, "evaluation warning with a score of 66.67: response_time_p95=550 is warning", second.Message)
+	require.Equal(t, []string{"event-1"}, second.Evaluation.ComparedEvents)
+	require.Equal(t, float64(400), second.Evaluation.IndicatorResults[0].Value.ComparedValue)
+
+	// the average of both previous results is compared, a redelivered event is not compared with itself
+	responseTime = 500
+	third := evaluate("event-3")
+	require.Equal(t, keptnv2.ResultPass, third.Result)
+	require.Equal(t, []string{"event-2", "event-1"}, third.Evaluation.ComparedEvents)
+	require.Equal(t, float64(475), third.Evaluation.IndicatorResults[0].Value.ComparedValue)
+	redelivered := evaluate("event-3")
+	require.Equal(t, third.Evaluation, redelivered.Evaluation)
+}
+
+func Test_Receiving_EvaluationTriggeredEvent_Errors(t *testing.T) {
+	tests := []struct {
+		name        string
+		resources   resourcesHandler
+		evaluation  keptnv2.Evaluation
+		test        keptnv2.Test
+		sliProvider string
+		wantStatus  keptnv2.StatusType
+		wantResult  keptnv2.ResultType
+		wantMessage string
+	}{
+		{
+			name:        "no SLOs",
+			resources:   resourcesHandler{sliFile: testEvaluationSLIConfig},
+			evaluation:  keptnv2.Evaluation{Timeframe: "5m"},
+			wantStatus:  keptnv2.StatusSucceeded,
+			wantResult:  keptnv2.ResultPass,
+			wantMessage: "no evaluation performed as there is no slo.yaml",
+		},
+		{
+			name:        "time window of the tests",
+			resources:   resourcesHandler{sloFile: "spec_version: '1.0'\nobjectives:\n  - sli: error_rate\n    pass:\n      - criteria: ['<0.0001']\n", sliFile: testEvaluationSLIConfig},
+			test:        keptnv2.Test{Start: "2021-01-15T15:04:45Z", End: "2021-01-15T15:09:45Z"},
+			wantStatus:  keptnv2.StatusSucceeded,
+			wantResult:  keptnv2.ResultFailed,
+			wantMessage: "evaluation fail with a score of 0: error_rate=0.001 is fail",
+		},
+		{
+			name:        "no time window",
+			resources:   resourcesHandler{sloFile: testSLO, sliFile: testEvaluationSLIConfig},
+			wantStatus:  keptnv2.StatusErrored,
+			wantResult:  keptnv2.ResultFailed,
+			wantMessage: "the event defines no time window to evaluate, neither by the start and end or timeframe of the evaluation nor by the start and end of the tests",
+		},
+		{
+			name:        "invalid SLOs",
+			resources:   resourcesHandler{sloFile: "objectives: []", sliFile: testEvaluationSLIConfig},
+			evaluation:  keptnv2.Evaluation{Timeframe: "5m"},
+			wantStatus:  keptnv2.StatusErrored,
+			wantResult:  keptnv2.ResultFailed,
+			wantMessage: "invalid SLOs: spec_version must be set",
+		},
+		{
+			name:        "unknown SLI provider",
+			resources:   resourcesHandler{sloFile: testSLO, sliFile: testEvaluationSLIConfig},
+			evaluation:  keptnv2.Evaluation{Timeframe: "5m"},
+			sliProvider: "dynatrace",
+			wantStatus:  keptnv2.StatusErrored,
+			wantResult:  keptnv2.ResultFailed,
+			wantMessage: "could not retrieve SLIs: no SLI backend registered for sliProvider dynatrace",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := newEvent("../test/events/evaluation_triggered.json")
+			eventData := keptnv2.EvaluationTriggeredEventData{}
+			require.NoError(t, keptnv2.EventDataAs(event, &eventData))
+			eventData.Evaluation = tt.evaluation
+			eventData.Test = tt.test
+			event.Data = eventData
+
+			fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+			fakeKeptn.SetResourceHandler(tt.resources)
+			fakeKeptn.AddTaskHandler("sh.keptn.event.evaluation.triggered", NewEvaluationTriggeredEventHandler(
+				NewGetSliEventHandler(withTestSLIBackend(sliValuesBackend(map[string]float64{"error_rate": 0.001}))),
+				WithEvaluationSLIProvider(tt.sliProvider)))
+
+			fakeKeptn.NewEvent(event)
+
+			fakeKeptn.AssertNumberOfEventSent(t, 2)
+			fakeKeptn.AssertSentEventStatus(t, 1, tt.wantStatus)
+			fakeKeptn.AssertSentEventResult(t, 1, tt.wantResult)
+			require.Equal(t, tt.wantMessage, getEvaluationFinishedEventData(t, fakeKeptn.SentEvents[1]).Message)
+		})
+	}
+}
+
+func Test_evaluationTimeWindow(t *testing.T) {
+	now := time.Date(2022, 7, 1, 12, 0, 0, 0, time.UTC)
+
+	start, end, err := evaluationTimeWindow(keptnv2.EvaluationTriggeredEventData{Evaluation: keptnv2.Evaluation{Timeframe: "10m"}}, now)
+	require.NoError(t, err)
+	require.Equal(t, now.Add(-10*time.Minute), start)
+	require.Equal(t, now, end)
+
+	start, end, err = evaluationTimeWindow(keptnv2.EvaluationTriggeredEventData{Evaluation: keptnv2.Evaluation{Timeframe: "1h", End: "2022-07-01T10:00:00Z"}}, now)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2022, 7, 1, 9, 0, 0, 0, time.UTC), start)
+	require.Equal(t, time.Date(2022, 7, 1, 10, 0, 0, 0, time.UTC), end)
+
+	_, _, err = evaluationTimeWindow(keptnv2.EvaluationTriggeredEventData{Evaluation: keptnv2.Evaluation{Timeframe: "an hour"}}, now)
+	require.EqualError(t, err, `could not parse timeframe "an hour" of the evaluation`)
+}
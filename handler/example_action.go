@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"github.com/keptn/go-utils/pkg/sdk"
+	"time"
+)
+
+// ExampleAction is an example remediation action that only waits, maybe the problem fixes itself.
+// TODO: Replace it with your remediation action
+type ExampleAction struct {
+	wait time.Duration
+}
+
+// NewExampleAction creates a new ExampleAction waiting for the given duration
+func NewExampleAction(wait time.Duration) *ExampleAction {
+	return &ExampleAction{
+		wait: wait,
+	}
+}
+
+// ParameterSchema returns the schema of the value, an optional string the example does not use
+func (a *ExampleAction) ParameterSchema() *ParameterSchema {
+	return &ParameterSchema{
+		Type:        ParameterTypeString,
+		Description: "not used by the example",
+		Optional:    true,
+	}
+}
+
+// NewParameters returns the value the string is decoded into
+func (a *ExampleAction) NewParameters() interface{} {
+	return new(string)
+}
+
+// Describe returns a description of the action
+func (a *ExampleAction) Describe(req ActionRequest) string {
+	return fmt.Sprintf("wait %s for service %s in stage %s", a.wait, req.Event.Service, req.Event.Stage)
+}
+
+// Validate accepts every request
+func (a *ExampleAction) Validate(req ActionRequest) error {
+	return nil
+}
+
+// Execute waits for the configured duration
+func (a *ExampleAction) Execute(ctx context.Context, k sdk.IKeptn, req ActionRequest) (ActionResult, error) {
+	k.Logger().Info("Action remediation triggered")
+
+	select {
+	case <-time.After(a.wait):
+	case <-ctx.Done():
+		return ActionResult{}, ctx.Err()
+	}
+
+	return ActionResult{}, nil
+}
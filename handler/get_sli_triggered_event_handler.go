@@ -1,19 +1,107 @@
 package handler
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	api "github.com/keptn/go-utils/pkg/api/utils"
 	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
 	"github.com/keptn/go-utils/pkg/sdk"
+	"sync"
+	"time"
 )
 
+const defaultSLIMaxParallelism = 5
+const defaultSLIQueryTimeout = 30 * time.Second
+
 type GetSliEventHandler struct {
+	backends       *SLIBackendRegistry
+	credentials    CredentialsProvider
+	cache          *SLIResultCache
+	failurePolicy  SLIFailurePolicy
+	maxParallelism int
+	queryTimeout   time.Duration
+}
+
+// GetSliEventHandlerOption can be used to configure the GetSliEventHandler
+type GetSliEventHandlerOption func(*GetSliEventHandler)
+
+// WithSLIBackends configures the backends answering get-sli events, keyed by sliProvider
+func WithSLIBackends(backends *SLIBackendRegistry) GetSliEventHandlerOption {
+	return func(g *GetSliEventHandler) {
+		g.backends = backends
+	}
+}
+
+// WithCredentialsProvider configures where the credentials for the SLI backends are read from
+func WithCredentialsProvider(credentials CredentialsProvider) GetSliEventHandlerOption {
+	return func(g *GetSliEventHandler) {
+		g.credentials = credentials
+	}
+}
+
+// WithSLIResultCache configures a cache for the values of identical queries, e.g. of retried get-sli.triggered events
+func WithSLIResultCache(cache *SLIResultCache) GetSliEventHandlerOption {
+	return func(g *GetSliEventHandler) {
+		g.cache = cache
+	}
+}
+
+// WithSLIFailurePolicy configures the result reported when some of the indicators could not be retrieved
+func WithSLIFailurePolicy(policy SLIFailurePolicy) GetSliEventHandlerOption {
+	return func(g *GetSliEventHandler) {
+		g.failurePolicy = policy
+	}
 }
 
-func NewGetSliEventHandler() *GetSliEventHandler {
-	return &GetSliEventHandler{}
+// WithMaxParallelism limits the number of indicators that are retrieved concurrently
+func WithMaxParallelism(maxParallelism int) GetSliEventHandlerOption {
+	return func(g *GetSliEventHandler) {
+		if maxParallelism > 0 {
+			g.maxParallelism = maxParallelism
+		}
+	}
+}
+
+// WithQueryTimeout configures the deadline for retrieving the value of a single indicator
+func WithQueryTimeout(timeout time.Duration) GetSliEventHandlerOption {
+	return func(g *GetSliEventHandler) {
+		if timeout > 0 {
+			g.queryTimeout = timeout
+		}
+	}
 }
 
-// Execute handles get-sli.triggered events if SLIProvider == keptn-service-template-go
+func NewGetSliEventHandler(opts ...GetSliEventHandlerOption) *GetSliEventHandler {
+	handler := &GetSliEventHandler{
+		backends:       NewSLIBackendRegistry(),
+		failurePolicy:  SLIFailurePolicyWarning,
+		maxParallelism: defaultSLIMaxParallelism,
+		queryTimeout:   defaultSLIQueryTimeout,
+	}
+	for _, opt := range opts {
+		opt(handler)
+	}
+	return handler
+}
+
+// Filter accepts get-sli.triggered events whose sliProvider a backend is registered for. It has to be registered
+// along with the handler, so that events meant for other providers are neither started nor finished by this service
+func (g *GetSliEventHandler) Filter(k sdk.IKeptn, event sdk.KeptnEvent) bool {
+	sliTriggeredEvent := &keptnv2.GetSLITriggeredEventData{}
+	if err := keptnv2.Decode(event.Data, sliTriggeredEvent); err != nil {
+		// let Execute report the malformed event
+		return true
+	}
+
+	if _, ok := g.backends.Get(sliTriggeredEvent.GetSLI.SLIProvider); !ok {
+		k.Logger().Infof("Not handling get-sli event as it is meant for %s", sliTriggeredEvent.GetSLI.SLIProvider)
+		return false
+	}
+	return true
+}
+
+// Execute handles get-sli.triggered events accepted by Filter
 // This function acts as an example showing how to handle get-sli events
 // TODO: Adapt handler code to your needs
 func (g *GetSliEventHandler) Execute(k sdk.IKeptn, event sdk.KeptnEvent) (interface{}, *sdk.Error) {
@@ -25,39 +113,232 @@ func (g *GetSliEventHandler) Execute(k sdk.IKeptn, event sdk.KeptnEvent) (interf
 		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: "failed to decode sli.triggered event: " + err.Error()}
 	}
 
-	// Check if the event belongs to our SLI Provider
-	if sliTriggeredEvent.GetSLI.SLIProvider != "keptn-service-template-go" {
-		k.Logger().Infof("Not handling get-sli event as it is meant for %s", sliTriggeredEvent.GetSLI.SLIProvider)
-		return nil, nil
+	start, end, err := parseSLITimeWindow(sliTriggeredEvent.GetSLI)
+	if err != nil {
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+	}
+
+	sliResults, err := g.retrieveSLIs(context.Background(), k, *sliTriggeredEvent, start, end)
+	if err != nil {
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
 	}
 
-	// Get SLI File from keptn-service-template-go subdirectory of the config repo - to add the file use:
-	sliFile := "keptn-service-template-go/sli.yaml"
+	result, message := g.failurePolicy.evaluate(sliResults)
+	finishedEventData := getSliFinishedEvent(result, keptnv2.StatusSucceeded, *sliTriggeredEvent, message, sliResults)
+
+	return finishedEventData, nil
+}
+
+// retrieveSLIs retrieves the values of the indicators of the given event using the backend of its sliProvider.
+// Failures of single indicators are reported in the returned results, an error is returned if the SLI config or credentials could not be loaded
+func (g *GetSliEventHandler) retrieveSLIs(ctx context.Context, k sdk.IKeptn, sliTriggeredEvent keptnv2.GetSLITriggeredEventData, start time.Time, end time.Time) ([]*keptnv2.SLIResult, error) {
+	backend, ok := g.backends.Get(sliTriggeredEvent.GetSLI.SLIProvider)
+	if !ok {
+		return nil, fmt.Errorf("no SLI backend registered for sliProvider %s", sliTriggeredEvent.GetSLI.SLIProvider)
+	}
+
+	// Get the sli.yaml from the keptn-service-template-go subdirectory of the config repo, see the SLI configuration section of the README
 	resourceScope := *api.NewResourceScope().Project(sliTriggeredEvent.Project).Stage(sliTriggeredEvent.Stage).Service(sliTriggeredEvent.Service).Resource(sliFile)
 	sliConfigFileContent, err := k.GetResourceHandler().GetResource(resourceScope)
 
 	if err != nil {
 		k.Logger().Infof("Error while fetching SLI file: %e", err)
-		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: "error while fetching SLI file: " + err.Error()}
+		return nil, fmt.Errorf("error while fetching SLI file: %w", err)
+	}
+
+	if sliConfigFileContent == nil {
+		return nil, fmt.Errorf("error while fetching SLI file: could not find %s", sliFile)
 	}
 
-	k.Logger().Infof("SLI config content: %s", sliConfigFileContent)
+	k.Logger().Debugf("SLI config content: %s", sliConfigFileContent.ResourceContent)
 
-	// TODO: Implement your functionality here
-	indicators := sliTriggeredEvent.GetSLI.Indicators
-	var sliResults []*keptnv2.SLIResult
+	sliConfig, err := ParseSLIConfig([]byte(sliConfigFileContent.ResourceContent))
+	if err != nil {
+		return nil, err
+	}
 
-	for _, indicatorName := range indicators {
-		sliResult := &keptnv2.SLIResult{
-			Metric: indicatorName,
-			Value:  123.4, // TODO: Fetch the values from your monitoring tool here
+	request := sliRequest{
+		sliProvider:  sliTriggeredEvent.GetSLI.SLIProvider,
+		project:      sliTriggeredEvent.Project,
+		backend:      backend,
+		sliConfig:    sliConfig,
+		placeholders: NewSLIQueryPlaceholders(sliTriggeredEvent, start, end),
+		filters:      getSLIFilters(sliTriggeredEvent.GetSLI.CustomFilters),
+		start:        start,
+		end:          end,
+	}
+	if g.credentials != nil {
+		request.credentials, err = g.credentials.GetCredentials(ctx, sliTriggeredEvent.GetSLI.SLIProvider, sliTriggeredEvent.Project)
+		if err != nil {
+			return nil, fmt.Errorf("could not load credentials for %s: %w", sliTriggeredEvent.GetSLI.SLIProvider, err)
 		}
-		sliResults = append(sliResults, sliResult)
 	}
 
-	finishedEventData := getSliFinishedEvent(keptnv2.ResultPass, keptnv2.StatusSucceeded, *sliTriggeredEvent, "", sliResults)
+	sliResults := g.getSLIResults(ctx, k, sliTriggeredEvent.GetSLI.Indicators, request)
 
-	return finishedEventData, nil
+	if g.cache != nil {
+		stats := g.cache.Stats()
+		k.Logger().Debugf("SLI result cache: %d hits, %d misses, %d entries", stats.Hits, stats.Misses, stats.Size)
+	}
+
+	if request.credentials != nil && hasFailedSLIResult(sliResults) {
+		// the credentials might have been rotated, make sure they are read again for the next event
+		g.credentials.Invalidate(sliTriggeredEvent.GetSLI.SLIProvider, sliTriggeredEvent.Project)
+	}
+
+	return sliResults, nil
+}
+
+// sliRequest bundles everything needed to retrieve the indicators of a get-sli.triggered event
+type sliRequest struct {
+	sliProvider  string
+	project      string
+	backend      SLIBackend
+	sliConfig    *SLIConfig
+	placeholders SLIQueryPlaceholders
+	filters      map[string]string
+	credentials  Credentials
+	start        time.Time
+	end          time.Time
+}
+
+// getSLIResults retrieves the values of the given indicators concurrently, using at most maxParallelism workers.
+// The returned results are in the same order as the indicators
+func (g *GetSliEventHandler) getSLIResults(ctx context.Context, k sdk.IKeptn, indicators []string, request sliRequest) []*keptnv2.SLIResult {
+	sliResults := make([]*keptnv2.SLIResult, len(indicators))
+	workers := make(chan struct{}, g.maxParallelism)
+	wg := sync.WaitGroup{}
+
+	for i, indicatorName := range indicators {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(i int, indicatorName string) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+
+			queryCtx, cancel := context.WithTimeout(ctx, g.queryTimeout)
+			defer cancel()
+
+			sliResult := g.getSLIResult(queryCtx, k, indicatorName, request)
+			if !sliResult.Success {
+				k.Logger().Errorf("Could not retrieve value for indicator %s: %s", indicatorName, sliResult.Message)
+			}
+			sliResults[i] = sliResult
+		}(i, indicatorName)
+	}
+
+	wg.Wait()
+	return sliResults
+}
+
+// getSLIResult retrieves the value of a single indicator. Failures are reported in the returned SLIResult
+func (g *GetSliEventHandler) getSLIResult(ctx context.Context, k sdk.IKeptn, indicatorName string, request sliRequest) *keptnv2.SLIResult {
+	definition, err := request.sliConfig.GetIndicator(indicatorName)
+	if err != nil {
+		return failedSLIResult(indicatorName, err)
+	}
+
+	definition, err = definition.expand(request.placeholders)
+	if err != nil {
+		return failedSLIResult(indicatorName, fmt.Errorf("could not expand query: %w", err))
+	}
+	k.Logger().Debugf("Query for indicator %s: %s", indicatorName, definition)
+
+	cacheKey := sliResultCacheKey{
+		SLIProvider:    request.sliProvider,
+		Project:        request.project,
+		CredentialsURL: request.credentials[CredentialsKeyURL],
+		Definition:     definition,
+		Filters:        request.filters,
+		Start:          request.start,
+		End:            request.end,
+	}
+	if g.cache != nil {
+		if value, ok := g.cache.Get(cacheKey); ok {
+			k.Logger().Debugf("Using cached value for indicator %s", indicatorName)
+			return &keptnv2.SLIResult{
+				Metric:  indicatorName,
+				Value:   value,
+				Success: true,
+			}
+		}
+	}
+
+	value, err := request.backend.GetSLIValue(ctx, SLIQuery{
+		Indicator:   indicatorName,
+		Query:       definition.Query,
+		Definition:  definition,
+		Start:       request.start,
+		End:         request.end,
+		Filters:     request.filters,
+		Credentials: request.credentials,
+	})
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return failedSLIResult(indicatorName, fmt.Errorf("query did not finish within %s", g.queryTimeout))
+	}
+	if err != nil {
+		return failedSLIResult(indicatorName, fmt.Errorf("could not retrieve value: %w", err))
+	}
+
+	// only successfully retrieved values are cached, failed queries are retried with the next event
+	if g.cache != nil {
+		g.cache.Add(cacheKey, value)
+	}
+
+	return &keptnv2.SLIResult{
+		Metric:  indicatorName,
+		Value:   value,
+		Success: true,
+	}
+}
+
+func hasFailedSLIResult(sliResults []*keptnv2.SLIResult) bool {
+	for _, sliResult := range sliResults {
+		if !sliResult.Success {
+			return true
+		}
+	}
+	return false
+}
+
+func failedSLIResult(indicatorName string, err error) *keptnv2.SLIResult {
+	return &keptnv2.SLIResult{
+		Metric:  indicatorName,
+		Success: false,
+		Message: err.Error(),
+	}
+}
+
+// getSLIFilters converts the custom filters of a get-sli.triggered event to a map
+func getSLIFilters(customFilters []*keptnv2.SLIFilter) map[string]string {
+	filters := map[string]string{}
+	for _, filter := range customFilters {
+		if filter != nil {
+			filters[filter.Key] = filter.Value
+		}
+	}
+	return filters
+}
+
+// parseSLITimeWindow returns the start and end of the time window the SLIs shall be evaluated for
+func parseSLITimeWindow(getSLI keptnv2.GetSLI) (time.Time, time.Time, error) {
+	start, err := time.Parse(time.RFC3339, getSLI.Start)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("could not parse start of the time window %q: %w", getSLI.Start, err)
+	}
+
+	end, err := time.Parse(time.RFC3339, getSLI.End)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("could not parse end of the time window %q: %w", getSLI.End, err)
+	}
+
+	if end.Before(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("end of the time window %s is before its start %s", getSLI.End, getSLI.Start)
+	}
+
+	return start, end, nil
 }
 
 func getSliFinishedEvent(result keptnv2.ResultType, status keptnv2.StatusType, sliTriggeredEvent keptnv2.GetSLITriggeredEventData, message string, sliResult []*keptnv2.SLIResult) keptnv2.GetSLIFinishedEventData {
@@ -73,6 +354,8 @@ func getSliFinishedEvent(result keptnv2.ResultType, status keptnv2.StatusType, s
 			Message: message,
 		},
 		GetSLI: keptnv2.GetSLIFinished{
+			Start:           sliTriggeredEvent.GetSLI.Start,
+			End:             sliTriggeredEvent.GetSLI.End,
 			IndicatorValues: sliResult,
 		},
 	}
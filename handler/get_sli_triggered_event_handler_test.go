@@ -1,42 +1,53 @@
 package handler
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
+	"fmt"
 	keptnapi "github.com/keptn/go-utils/pkg/api/models"
 	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
 	"github.com/keptn/go-utils/pkg/sdk"
-	"io/ioutil"
+	"github.com/stretchr/testify/require"
 	"net/http"
 	"net/http/httptest"
-	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
-func Test_Receiving_GetSliTriggeredEvent(t *testing.T) {
-	var returnedStatusCode = 200
-	ts := httptest.NewServer(
-		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Add("Content-Type", "application/json")
-			if strings.Contains(r.URL.String(), "/admin/features/") {
-				w.WriteHeader(returnedStatusCode)
-				w.Write([]byte(`{}`))
-				return
-			}
+const testSLIConfig = `---
+spec_version: '1.0'
+indicators:
+  response_time_p95: "histogram_quantile(0.95, sum(rate(http_response_time_bucket{job='$SERVICE-$PROJECT-$STAGE'}[$DURATION])) by (le))"
+  some_other_metric: "sum(rate(http_requests_total{job='$SERVICE-$PROJECT-$STAGE'}[$DURATION]))"
+`
 
-			defer r.Body.Close()
-			body, _ := ioutil.ReadAll(r.Body)
-			keptnCE := &keptnapi.KeptnContextExtendedCE{}
+// withTestSLIBackend registers the given backend for the sliProvider used in the test events
+func withTestSLIBackend(backend SLIBackend) GetSliEventHandlerOption {
+	backends := NewSLIBackendRegistry()
+	backends.Register("keptn-service-template-go", backend)
+	return WithSLIBackends(backends)
+}
 
-			_ = json.Unmarshal(body, keptnCE)
+// getSliFinishedEventData decodes the data of a sent get-sli.finished event
+func getSliFinishedEventData(t *testing.T, ce keptnapi.KeptnContextExtendedCE) keptnv2.GetSLIFinishedEventData {
+	eventData := keptnv2.GetSLIFinishedEventData{}
+	require.NoError(t, keptnv2.EventDataAs(ce, &eventData))
+	return eventData
+}
 
-			w.WriteHeader(returnedStatusCode)
-			w.Write([]byte(`{}`))
-		}),
-	)
+func Test_Receiving_GetSliTriggeredEvent(t *testing.T) {
+	ts := newPrometheusTestServer(t, map[string]string{
+		"histogram_quantile(0.95, sum(rate(http_response_time_bucket{job='nginx-user-managed-dev'}[300s])) by (le))": prometheusMatrixResponse("0.312"),
+		"sum(rate(http_requests_total{job='nginx-user-managed-dev'}[300s]))":                                         prometheusMatrixResponse("120"),
+	})
 	defer ts.Close()
 
 	fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
-	fakeKeptn.AddTaskHandler("sh.keptn.event.get-sli.triggered", NewGetSliEventHandler())
+	fakeKeptn.SetResourceHandler(sdk.StringResourceHandler{ResourceContent: testSLIConfig})
+	fakeKeptn.AddTaskHandler("sh.keptn.event.get-sli.triggered", NewGetSliEventHandler(
+		withTestSLIBackend(NewPrometheusBackend(ts.URL, ts.Client()))))
 
 	fakeKeptn.NewEvent(newEvent("../test/events/get_sli_triggered.json"))
 
@@ -47,4 +58,266 @@ func Test_Receiving_GetSliTriggeredEvent(t *testing.T) {
 
 	fakeKeptn.AssertSentEventStatus(t, 1, keptnv2.StatusSucceeded)
 	fakeKeptn.AssertSentEventResult(t, 1, keptnv2.ResultPass)
+
+	finishedEventData := getSliFinishedEventData(t, fakeKeptn.SentEvents[1])
+	require.Equal(t, "2021-01-15T15:04:45.000Z", finishedEventData.GetSLI.Start)
+	require.Equal(t, "2021-01-15T15:09:45.000Z", finishedEventData.GetSLI.End)
+	require.Equal(t, []*keptnv2.SLIResult{
+		{Metric: "response_time_p95", Value: 0.312, Success: true},
+		{Metric: "some_other_metric", Value: 120, Success: true},
+	}, finishedEventData.GetSLI.IndicatorValues)
+}
+
+func Test_Receiving_GetSliTriggeredEvent_QueryFails(t *testing.T) {
+	ts := newPrometheusTestServer(t, map[string]string{
+		"histogram_quantile(0.95, sum(rate(http_response_time_bucket{job='nginx-user-managed-dev'}[300s])) by (le))": prometheusMatrixResponse("0.312"),
+	})
+	defer ts.Close()
+
+	tests := []struct {
+		name       string
+		policy     SLIFailurePolicy
+		wantResult keptnv2.ResultType
+	}{
+		{
+			name:       "warning policy",
+			policy:     SLIFailurePolicyWarning,
+			wantResult: keptnv2.ResultWarning,
+		},
+		{
+			name:       "fail policy",
+			policy:     SLIFailurePolicyFail,
+			wantResult: keptnv2.ResultFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+			fakeKeptn.SetResourceHandler(sdk.StringResourceHandler{ResourceContent: testSLIConfig})
+			fakeKeptn.AddTaskHandler("sh.keptn.event.get-sli.triggered", NewGetSliEventHandler(
+				withTestSLIBackend(NewPrometheusBackend(ts.URL, ts.Client())),
+				WithSLIFailurePolicy(tt.policy)))
+
+			fakeKeptn.NewEvent(newEvent("../test/events/get_sli_triggered.json"))
+
+			fakeKeptn.AssertNumberOfEventSent(t, 2)
+
+			fakeKeptn.AssertSentEventType(t, 1, keptnv2.GetFinishedEventType("get-sli"))
+			fakeKeptn.AssertSentEventStatus(t, 1, keptnv2.StatusSucceeded)
+			fakeKeptn.AssertSentEventResult(t, 1, tt.wantResult)
+
+			finishedEventData := getSliFinishedEventData(t, fakeKeptn.SentEvents[1])
+			require.Equal(t, "1 of 2 indicators could not be retrieved: some_other_metric", finishedEventData.Message)
+			require.Equal(t, []*keptnv2.SLIResult{
+				{Metric: "response_time_p95", Value: 0.312, Success: true},
+				{Metric: "some_other_metric", Success: false, Message: "could not retrieve value: query failed with status code 400: bad_data: unknown query"},
+			}, finishedEventData.GetSLI.IndicatorValues)
+		})
+	}
+}
+
+func Test_Receiving_GetSliTriggeredEvent_InvalidSLIConfig(t *testing.T) {
+	fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+	fakeKeptn.SetResourceHandler(sdk.StringResourceHandler{ResourceContent: `---
+spec_version: '1.0'
+indicators:
+  response_time_p95: ""
+`})
+	fakeKeptn.AddTaskHandler("sh.keptn.event.get-sli.triggered", NewGetSliEventHandler(
+		withTestSLIBackend(NewPrometheusBackend("http://prometheus", nil))))
+
+	fakeKeptn.NewEvent(newEvent("../test/events/get_sli_triggered.json"))
+
+	fakeKeptn.AssertNumberOfEventSent(t, 2)
+
+	fakeKeptn.AssertSentEventType(t, 1, keptnv2.GetFinishedEventType("get-sli"))
+	fakeKeptn.AssertSentEventStatus(t, 1, keptnv2.StatusErrored)
+	fakeKeptn.AssertSentEventResult(t, 1, keptnv2.ResultFailed)
+	fakeKeptn.AssertSentEvent(t, 1, func(ce keptnapi.KeptnContextExtendedCE) bool {
+		eventData := keptnv2.EventData{}
+		_ = keptnv2.EventDataAs(ce, &eventData)
+		return eventData.Message == "invalid SLI config: indicator response_time_p95 has an empty query"
+	})
+}
+
+func Test_Receiving_GetSliTriggeredEvent_UnknownPlaceholder(t *testing.T) {
+	fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+	fakeKeptn.SetResourceHandler(sdk.StringResourceHandler{ResourceContent: `---
+spec_version: '1.0'
+indicators:
+  response_time_p95: "histogram_quantile(0.95, sum(rate(http_response_time_bucket{handler='$handler'}[$DURATION])) by (le))"
+  some_other_metric: "sum(up{job=~'$SERVICE-.*$'})"
+`})
+	var queries []string
+	var mutex sync.Mutex
+	fakeKeptn.AddTaskHandler("sh.keptn.event.get-sli.triggered", NewGetSliEventHandler(
+		withTestSLIBackend(sliBackendFunc(func(ctx context.Context, query SLIQuery) (float64, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			queries = append(queries, query.Definition.Query)
+			return 1, nil
+		}))))
+
+	fakeKeptn.NewEvent(newEvent("../test/events/get_sli_triggered.json"))
+
+	fakeKeptn.AssertNumberOfEventSent(t, 2)
+	fakeKeptn.AssertSentEventResult(t, 1, keptnv2.ResultPass)
+
+	// a $ that is no known placeholder is sent to the monitoring tool as is
+	require.ElementsMatch(t, []string{
+		"histogram_quantile(0.95, sum(rate(http_response_time_bucket{handler='$handler'}[300s])) by (le))",
+		"sum(up{job=~'nginx-.*$'})",
+	}, queries)
+}
+
+func Test_GetSliEventHandler_getSLIResults_BoundedParallelism(t *testing.T) {
+	var inFlight, maxInFlight int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			observed := atomic.LoadInt32(&maxInFlight)
+			if current <= observed || atomic.CompareAndSwapInt32(&maxInFlight, observed, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		// echo the queried number so the order of the results can be verified
+		w.Write([]byte(prometheusMatrixResponse(r.URL.Query().Get("query"))))
+	}))
+	defer ts.Close()
+
+	sliConfig := &SLIConfig{SpecVersion: "1.0", Indicators: map[string]SLIIndicator{}}
+	var indicators []string
+	for i := 0; i < 10; i++ {
+		indicator := fmt.Sprintf("indicator_%d", i)
+		indicators = append(indicators, indicator)
+		sliConfig.Indicators[indicator] = SLIIndicator{Query: fmt.Sprint(i)}
+	}
+
+	handler := NewGetSliEventHandler(WithMaxParallelism(3))
+
+	sliResults := handler.getSLIResults(context.Background(), sdk.NewFakeKeptn("test-service-template-svc").Keptn, indicators, sliRequest{
+		backend:      NewPrometheusBackend(ts.URL, ts.Client()),
+		sliConfig:    sliConfig,
+		placeholders: SLIQueryPlaceholders{},
+		start:        time.Now().Add(-5 * time.Minute),
+		end:          time.Now(),
+	})
+
+	require.Len(t, sliResults, len(indicators))
+	for i, sliResult := range sliResults {
+		require.Equal(t, &keptnv2.SLIResult{Metric: indicators[i], Value: float64(i), Success: true}, sliResult)
+	}
+	require.LessOrEqual(t, atomic.LoadInt32(&maxInFlight), int32(3))
+	require.Greater(t, atomic.LoadInt32(&maxInFlight), int32(1))
+}
+
+func Test_GetSliEventHandler_getSLIResults_QueryTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("query") == "slow" {
+			select {
+			case <-r.Context().Done():
+			case <-time.After(5 * time.Second):
+			}
+		}
+		w.Write([]byte(prometheusMatrixResponse("1")))
+	}))
+	defer ts.Close()
+
+	sliConfig := &SLIConfig{SpecVersion: "1.0", Indicators: map[string]SLIIndicator{"slow_metric": {Query: "slow"}, "fast_metric": {Query: "fast"}}}
+
+	handler := NewGetSliEventHandler(WithQueryTimeout(50 * time.Millisecond))
+
+	sliResults := handler.getSLIResults(context.Background(), sdk.NewFakeKeptn("test-service-template-svc").Keptn, []string{"slow_metric", "fast_metric"}, sliRequest{
+		backend:      NewPrometheusBackend(ts.URL, ts.Client()),
+		sliConfig:    sliConfig,
+		placeholders: SLIQueryPlaceholders{},
+		start:        time.Now().Add(-5 * time.Minute),
+		end:          time.Now(),
+	})
+
+	require.Equal(t, []*keptnv2.SLIResult{
+		{Metric: "slow_metric", Success: false, Message: "query did not finish within 50ms"},
+		{Metric: "fast_metric", Value: 1, Success: true},
+	}, sliResults)
+}
+
+func Test_Receiving_GetSliTriggeredEvent_SelectsBackendBySLIProvider(t *testing.T) {
+	var receivedQuery SLIQuery
+	backends := NewSLIBackendRegistry()
+	backends.Register("other-provider", constantSLIBackend(1))
+	backends.Register("keptn-service-template-go", sliBackendFunc(func(ctx context.Context, query SLIQuery) (float64, error) {
+		receivedQuery = query
+		return 2, nil
+	}))
+
+	fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+	fakeKeptn.SetResourceHandler(sdk.StringResourceHandler{ResourceContent: testSLIConfig})
+	fakeKeptn.AddTaskHandler("sh.keptn.event.get-sli.triggered", NewGetSliEventHandler(WithSLIBackends(backends)))
+
+	event := newEvent("../test/events/get_sli_triggered.json")
+	event.Data.(map[string]interface{})["get-sli"].(map[string]interface{})["indicators"] = []string{"some_other_metric"}
+	fakeKeptn.NewEvent(event)
+
+	fakeKeptn.AssertNumberOfEventSent(t, 2)
+	fakeKeptn.AssertSentEventResult(t, 1, keptnv2.ResultPass)
+
+	finishedEventData := getSliFinishedEventData(t, fakeKeptn.SentEvents[1])
+	require.Equal(t, []*keptnv2.SLIResult{{Metric: "some_other_metric", Value: 2, Success: true}}, finishedEventData.GetSLI.IndicatorValues)
+	require.Equal(t, "some_other_metric", receivedQuery.Indicator)
+	require.Equal(t, "sum(rate(http_requests_total{job='nginx-user-managed-dev'}[300s]))", receivedQuery.Query)
+	require.Equal(t, time.Date(2021, 1, 15, 15, 4, 45, 0, time.UTC), receivedQuery.Start)
+	require.Equal(t, time.Date(2021, 1, 15, 15, 9, 45, 0, time.UTC), receivedQuery.End)
+}
+
+func Test_Receiving_GetSliTriggeredEvent_UnknownSLIProvider(t *testing.T) {
+	backends := NewSLIBackendRegistry()
+	backends.Register("other-provider", constantSLIBackend(1))
+
+	fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+	fakeKeptn.SetResourceHandler(sdk.StringResourceHandler{ResourceContent: testSLIConfig})
+	getSliHandler := NewGetSliEventHandler(WithSLIBackends(backends))
+	fakeKeptn.AddTaskHandler("sh.keptn.event.get-sli.triggered", getSliHandler, getSliHandler.Filter)
+
+	fakeKeptn.NewEvent(newEvent("../test/events/get_sli_triggered.json"))
+
+	// neither the started nor the finished event is sent, both are left to the actual provider
+	fakeKeptn.AssertNumberOfEventSent(t, 0)
+}
+
+// staticCredentialsProvider returns the same credentials for all projects and records invalidations
+type staticCredentialsProvider struct {
+	credentials   Credentials
+	invalidations []string
+}
+
+func (p *staticCredentialsProvider) GetCredentials(ctx context.Context, sliProvider string, project string) (Credentials, error) {
+	return p.credentials, nil
+}
+
+func (p *staticCredentialsProvider) Invalidate(sliProvider string, project string) {
+	p.invalidations = append(p.invalidations, sliProvider+"/"+project)
+}
+
+func Test_Receiving_GetSliTriggeredEvent_PassesCredentials(t *testing.T) {
+	credentials := &staticCredentialsProvider{credentials: Credentials{"token": "abc"}}
+
+	fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+	fakeKeptn.SetResourceHandler(sdk.StringResourceHandler{ResourceContent: testSLIConfig})
+	fakeKeptn.AddTaskHandler("sh.keptn.event.get-sli.triggered", NewGetSliEventHandler(
+		WithCredentialsProvider(credentials),
+		withTestSLIBackend(sliBackendFunc(func(ctx context.Context, query SLIQuery) (float64, error) {
+			require.Equal(t, Credentials{"token": "abc"}, query.Credentials)
+			if query.Indicator == "some_other_metric" {
+				return 0, errors.New("unauthorized")
+			}
+			return 1, nil
+		}))))
+
+	fakeKeptn.NewEvent(newEvent("../test/events/get_sli_triggered.json"))
+
+	fakeKeptn.AssertNumberOfEventSent(t, 2)
+	fakeKeptn.AssertSentEventResult(t, 1, keptnv2.ResultWarning)
+	require.Equal(t, []string{"keptn-service-template-go/user-managed"}, credentials.invalidations)
 }
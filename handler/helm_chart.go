@@ -0,0 +1,357 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"helm.sh/helm/v3/pkg/engine"
+	"helm.sh/helm/v3/pkg/releaseutil"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/yaml"
+	"strings"
+)
+
+// managedByLabel marks the objects applied by this service
+const managedByLabel = "app.kubernetes.io/managed-by"
+const managedByValue = "keptn-service-template-go"
+
+// lastAppliedAnnotation holds the manifest an object was last applied with, see applyObject
+const lastAppliedAnnotation = "keptn.sh/last-applied-configuration"
+
+// inventoryKey is the key of the objects applied for a service in its inventory ConfigMap, see pruneObjects
+const inventoryKey = "objects"
+
+var namespaceResource = schema.GroupVersionResource{Version: "v1", Resource: "namespaces"}
+var configMapResource = schema.GroupVersionResource{Version: "v1", Resource: "configmaps"}
+
+// clusterScopedKinds are the built-in kinds of objects that do not belong to a namespace
+var clusterScopedKinds = map[string]bool{
+	"APIService":                     true,
+	"CertificateSigningRequest":      true,
+	"ClusterRole":                    true,
+	"ClusterRoleBinding":             true,
+	"ComponentStatus":                true,
+	"CSIDriver":                      true,
+	"CSINode":                        true,
+	"CustomResourceDefinition":       true,
+	"FlowSchema":                     true,
+	"IngressClass":                   true,
+	"MutatingWebhookConfiguration":   true,
+	"Namespace":                      true,
+	"Node":                           true,
+	"PersistentVolume":               true,
+	"PodSecurityPolicy":              true,
+	"PriorityClass":                  true,
+	"PriorityLevelConfiguration":     true,
+	"RuntimeClass":                   true,
+	"StorageClass":                   true,
+	"ValidatingWebhookConfiguration": true,
+	"VolumeAttachment":               true,
+}
+
+// defaultRESTMapper maps the built-in kinds of Kubernetes to their resources.
+// Custom resources require a RESTMapper using the discovery API of the cluster, see WithDeploymentRESTMapper
+func defaultRESTMapper() meta.RESTMapper {
+	mapper := meta.NewDefaultRESTMapper(scheme.Scheme.PrioritizedVersionsAllGroups())
+	for gvk := range scheme.Scheme.AllKnownTypes() {
+		if gvk.Version == runtime.APIVersionInternal || strings.HasSuffix(gvk.Kind, "List") {
+			continue
+		}
+		if clusterScopedKinds[gvk.Kind] {
+			mapper.Add(gvk, meta.RESTScopeRoot)
+		} else {
+			mapper.Add(gvk, meta.RESTScopeNamespace)
+		}
+	}
+	return mapper
+}
+
+// chartResource returns the location of the Helm chart archive of a service within its config repo,
+// the same location the helm-service of Keptn uses
+func chartResource(service string) string {
+	return fmt.Sprintf("helm/%s.tgz", service)
+}
+
+// renderChart renders the given chart archive for a release with the given name and namespace.
+// The values are merged into the default values of the chart. The objects are returned in the order Helm installs them,
+// hooks are not supported and skipped
+func renderChart(archive []byte, release string, namespace string, values map[string]interface{}) ([]*unstructured.Unstructured, error) {
+	chart, err := loader.LoadArchive(bytes.NewReader(archive))
+	if err != nil {
+		return nil, fmt.Errorf("could not load chart: %w", err)
+	}
+
+	renderValues, err := chartutil.ToRenderValues(chart, values, chartutil.ReleaseOptions{
+		Name:      release,
+		Namespace: namespace,
+		Revision:  1,
+		IsInstall: true,
+	}, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not merge values of chart %s: %w", chart.Name(), err)
+	}
+	files, err := engine.Render(chart, renderValues)
+	if err != nil {
+		return nil, fmt.Errorf("could not render chart %s: %w", chart.Name(), err)
+	}
+	for name := range files {
+		// the notes are shown to users of the helm CLI, they are no manifest
+		if strings.HasSuffix(name, "NOTES.txt") {
+			delete(files, name)
+		}
+	}
+
+	_, manifests, err := releaseutil.SortManifests(files, chartutil.DefaultVersionSet, releaseutil.InstallOrder)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse manifests of chart %s: %w", chart.Name(), err)
+	}
+
+	objects := make([]*unstructured.Unstructured, 0, len(manifests))
+	for _, manifest := range manifests {
+		object := map[string]interface{}{}
+		if err := yaml.Unmarshal([]byte(manifest.Content), &object); err != nil {
+			return nil, fmt.Errorf("could not parse %s of chart %s: %w", manifest.Name, chart.Name(), err)
+		}
+		if len(object) == 0 {
+			continue
+		}
+		objects = append(objects, &unstructured.Unstructured{Object: object})
+	}
+	return objects, nil
+}
+
+// ensureNamespace creates the namespace if it does not exist
+func ensureNamespace(ctx context.Context, client dynamic.Interface, namespace string) error {
+	_, err := client.Resource(namespaceResource).Get(ctx, namespace, metav1.GetOptions{})
+	if err == nil {
+		return nil
+	}
+	if !k8serrors.IsNotFound(err) {
+		return fmt.Errorf("could not get namespace %s: %w", namespace, err)
+	}
+
+	object := &unstructured.Unstructured{}
+	object.SetAPIVersion("v1")
+	object.SetKind("Namespace")
+	object.SetName(namespace)
+	object.SetLabels(map[string]string{managedByLabel: managedByValue})
+	_, err = client.Resource(namespaceResource).Create(ctx, object, metav1.CreateOptions{})
+	if err != nil && !k8serrors.IsAlreadyExists(err) {
+		return fmt.Errorf("could not create namespace %s: %w", namespace, err)
+	}
+	return nil
+}
+
+// applyObject creates the object or updates the existing object to match it, similar to kubectl apply.
+// Namespaced objects are applied to the given namespace, the mapper tells whether the kind of the object is namespaced.
+// The applied manifest is kept in the lastAppliedAnnotation, so that fields removed from the manifest are removed from the object
+// while fields set by others, e.g. by a horizontal pod autoscaler, are kept
+func applyObject(ctx context.Context, client dynamic.Interface, mapper meta.RESTMapper, namespace string, object *unstructured.Unstructured) error {
+	resources, err := objectResources(client, mapper, namespace, object)
+	if err != nil {
+		return err
+	}
+	setObjectLabel(object, managedByLabel, managedByValue)
+
+	modified, err := json.Marshal(object.Object)
+	if err != nil {
+		return fmt.Errorf("could not encode %s: %w", describeObject(object), err)
+	}
+	annotations := object.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[lastAppliedAnnotation] = string(modified)
+	object.SetAnnotations(annotations)
+
+	current, err := resources.Get(ctx, object.GetName(), metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		_, err = resources.Create(ctx, object, metav1.CreateOptions{})
+		if err != nil {
+			return fmt.Errorf("could not create %s: %w", describeObject(object), err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not get %s: %w", describeObject(object), err)
+	}
+
+	modified, err = json.Marshal(object.Object)
+	if err != nil {
+		return fmt.Errorf("could not encode %s: %w", describeObject(object), err)
+	}
+	currentJSON, err := json.Marshal(current.Object)
+	if err != nil {
+		return fmt.Errorf("could not encode %s: %w", describeObject(current), err)
+	}
+	// objects applied before the annotation was introduced have no original, no fields are removed from them
+	original := current.GetAnnotations()[lastAppliedAnnotation]
+	patch, err := jsonmergepatch.CreateThreeWayJSONMergePatch([]byte(original), modified, currentJSON)
+	if err != nil {
+		return fmt.Errorf("could not compute the changes of %s: %w", describeObject(object), err)
+	}
+	if _, err := resources.Patch(ctx, object.GetName(), types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+		return fmt.Errorf("could not update %s: %w", describeObject(object), err)
+	}
+	return nil
+}
+
+// objectResources returns the client for the resource of the object's kind.
+// The namespace of the object is set to the given namespace if the kind is namespaced and cleared otherwise
+func objectResources(client dynamic.Interface, mapper meta.RESTMapper, namespace string, object *unstructured.Unstructured) (dynamic.ResourceInterface, error) {
+	gvk := object.GroupVersionKind()
+	mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+	if err != nil {
+		return nil, fmt.Errorf("could not find the resource of %s: %w", describeObject(object), err)
+	}
+	if mapping.Scope.Name() != meta.RESTScopeNameNamespace {
+		object.SetNamespace("")
+		return client.Resource(mapping.Resource), nil
+	}
+	object.SetNamespace(namespace)
+	return client.Resource(mapping.Resource).Namespace(namespace), nil
+}
+
+// objectRef identifies an object in the inventory of the objects applied for a service
+type objectRef struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+func (r objectRef) object() *unstructured.Unstructured {
+	object := &unstructured.Unstructured{}
+	object.SetAPIVersion(r.APIVersion)
+	object.SetKind(r.Kind)
+	object.SetNamespace(r.Namespace)
+	object.SetName(r.Name)
+	return object
+}
+
+// inventoryName returns the name of the ConfigMap listing the objects applied for a service
+func inventoryName(service string) string {
+	return fmt.Sprintf("%s-%s", managedByValue, service)
+}
+
+// pruneObjects deletes the objects applied for the service before that are not among the given objects anymore
+// and records the given objects in the inventory of the service in the namespace, it returns the deleted objects.
+// Objects that are not labeled as managed by this service anymore are kept
+func pruneObjects(ctx context.Context, client dynamic.Interface, mapper meta.RESTMapper, namespace string, service string, objects []*unstructured.Unstructured) ([]string, error) {
+	name := inventoryName(service)
+	var previous []objectRef
+	inventory, err := client.Resource(configMapResource).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return nil, fmt.Errorf("could not get configmap %s: %w", name, err)
+	}
+	if err == nil {
+		data, _, _ := unstructured.NestedString(inventory.Object, "data", inventoryKey)
+		if err := json.Unmarshal([]byte(data), &previous); err != nil {
+			return nil, fmt.Errorf("could not parse configmap %s: %w", name, err)
+		}
+	}
+
+	applied := map[objectRef]bool{}
+	refs := make([]objectRef, 0, len(objects))
+	for _, object := range objects {
+		ref := objectRef{APIVersion: object.GetAPIVersion(), Kind: object.GetKind(), Namespace: object.GetNamespace(), Name: object.GetName()}
+		applied[ref] = true
+		refs = append(refs, ref)
+	}
+
+	var deleted []string
+	for _, ref := range previous {
+		if applied[ref] {
+			continue
+		}
+		object := ref.object()
+		ok, err := deleteObject(ctx, client, mapper, object)
+		if err != nil {
+			return deleted, err
+		}
+		if ok {
+			deleted = append(deleted, describeObject(object))
+		}
+	}
+
+	data, err := json.Marshal(refs)
+	if err != nil {
+		return deleted, fmt.Errorf("could not encode configmap %s: %w", name, err)
+	}
+	inventory = &unstructured.Unstructured{}
+	inventory.SetAPIVersion("v1")
+	inventory.SetKind("ConfigMap")
+	inventory.SetName(name)
+	if err := unstructured.SetNestedField(inventory.Object, string(data), "data", inventoryKey); err != nil {
+		return deleted, err
+	}
+	return deleted, applyObject(ctx, client, mapper, namespace, inventory)
+}
+
+// deleteObject deletes the object if it is still managed by this service, it reports whether the object was deleted
+func deleteObject(ctx context.Context, client dynamic.Interface, mapper meta.RESTMapper, object *unstructured.Unstructured) (bool, error) {
+	resources, err := objectResources(client, mapper, object.GetNamespace(), object)
+	if meta.IsNoMatchError(err) {
+		// the kind of the object does not exist anymore, e.g. because its custom resource definition was deleted
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	current, err := resources.Get(ctx, object.GetName(), metav1.GetOptions{})
+	if k8serrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not get %s: %w", describeObject(object), err)
+	}
+	if current.GetLabels()[managedByLabel] != managedByValue {
+		return false, nil
+	}
+
+	propagation := metav1.DeletePropagationBackground
+	err = resources.Delete(ctx, object.GetName(), metav1.DeleteOptions{PropagationPolicy: &propagation})
+	if err != nil && !k8serrors.IsNotFound(err) {
+		return false, fmt.Errorf("could not delete %s: %w", describeObject(object), err)
+	}
+	return err == nil, nil
+}
+
+// createObject creates the object in the given namespace unless it already exists, it reports whether the object was created
+func createObject(ctx context.Context, client dynamic.Interface, namespace string, object *unstructured.Unstructured) (bool, error) {
+	object.SetNamespace(namespace)
+	setObjectLabel(object, managedByLabel, managedByValue)
+
+	_, err := client.Resource(objectResource(object)).Namespace(namespace).Create(ctx, object, metav1.CreateOptions{})
+	if k8serrors.IsAlreadyExists(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("could not create %s: %w", describeObject(object), err)
+	}
+	return true, nil
+}
+
+// objectResource returns the resource of the object's kind, e.g. deployments for Deployment
+func objectResource(object *unstructured.Unstructured) schema.GroupVersionResource {
+	resource, _ := meta.UnsafeGuessKindToResource(object.GroupVersionKind())
+	return resource
+}
+
+// describeObject returns e.g. "deployment carts" for logs and messages
+func describeObject(object *unstructured.Unstructured) string {
+	return fmt.Sprintf("%s %s", strings.ToLower(object.GetKind()), object.GetName())
+}
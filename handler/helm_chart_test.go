@@ -0,0 +1,173 @@
+package handler
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"helm.sh/helm/v3/pkg/chart/loader"
+	"helm.sh/helm/v3/pkg/chartutil"
+	"io/ioutil"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	fakedynamic "k8s.io/client-go/dynamic/fake"
+	"testing"
+)
+
+// packageTestChart packages the chart in the given directory and returns the content of the archive
+func packageTestChart(t *testing.T, dir string) string {
+	chart, err := loader.LoadDir(dir)
+	require.NoError(t, err)
+	archive, err := chartutil.Save(chart, t.TempDir())
+	require.NoError(t, err)
+	content, err := ioutil.ReadFile(archive)
+	require.NoError(t, err)
+	return string(content)
+}
+
+func Test_renderChart(t *testing.T) {
+	archive := []byte(packageTestChart(t, "../test/charts/carts"))
+
+	tests := []struct {
+		name      string
+		values    map[string]interface{}
+		wantKinds []string
+		wantImage string
+	}{
+		{
+			name:      "default values",
+			wantKinds: []string{"Service", "Deployment", "Ingress"},
+			wantImage: "docker.io/keptnexamples/carts:0.13.1",
+		},
+		{
+			name:      "values of the configuration change",
+			values:    map[string]interface{}{"image": "docker.io/keptnexamples/carts:0.11.2", "ingress": map[string]interface{}{"host": ""}},
+			wantKinds: []string{"Service", "Deployment"},
+			wantImage: "docker.io/keptnexamples/carts:0.11.2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			objects, err := renderChart(archive, "carts", "sockshop-dev", tt.values)
+			require.NoError(t, err)
+
+			var kinds []string
+			for _, object := range objects {
+				kinds = append(kinds, object.GetKind())
+				require.Equal(t, "carts", object.GetName())
+				if object.GetKind() == "Deployment" {
+					containers, _, err := unstructured.NestedSlice(object.Object, "spec", "template", "spec", "containers")
+					require.NoError(t, err)
+					require.Equal(t, tt.wantImage, containers[0].(map[string]interface{})["image"])
+				}
+			}
+			require.Equal(t, tt.wantKinds, kinds)
+		})
+	}
+}
+
+func Test_renderChart_InvalidArchive(t *testing.T) {
+	_, err := renderChart([]byte("no chart"), "carts", "sockshop-dev", nil)
+	require.ErrorContains(t, err, "could not load chart")
+}
+
+func Test_applyObject(t *testing.T) {
+	ctx := context.Background()
+	client := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme())
+	require.NoError(t, ensureNamespace(ctx, client, "sockshop-dev"))
+	require.NoError(t, ensureNamespace(ctx, client, "sockshop-dev"))
+
+	configMap := func(data map[string]interface{}) *unstructured.Unstructured {
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"apiVersion": "v1",
+			"kind":       "ConfigMap",
+			"metadata":   map[string]interface{}{"name": "carts"},
+			"data":       data,
+		}}
+	}
+	resources := client.Resource(configMapResource).Namespace("sockshop-dev")
+	require.NoError(t, applyObject(ctx, client, defaultRESTMapper(), "sockshop-dev", configMap(map[string]interface{}{"a": "1", "b": "2"})))
+	// fields set by others are kept
+	_, err := resources.Patch(ctx, "carts", types.MergePatchType, []byte(`{"data":{"c":"4"}}`), metav1.PatchOptions{})
+	require.NoError(t, err)
+	require.NoError(t, applyObject(ctx, client, defaultRESTMapper(), "sockshop-dev", configMap(map[string]interface{}{"a": "3"})))
+
+	object, err := resources.Get(ctx, "carts", metav1.GetOptions{})
+	require.NoError(t, err)
+	data, _, err := unstructured.NestedStringMap(object.Object, "data")
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"a": "3", "c": "4"}, data)
+	require.Equal(t, managedByValue, object.GetLabels()[managedByLabel])
+
+	_, err = client.Resource(namespaceResource).Get(ctx, "sockshop-dev", metav1.GetOptions{})
+	require.NoError(t, err)
+}
+
+func Test_applyObject_ClusterScoped(t *testing.T) {
+	ctx := context.Background()
+	client := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme())
+
+	clusterRole := &unstructured.Unstructured{}
+	clusterRole.SetAPIVersion("rbac.authorization.k8s.io/v1")
+	clusterRole.SetKind("ClusterRole")
+	clusterRole.SetName("carts")
+	clusterRole.SetNamespace("sockshop-dev")
+	require.NoError(t, applyObject(ctx, client, defaultRESTMapper(), "sockshop-dev", clusterRole))
+
+	resource := schema.GroupVersionResource{Group: "rbac.authorization.k8s.io", Version: "v1", Resource: "clusterroles"}
+	object, err := client.Resource(resource).Get(ctx, "carts", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Empty(t, object.GetNamespace())
+
+	unknown := &unstructured.Unstructured{}
+	unknown.SetAPIVersion("example.com/v1")
+	unknown.SetKind("Widget")
+	unknown.SetName("carts")
+	require.ErrorContains(t, applyObject(ctx, client, defaultRESTMapper(), "sockshop-dev", unknown), "could not find the resource of widget carts")
+}
+
+func Test_pruneObjects(t *testing.T) {
+	ctx := context.Background()
+	client := fakedynamic.NewSimpleDynamicClient(runtime.NewScheme())
+	mapper := defaultRESTMapper()
+
+	configMap := func(name string) *unstructured.Unstructured {
+		object := &unstructured.Unstructured{}
+		object.SetAPIVersion("v1")
+		object.SetKind("ConfigMap")
+		object.SetName(name)
+		return object
+	}
+	apply := func(names ...string) []string {
+		var objects []*unstructured.Unstructured
+		for _, name := range names {
+			object := configMap(name)
+			require.NoError(t, applyObject(ctx, client, mapper, "sockshop-dev", object))
+			objects = append(objects, object)
+		}
+		deleted, err := pruneObjects(ctx, client, mapper, "sockshop-dev", "carts", objects)
+		require.NoError(t, err)
+		return deleted
+	}
+	resources := client.Resource(configMapResource).Namespace("sockshop-dev")
+
+	require.Empty(t, apply("carts-a", "carts-b", "carts-c"))
+	// an object not managed by this service anymore is kept
+	_, err := resources.Patch(ctx, "carts-c", types.MergePatchType, []byte(`{"metadata":{"labels":{"app.kubernetes.io/managed-by":"Helm"}}}`), metav1.PatchOptions{})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"configmap carts-b"}, apply("carts-a"))
+	_, err = resources.Get(ctx, "carts-a", metav1.GetOptions{})
+	require.NoError(t, err)
+	_, err = resources.Get(ctx, "carts-b", metav1.GetOptions{})
+	require.True(t, k8serrors.IsNotFound(err))
+	_, err = resources.Get(ctx, "carts-c", metav1.GetOptions{})
+	require.NoError(t, err)
+
+	inventory, err := resources.Get(ctx, inventoryName("carts"), metav1.GetOptions{})
+	require.NoError(t, err)
+	data, _, _ := unstructured.NestedString(inventory.Object, "data", inventoryKey)
+	require.JSONEq(t, `[{"apiVersion":"v1","kind":"ConfigMap","namespace":"sockshop-dev","name":"carts-a"}]`, data)
+}
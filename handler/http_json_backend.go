@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// maxHTTPJSONResponseSize limits the size of the JSON documents read by the HTTPJSONBackend
+const maxHTTPJSONResponseSize = 10 << 20
+
+// HTTPJSONBackend retrieves SLI values from arbitrary JSON REST endpoints.
+// Each indicator in sli.yaml defines the request to send and the JSONPath of the value within the response, e.g.:
+//
+//	open_tickets:
+//	  method: GET
+//	  url: "https://tickets.example.com/api/stats?service=$SERVICE"
+//	  headers:
+//	    Accept: application/json
+//	  jsonPath: "$.data.open"
+//
+// Credentials providing a user and password or a token are used unless the indicator sets an Authorization header.
+// As sli.yaml may send requests to any URL, they are only sent to URLs below the url of the credentials
+type HTTPJSONBackend struct {
+	httpClient *http.Client
+}
+
+// NewHTTPJSONBackend creates a new HTTPJSONBackend sending its requests using the given client
+func NewHTTPJSONBackend(httpClient *http.Client) *HTTPJSONBackend {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &HTTPJSONBackend{
+		httpClient: httpClient,
+	}
+}
+
+// GetSLIValue sends the HTTP request defined for the indicator and extracts the value from the JSON response
+func (b *HTTPJSONBackend) GetSLIValue(ctx context.Context, query SLIQuery) (float64, error) {
+	definition := query.Definition
+	if !definition.IsHTTPRequest() {
+		return 0, errors.New("indicator does not define a url")
+	}
+
+	method := strings.ToUpper(definition.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, definition.URL, strings.NewReader(definition.Body))
+	if err != nil {
+		return 0, fmt.Errorf("could not create request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	for name, value := range definition.Headers {
+		req.Header.Set(name, value)
+	}
+	credentialsWithheld := false
+	if len(query.Credentials) > 0 {
+		if query.Credentials.allowURL(req.URL) {
+			query.Credentials.applyTo(req)
+		} else {
+			credentialsWithheld = true
+		}
+	}
+
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("could not send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxHTTPJSONResponseSize))
+	if err != nil {
+		return 0, fmt.Errorf("could not read response: %w", err)
+	}
+
+	if (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) && credentialsWithheld {
+		return 0, fmt.Errorf("request failed with status code %d, credentials are only sent to URLs below their url %q", resp.StatusCode, query.Credentials[CredentialsKeyURL])
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return 0, fmt.Errorf("request failed with status code %d: %s", resp.StatusCode, truncate(string(body), 200))
+	}
+
+	return extractJSONNumber(body, definition.JSONPath)
+}
+
+// truncate shortens the given string to at most maxLength bytes
+func truncate(s string, maxLength int) string {
+	if len(s) <= maxLength {
+		return s
+	}
+	return s[:maxLength] + "..."
+}
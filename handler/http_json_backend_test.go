@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"context"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/sdk"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_HTTPJSONBackend_GetSLIValue(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/stats":
+			require.Equal(t, http.MethodPost, r.Method)
+			require.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+			body, _ := ioutil.ReadAll(r.Body)
+			require.Equal(t, `{"service": "carts"}`, string(body))
+			w.Write([]byte(`{"data": {"open": 7}}`))
+		case "/api/broken":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`internal error`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer ts.Close()
+
+	backend := NewHTTPJSONBackend(ts.Client())
+
+	value, err := backend.GetSLIValue(context.Background(), SLIQuery{
+		Indicator: "open_tickets",
+		Definition: SLIIndicator{
+			Method:   "post",
+			URL:      ts.URL + "/api/stats",
+			Headers:  map[string]string{"Authorization": "Bearer secret"},
+			Body:     `{"service": "carts"}`,
+			JSONPath: "$.data.open",
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, float64(7), value)
+
+	_, err = backend.GetSLIValue(context.Background(), SLIQuery{
+		Indicator:  "broken",
+		Definition: SLIIndicator{URL: ts.URL + "/api/broken", JSONPath: "$.open"},
+	})
+	require.EqualError(t, err, "request failed with status code 500: internal error")
+
+	_, err = backend.GetSLIValue(context.Background(), SLIQuery{
+		Indicator:  "throughput",
+		Query:      "sum(rate(http_requests_total[5m]))",
+		Definition: SLIIndicator{Query: "sum(rate(http_requests_total[5m]))"},
+	})
+	require.EqualError(t, err, "indicator does not define a url")
+}
+
+func Test_HTTPJSONBackend_Credentials(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(`{"open": 7}`))
+	}))
+	defer ts.Close()
+
+	backend := NewHTTPJSONBackend(ts.Client())
+	query := func(credentialsURL string) SLIQuery {
+		return SLIQuery{
+			Indicator:   "open_tickets",
+			Definition:  SLIIndicator{URL: ts.URL + "/api/stats", JSONPath: "$.open"},
+			Credentials: Credentials{"url": credentialsURL, "token": "secret"},
+		}
+	}
+
+	value, err := backend.GetSLIValue(context.Background(), query(ts.URL+"/api"))
+	require.NoError(t, err)
+	require.Equal(t, float64(7), value)
+
+	// credentials of another host, e.g. the global secret of the sliProvider, are not sent to the URL of sli.yaml
+	_, err = backend.GetSLIValue(context.Background(), query("https://tickets.example.com"))
+	require.EqualError(t, err, `request failed with status code 401, credentials are only sent to URLs below their url "https://tickets.example.com"`)
+}
+
+func Test_Receiving_GetSliTriggeredEvent_HTTPJSONBackend(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/stats/user-managed/dev/nginx", r.URL.Path)
+		w.Write([]byte(`{"p95": "0.42", "other": 17}`))
+	}))
+	defer ts.Close()
+
+	fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+	fakeKeptn.SetResourceHandler(sdk.StringResourceHandler{ResourceContent: `---
+spec_version: '1.0'
+indicators:
+  response_time_p95:
+    url: "` + ts.URL + `/stats/$PROJECT/$STAGE/$SERVICE"
+    jsonPath: "$.p95"
+  some_other_metric:
+    url: "` + ts.URL + `/stats/$PROJECT/$STAGE/$SERVICE"
+    jsonPath: "$.other"
+`})
+	fakeKeptn.AddTaskHandler("sh.keptn.event.get-sli.triggered", NewGetSliEventHandler(
+		withTestSLIBackend(NewHTTPJSONBackend(ts.Client()))))
+
+	fakeKeptn.NewEvent(newEvent("../test/events/get_sli_triggered.json"))
+
+	fakeKeptn.AssertNumberOfEventSent(t, 2)
+	fakeKeptn.AssertSentEventResult(t, 1, keptnv2.ResultPass)
+
+	finishedEventData := getSliFinishedEventData(t, fakeKeptn.SentEvents[1])
+	require.Equal(t, []*keptnv2.SLIResult{
+		{Metric: "response_time_p95", Value: 0.42, Success: true},
+		{Metric: "some_other_metric", Value: 17, Success: true},
+	}, finishedEventData.GetSLI.IndicatorValues)
+}
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// jsonPathSegment is a single step of a JSONPath expression, either a member name or an array index
+type jsonPathSegment struct {
+	name    string
+	index   int
+	isIndex bool
+}
+
+// jsonPath is a parsed JSONPath expression.
+// Supported is the subset needed to address a single value: $ for the root, .name and ['name'] for object members
+// and [n] for array elements, where negative indexes count from the end of the array
+type jsonPath []jsonPathSegment
+
+// parseJSONPath parses the given JSONPath expression
+func parseJSONPath(expression string) (jsonPath, error) {
+	if !strings.HasPrefix(expression, "$") {
+		return nil, errors.New("expression must start with $")
+	}
+
+	var path jsonPath
+	rest := expression[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := 1
+			for end < len(rest) && rest[end] != '.' && rest[end] != '[' {
+				end++
+			}
+			name := rest[1:end]
+			if name == "" {
+				return nil, fmt.Errorf("empty member name in %s", expression)
+			}
+			path = append(path, jsonPathSegment{name: name})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated bracket in %s", expression)
+			}
+			segment, err := parseJSONPathBracket(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid bracket in %s: %w", expression, err)
+			}
+			path = append(path, segment)
+			rest = rest[end+1:]
+		default:
+			return nil, fmt.Errorf("unexpected character %q in %s", rest[0], expression)
+		}
+	}
+
+	return path, nil
+}
+
+func parseJSONPathBracket(content string) (jsonPathSegment, error) {
+	if len(content) >= 2 && (content[0] == '\'' || content[0] == '"') && content[len(content)-1] == content[0] {
+		return jsonPathSegment{name: content[1 : len(content)-1]}, nil
+	}
+
+	index, err := strconv.Atoi(content)
+	if err != nil {
+		return jsonPathSegment{}, fmt.Errorf("%q is neither a quoted member name nor an array index", content)
+	}
+	return jsonPathSegment{index: index, isIndex: true}, nil
+}
+
+// extract returns the value the path points to within the given document
+func (p jsonPath) extract(document interface{}) (interface{}, error) {
+	current := document
+	for _, segment := range p {
+		if segment.isIndex {
+			array, ok := current.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("cannot access index %d of a non-array value", segment.index)
+			}
+			index := segment.index
+			if index < 0 {
+				index += len(array)
+			}
+			if index < 0 || index >= len(array) {
+				return nil, fmt.Errorf("index %d out of range for array of length %d", segment.index, len(array))
+			}
+			current = array[index]
+			continue
+		}
+
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot access member %s of a non-object value", segment.name)
+		}
+		current, ok = object[segment.name]
+		if !ok {
+			return nil, fmt.Errorf("member %s not found", segment.name)
+		}
+	}
+	return current, nil
+}
+
+// extractJSONNumber evaluates the JSONPath expression on the given JSON document and returns the number it points to.
+// Numbers encoded as strings are accepted as well
+func extractJSONNumber(document []byte, expression string) (float64, error) {
+	path, err := parseJSONPath(expression)
+	if err != nil {
+		return 0, err
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(string(document)))
+	decoder.UseNumber()
+	var parsed interface{}
+	if err := decoder.Decode(&parsed); err != nil {
+		return 0, fmt.Errorf("could not parse JSON document: %w", err)
+	}
+
+	value, err := path.extract(parsed)
+	if err != nil {
+		return 0, fmt.Errorf("could not evaluate %s: %w", expression, err)
+	}
+
+	switch v := value.(type) {
+	case json.Number:
+		return v.Float64()
+	case string:
+		number, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, fmt.Errorf("value %q at %s is not a number", v, expression)
+		}
+		return number, nil
+	default:
+		return 0, fmt.Errorf("value at %s is not a number: %v", expression, value)
+	}
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func Test_extractJSONNumber(t *testing.T) {
+	document := []byte(`{
+  "data": {
+    "open": 12,
+    "ratio": "0.75",
+    "name": "carts",
+    "series": [{"value": 1.5}, {"value": 2.5}],
+    "odd key": 3
+  }
+}`)
+
+	tests := []struct {
+		name       string
+		expression string
+		want       float64
+		wantErr    string
+	}{
+		{name: "member", expression: "$.data.open", want: 12},
+		{name: "numeric string", expression: "$.data.ratio", want: 0.75},
+		{name: "array index", expression: "$.data.series[0].value", want: 1.5},
+		{name: "negative array index", expression: "$.data.series[-1].value", want: 2.5},
+		{name: "bracket member", expression: "$['data']['odd key']", want: 3},
+		{name: "not a number", expression: "$.data.name", wantErr: `value "carts" at $.data.name is not a number`},
+		{name: "object", expression: "$.data", wantErr: "value at $.data is not a number"},
+		{name: "missing member", expression: "$.data.closed", wantErr: "member closed not found"},
+		{name: "index out of range", expression: "$.data.series[2]", wantErr: "index 2 out of range for array of length 2"},
+		{name: "index on object", expression: "$.data[0]", wantErr: "cannot access index 0 of a non-array value"},
+		{name: "missing root", expression: "data.open", wantErr: "expression must start with $"},
+		{name: "unterminated bracket", expression: "$.data[0", wantErr: "unterminated bracket"},
+		{name: "invalid bracket", expression: "$.data[*]", wantErr: `"*" is neither a quoted member name nor an array index`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extractJSONNumber(document, tt.expression)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_extractJSONNumber_InvalidDocument(t *testing.T) {
+	_, err := extractJSONNumber([]byte(`<html></html>`), "$.open")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "could not parse JSON document")
+}
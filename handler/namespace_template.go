@@ -0,0 +1,52 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"strings"
+	"text/template"
+)
+
+// DefaultNamespaceTemplate is the namespace Keptn deploys the services of a stage to
+const DefaultNamespaceTemplate = "{{.Project}}-{{.Stage}}"
+
+// NamespaceTemplate determines the Kubernetes namespace of a service from the data of an event, e.g. {{.Project}}-{{.Stage}}.
+// The fields Project, Stage, Service and Labels of the event can be used
+type NamespaceTemplate struct {
+	text     string
+	template *template.Template
+}
+
+// ParseNamespaceTemplate parses the given Go template
+func ParseNamespaceTemplate(text string) (*NamespaceTemplate, error) {
+	tmpl, err := template.New("namespace").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse namespace template %q: %w", text, err)
+	}
+	return &NamespaceTemplate{text: text, template: tmpl}, nil
+}
+
+// defaultNamespaceTemplate returns the parsed DefaultNamespaceTemplate
+func defaultNamespaceTemplate() *NamespaceTemplate {
+	tmpl, err := ParseNamespaceTemplate(DefaultNamespaceTemplate)
+	if err != nil {
+		panic(err)
+	}
+	return tmpl
+}
+
+// Namespace returns the namespace for the given event
+func (t *NamespaceTemplate) Namespace(eventData keptnv2.EventData) (string, error) {
+	buf := bytes.Buffer{}
+	if err := t.template.Execute(&buf, eventData); err != nil {
+		return "", fmt.Errorf("could not render namespace template %q: %w", t.text, err)
+	}
+
+	namespace := buf.String()
+	if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+		return "", fmt.Errorf("invalid namespace %q: %s", namespace, strings.Join(errs, ", "))
+	}
+	return namespace, nil
+}
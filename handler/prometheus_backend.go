@@ -0,0 +1,171 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const prometheusQueryRangePath = "/api/v1/query_range"
+
+// prometheusRangeSamples is the number of samples a query is evaluated at within the time window
+const prometheusRangeSamples = 60
+
+// maxPrometheusResponseSize limits the size of the responses read by the PrometheusBackend
+const maxPrometheusResponseSize = 10 << 20
+
+// PrometheusBackend evaluates SLI queries against a Prometheus compatible HTTP query API.
+// Credentials may override the url and provide a user and password or a token
+type PrometheusBackend struct {
+	url        string
+	httpClient *http.Client
+}
+
+// NewPrometheusBackend creates a new PrometheusBackend for the Prometheus API reachable at the given url.
+// The url may be empty if the credentials of every project provide it
+func NewPrometheusBackend(url string, httpClient *http.Client) *PrometheusBackend {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	return &PrometheusBackend{
+		url:        strings.TrimSuffix(url, "/"),
+		httpClient: httpClient,
+	}
+}
+
+// prometheusResponse is the envelope returned by the Prometheus HTTP API
+type prometheusResponse struct {
+	Status    string         `json:"status"`
+	ErrorType string         `json:"errorType"`
+	Error     string         `json:"error"`
+	Data      prometheusData `json:"data"`
+}
+
+type prometheusData struct {
+	ResultType string          `json:"resultType"`
+	Result     json.RawMessage `json:"result"`
+}
+
+type prometheusSeries struct {
+	Metric map[string]string `json:"metric"`
+	Values [][]interface{}   `json:"values"`
+}
+
+// GetSLIValue evaluates the query at evenly spaced steps over the time window and returns the average of the values.
+// The query must result in a single series
+func (p *PrometheusBackend) GetSLIValue(ctx context.Context, query SLIQuery) (float64, error) {
+	if query.Query == "" {
+		return 0, errors.New("indicator does not define a query")
+	}
+
+	start := query.Start
+	if start.After(query.End) {
+		start = query.End
+	}
+	step := query.End.Sub(start) / prometheusRangeSamples
+	if step < time.Second {
+		step = time.Second
+	}
+
+	params := url.Values{}
+	params.Set("query", query.Query)
+	params.Set("start", strconv.FormatInt(start.Unix(), 10))
+	params.Set("end", strconv.FormatInt(query.End.Unix(), 10))
+	params.Set("step", strconv.FormatFloat(step.Seconds(), 'f', -1, 64))
+
+	baseURL := p.url
+	if credentialsURL := query.Credentials[CredentialsKeyURL]; credentialsURL != "" {
+		baseURL = strings.TrimSuffix(credentialsURL, "/")
+	}
+	if baseURL == "" {
+		return 0, errors.New("no Prometheus URL configured, set PROMETHEUS_URL or the url of the credentials")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, baseURL+prometheusQueryRangePath+"?"+params.Encode(), nil)
+	if err != nil {
+		return 0, fmt.Errorf("could not create Prometheus request: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	query.Credentials.applyTo(req)
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("could not query Prometheus: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxPrometheusResponseSize))
+	if err != nil {
+		return 0, fmt.Errorf("could not read Prometheus response: %w", err)
+	}
+
+	response := &prometheusResponse{}
+	if err := json.Unmarshal(body, response); err != nil {
+		return 0, fmt.Errorf("could not parse Prometheus response (status code %d): %w", resp.StatusCode, err)
+	}
+
+	if response.Status != "success" {
+		return 0, fmt.Errorf("query failed with status code %d: %s: %s", resp.StatusCode, response.ErrorType, response.Error)
+	}
+
+	return response.Data.average()
+}
+
+// average returns the average of the values of the single series of a range query result, ignoring NaN and infinite values
+func (d prometheusData) average() (float64, error) {
+	if d.ResultType != "matrix" {
+		return 0, fmt.Errorf("unsupported result type %q, expected matrix", d.ResultType)
+	}
+	var series []prometheusSeries
+	if err := json.Unmarshal(d.Result, &series); err != nil {
+		return 0, fmt.Errorf("could not parse matrix result: %w", err)
+	}
+	if len(series) == 0 {
+		return 0, fmt.Errorf("query returned no result")
+	}
+	if len(series) > 1 {
+		return 0, fmt.Errorf("query returned %d series, expected exactly one", len(series))
+	}
+
+	var sum float64
+	var count int
+	var invalid string
+	for _, value := range series[0].Values {
+		// a sample is encoded as [<unix timestamp>, "<value>"]
+		if len(value) != 2 {
+			return 0, fmt.Errorf("unexpected sample format %v", value)
+		}
+		valueString, ok := value[1].(string)
+		if !ok {
+			return 0, fmt.Errorf("unexpected sample value %v", value[1])
+		}
+
+		result, err := strconv.ParseFloat(valueString, 64)
+		if err != nil {
+			return 0, fmt.Errorf("could not parse sample value %s: %w", valueString, err)
+		}
+		if math.IsNaN(result) || math.IsInf(result, 0) {
+			invalid = valueString
+			continue
+		}
+		sum += result
+		count++
+	}
+
+	if count == 0 {
+		if invalid != "" {
+			return 0, fmt.Errorf("query returned non-numeric value %s", invalid)
+		}
+		return 0, fmt.Errorf("query returned no result")
+	}
+	return sum / float64(count), nil
+}
@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newPrometheusTestServer returns a stand-in for the Prometheus query API which answers each query with the given response body
+func newPrometheusTestServer(t *testing.T, responses map[string]string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, prometheusQueryRangePath, r.URL.Path)
+
+		w.Header().Add("Content-Type", "application/json")
+		response, ok := responses[r.URL.Query().Get("query")]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"status":"error","errorType":"bad_data","error":"unknown query"}`))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(response))
+	}))
+}
+
+// prometheusMatrixResponse returns a range query result with a single series whose samples all have the given value
+func prometheusMatrixResponse(value string) string {
+	return fmt.Sprintf(`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"values":[[1610723085,"%s"],[1610723385,"%s"]]}]}}`, value, value)
+}
+
+func Test_PrometheusBackend_Query(t *testing.T) {
+	start := time.Date(2021, 1, 15, 15, 4, 45, 0, time.UTC)
+	end := time.Date(2021, 1, 15, 15, 9, 45, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		query     string
+		response  string
+		wantValue float64
+		wantErr   string
+	}{
+		{
+			name:      "single series",
+			query:     "sum(rate(http_requests_total[5m]))",
+			response:  prometheusMatrixResponse("42.5"),
+			wantValue: 42.5,
+		},
+		{
+			name:      "average of the samples",
+			query:     "sum(rate(http_requests_total[1m]))",
+			response:  `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{},"values":[[1610723085,"1"],[1610723235,"NaN"],[1610723385,"2"]]}]}}`,
+			wantValue: 1.5,
+		},
+		{
+			name:     "empty matrix",
+			query:    "up{job=\"none\"}",
+			response: `{"status":"success","data":{"resultType":"matrix","result":[]}}`,
+			wantErr:  "query returned no result",
+		},
+		{
+			name:     "multiple series",
+			query:    "up",
+			response: `{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"job":"a"},"values":[[1610723385,"1"]]},{"metric":{"job":"b"},"values":[[1610723385,"1"]]}]}}`,
+			wantErr:  "query returned 2 series, expected exactly one",
+		},
+		{
+			name:     "vector result",
+			query:    "up[5m]",
+			response: `{"status":"success","data":{"resultType":"vector","result":[]}}`,
+			wantErr:  `unsupported result type "vector"`,
+		},
+		{
+			name:     "NaN value",
+			query:    "0/0",
+			response: prometheusMatrixResponse("NaN"),
+			wantErr:  "query returned non-numeric value NaN",
+		},
+		{
+			name:    "query error",
+			query:   "invalid(",
+			wantErr: "query failed with status code 400: bad_data: unknown query",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responses := map[string]string{}
+			if tt.response != "" {
+				responses[tt.query] = tt.response
+			}
+			ts := newPrometheusTestServer(t, responses)
+			defer ts.Close()
+
+			backend := NewPrometheusBackend(ts.URL, ts.Client())
+			value, err := backend.GetSLIValue(context.Background(), SLIQuery{Query: tt.query, Start: start, End: end})
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantValue, value)
+		})
+	}
+}
+
+func Test_PrometheusBackend_Query_UsesTimeWindow(t *testing.T) {
+	end := time.Date(2021, 1, 15, 15, 9, 45, 0, time.UTC)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, fmt.Sprint(end.Add(-5*time.Minute).Unix()), r.URL.Query().Get("start"))
+		require.Equal(t, fmt.Sprint(end.Unix()), r.URL.Query().Get("end"))
+		require.Equal(t, "5", r.URL.Query().Get("step"))
+		w.Write([]byte(prometheusMatrixResponse("1")))
+	}))
+	defer ts.Close()
+
+	_, err := NewPrometheusBackend(ts.URL+"/", nil).GetSLIValue(context.Background(), SLIQuery{Query: "up", Start: end.Add(-5 * time.Minute), End: end})
+	require.NoError(t, err)
+}
+
+func Test_PrometheusBackend_Query_LimitsResponseSize(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"success","data":{"resultType":"matrix","result":[{"metric":{"padding":"`))
+		w.Write([]byte(strings.Repeat("x", maxPrometheusResponseSize)))
+		w.Write([]byte(`"},"values":[[1610723385,"1"]]}]}}`))
+	}))
+	defer ts.Close()
+
+	_, err := NewPrometheusBackend(ts.URL, nil).GetSLIValue(context.Background(), SLIQuery{Query: "up"})
+	require.ErrorContains(t, err, "could not parse Prometheus response")
+}
+
+func Test_PrometheusBackend_GetSLIValue_UsesCredentials(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "admin" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte(prometheusMatrixResponse("1")))
+	}))
+	defer ts.Close()
+
+	// the url configured for the backend is overridden by the credentials
+	backend := NewPrometheusBackend("http://localhost:1", ts.Client())
+	value, err := backend.GetSLIValue(context.Background(), SLIQuery{
+		Query:       "up",
+		Credentials: Credentials{"url": ts.URL, "user": "admin", "password": "secret"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, float64(1), value)
+}
+
+func Test_PrometheusBackend_GetSLIValue_NoURL(t *testing.T) {
+	_, err := NewPrometheusBackend("", nil).GetSLIValue(context.Background(), SLIQuery{Query: "up"})
+
+	require.EqualError(t, err, "no Prometheus URL configured, set PROMETHEUS_URL or the url of the credentials")
+}
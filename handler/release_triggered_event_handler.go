@@ -0,0 +1,147 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/sdk"
+	"k8s.io/client-go/dynamic"
+	"strings"
+	"time"
+)
+
+// ReleaseTriggeredEventHandler completes deployments of the blue_green_service and canary strategies.
+// Depending on the result of the sequence carried in the event, usually the result of the evaluation,
+// the canary of the service is promoted to its primary track or rolled back. All traffic is routed to the primary afterwards
+type ReleaseTriggeredEventHandler struct {
+	client         dynamic.Interface
+	namespace      *NamespaceTemplate
+	ctx            context.Context
+	rolloutTimeout time.Duration
+	pollInterval   time.Duration
+}
+
+// ReleaseTriggeredEventHandlerOption can be used to configure the ReleaseTriggeredEventHandler
+type ReleaseTriggeredEventHandlerOption func(*ReleaseTriggeredEventHandler)
+
+// WithReleaseNamespaceTemplate configures the namespace the service was deployed to, the default is {{.Project}}-{{.Stage}}
+func WithReleaseNamespaceTemplate(namespace *NamespaceTemplate) ReleaseTriggeredEventHandlerOption {
+	return func(r *ReleaseTriggeredEventHandler) {
+		r.namespace = namespace
+	}
+}
+
+// WithReleaseShutdownContext configures a context that is cancelled when the service shuts down.
+// A release in progress is cancelled and reported as errored when it is done
+func WithReleaseShutdownContext(ctx context.Context) ReleaseTriggeredEventHandlerOption {
+	return func(r *ReleaseTriggeredEventHandler) {
+		r.ctx = ctx
+	}
+}
+
+// WithReleaseRolloutTimeout configures how long to wait for the rollout of the primary workloads before the release fails
+func WithReleaseRolloutTimeout(timeout time.Duration) ReleaseTriggeredEventHandlerOption {
+	return func(r *ReleaseTriggeredEventHandler) {
+		if timeout > 0 {
+			r.rolloutTimeout = timeout
+		}
+	}
+}
+
+// NewReleaseTriggeredEventHandler creates a new ReleaseTriggeredEventHandler updating workloads using the given client
+func NewReleaseTriggeredEventHandler(client dynamic.Interface, opts ...ReleaseTriggeredEventHandlerOption) *ReleaseTriggeredEventHandler {
+	handler := &ReleaseTriggeredEventHandler{
+		client:         client,
+		namespace:      defaultNamespaceTemplate(),
+		ctx:            context.Background(),
+		rolloutTimeout: defaultRolloutTimeout,
+		pollInterval:   defaultRolloutPollInterval,
+	}
+	for _, opt := range opts {
+		opt(handler)
+	}
+	return handler
+}
+
+// Execute promotes the canary of the service unless the result of the event is fail, in which case the canary is rolled back.
+// Deployments of other strategies need no release
+func (r *ReleaseTriggeredEventHandler) Execute(k sdk.IKeptn, event sdk.KeptnEvent) (interface{}, *sdk.Error) {
+	k.Logger().Infof("Handling release.triggered Event: %s", event.ID)
+	releaseTriggeredEvent := &keptnv2.ReleaseTriggeredEventData{}
+
+	if err := keptnv2.Decode(event.Data, releaseTriggeredEvent); err != nil {
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: "failed to decode release.triggered event: " + err.Error()}
+	}
+
+	strategy := releaseTriggeredEvent.Deployment.DeploymentStrategy
+	rollback := releaseTriggeredEvent.Result == keptnv2.ResultFailed
+	if !isTrackedStrategy(strategy) {
+		if rollback {
+			message := fmt.Sprintf("the result of the sequence is %s, but deployment strategy %s keeps no previous version to roll back to", releaseTriggeredEvent.Result, strategy)
+			return getReleaseFinishedEvent(keptnv2.ResultFailed, keptnv2.StatusSucceeded, *releaseTriggeredEvent, message), nil
+		}
+		message := fmt.Sprintf("nothing to release for deployment strategy %s", strategy)
+		return getReleaseFinishedEvent(keptnv2.ResultPass, keptnv2.StatusSucceeded, *releaseTriggeredEvent, message), nil
+	}
+
+	namespace, err := r.namespace.Namespace(releaseTriggeredEvent.EventData)
+	if err != nil {
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+	}
+
+	ctx := r.ctx
+	if rollback {
+		k.Logger().Infof("Rolling back the canary of %s as the result of the sequence is %s", releaseTriggeredEvent.Service, releaseTriggeredEvent.Result)
+		primaries, err := rollbackCanary(ctx, r.client, namespace, releaseTriggeredEvent.Service)
+		if err != nil {
+			err = fmt.Errorf("could not roll back %s: %w", releaseTriggeredEvent.Service, err)
+			return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+		}
+		// the release did not happen, so the sequence keeps failing
+		message := fmt.Sprintf("rolled back %s in namespace %s as the result of the sequence is %s, %s serves all traffic",
+			releaseTriggeredEvent.Service, namespace, releaseTriggeredEvent.Result, strings.Join(primaries, ", "))
+		return getReleaseFinishedEvent(keptnv2.ResultFailed, keptnv2.StatusSucceeded, *releaseTriggeredEvent, message), nil
+	}
+
+	k.Logger().Infof("Promoting the canary of %s as the result of the sequence is %s", releaseTriggeredEvent.Service, releaseTriggeredEvent.Result)
+	var rolloutFailure string
+	promoted, err := promoteCanary(ctx, r.client, namespace, releaseTriggeredEvent.Service, func(workload *appliedWorkload) error {
+		status, err := waitForRollout(ctx, k, workload, r.rolloutTimeout, r.pollInterval)
+		if errors.Is(err, errRolloutFailed) {
+			rolloutFailure = fmt.Sprintf("rollout of %s failed: %s", workload, status)
+		} else if err != nil && ctx.Err() == nil {
+			rolloutFailure = fmt.Sprintf("rollout of %s did not complete within %s: %s", workload, r.rolloutTimeout, status)
+		}
+		return err
+	})
+	if rolloutFailure != "" {
+		return getReleaseFinishedEvent(keptnv2.ResultFailed, keptnv2.StatusSucceeded, *releaseTriggeredEvent, rolloutFailure), nil
+	}
+	if err != nil && ctx.Err() != nil {
+		err = fmt.Errorf("release of %s was cancelled because the service is shutting down: %w", releaseTriggeredEvent.Service, err)
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+	}
+	if err != nil {
+		err = fmt.Errorf("could not promote %s: %w", releaseTriggeredEvent.Service, err)
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+	}
+
+	message := fmt.Sprintf("promoted %s to %s in namespace %s", releaseTriggeredEvent.Service, strings.Join(promoted, ", "), namespace)
+	return getReleaseFinishedEvent(keptnv2.ResultPass, keptnv2.StatusSucceeded, *releaseTriggeredEvent, message), nil
+}
+
+func getReleaseFinishedEvent(result keptnv2.ResultType, status keptnv2.StatusType, releaseTriggeredEvent keptnv2.ReleaseTriggeredEventData, message string) keptnv2.ReleaseFinishedEventData {
+
+	return keptnv2.ReleaseFinishedEventData{
+		EventData: keptnv2.EventData{
+			Project: releaseTriggeredEvent.Project,
+			Stage:   releaseTriggeredEvent.Stage,
+			Service: releaseTriggeredEvent.Service,
+			Labels:  releaseTriggeredEvent.Labels,
+			Status:  status,
+			Result:  result,
+			Message: message,
+		},
+	}
+}
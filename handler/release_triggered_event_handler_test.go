@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"context"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/sdk"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"testing"
+	"time"
+)
+
+// deployTestChart deploys the carts test chart with the given strategy
+func deployTestChart(t *testing.T, deploymentHandler sdk.TaskHandler, chart string, strategy string) {
+	event := newEvent("../test/events/deployment_triggered.json")
+	eventData := keptnv2.DeploymentTriggeredEventData{}
+	require.NoError(t, keptnv2.EventDataAs(event, &eventData))
+	eventData.Deployment.DeploymentStrategy = strategy
+	event.Data = eventData
+
+	fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+	fakeKeptn.SetResourceHandler(resourcesHandler{"helm/carts.tgz": chart})
+	fakeKeptn.AddTaskHandler("sh.keptn.event.deployment.triggered", deploymentHandler)
+	fakeKeptn.NewEvent(event)
+	fakeKeptn.AssertSentEventResult(t, 1, keptnv2.ResultPass)
+}
+
+func Test_Receiving_ReleaseTriggeredEvent(t *testing.T) {
+	chart := packageTestChart(t, "../test/charts/carts")
+
+	tests := []struct {
+		name             string
+		deployedStrategy string
+		strategy         string
+		result           keptnv2.ResultType
+		wantStatus       keptnv2.StatusType
+		wantResult       keptnv2.ResultType
+		wantMessage      string
+		// wantPrimaryImage is the image of the primary deployment after the release, which receives all traffic
+		wantPrimaryImage string
+	}{
+		{
+			name:             "blue/green promoted",
+			deployedStrategy: "blue_green_service",
+			strategy:         "blue_green_service",
+			result:           keptnv2.ResultPass,
+			wantStatus:       keptnv2.StatusSucceeded,
+			wantResult:       keptnv2.ResultPass,
+			wantMessage:      "promoted carts to carts-primary in namespace sockshop-dev",
+			wantPrimaryImage: "docker.io/keptnexamples/carts:0.13.2",
+		},
+		{
+			name:             "canary promoted with warning",
+			deployedStrategy: "canary",
+			strategy:         "canary",
+			result:           keptnv2.ResultWarning,
+			wantStatus:       keptnv2.StatusSucceeded,
+			wantResult:       keptnv2.ResultPass,
+			wantMessage:      "promoted carts to carts-primary in namespace sockshop-dev",
+			wantPrimaryImage: "docker.io/keptnexamples/carts:0.13.2",
+		},
+		{
+			name:             "blue/green rolled back",
+			deployedStrategy: "blue_green_service",
+			strategy:         "blue_green_service",
+			result:           keptnv2.ResultFailed,
+			wantStatus:       keptnv2.StatusSucceeded,
+			wantResult:       keptnv2.ResultFailed,
+			wantMessage:      "rolled back carts in namespace sockshop-dev as the result of the sequence is fail, carts-primary serves all traffic",
+			wantPrimaryImage: "docker.io/keptnexamples/carts:0.11.2",
+		},
+		{
+			name:             "direct deployment",
+			deployedStrategy: "direct",
+			strategy:         "direct",
+			result:           keptnv2.ResultPass,
+			wantStatus:       keptnv2.StatusSucceeded,
+			wantResult:       keptnv2.ResultPass,
+			wantMessage:      "nothing to release for deployment strategy direct",
+		},
+		{
+			name:             "direct deployment failed",
+			deployedStrategy: "direct",
+			strategy:         "direct",
+			result:           keptnv2.ResultFailed,
+			wantStatus:       keptnv2.StatusSucceeded,
+			wantResult:       keptnv2.ResultFailed,
+			wantMessage:      "the result of the sequence is fail, but deployment strategy direct keeps no previous version to roll back to",
+		},
+		{
+			name:             "no canary deployed",
+			deployedStrategy: "direct",
+			strategy:         "canary",
+			result:           keptnv2.ResultPass,
+			wantStatus:       keptnv2.StatusErrored,
+			wantResult:       keptnv2.ResultFailed,
+			wantMessage:      "could not promote carts: no canary deployment of carts found in namespace sockshop-dev",
+		},
+		{
+			name:             "no canary to roll back",
+			deployedStrategy: "direct",
+			strategy:         "canary",
+			result:           keptnv2.ResultFailed,
+			wantStatus:       keptnv2.StatusErrored,
+			wantResult:       keptnv2.ResultFailed,
+			wantMessage:      "could not roll back carts: no canary deployment of carts found in namespace sockshop-dev",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			client := newTestDynamicClient()
+			client.PrependReactor("create", "deployments", rolledOutOnCreate)
+			deployTestChart(t, NewDeploymentTriggeredEventHandler(client, WithCanaryWeights([]int{10}, time.Millisecond)), chart, tt.deployedStrategy)
+
+			// a newer version is deployed to the canary track
+			newImage := `{"spec":{"template":{"spec":{"containers":[{"name":"carts","image":"docker.io/keptnexamples/carts:0.13.2"}]}}}}`
+			_, err := client.Resource(deploymentResource).Namespace("sockshop-dev").Patch(ctx, "carts", types.MergePatchType, []byte(newImage), metav1.PatchOptions{})
+			require.NoError(t, err)
+
+			releaseHandler := NewReleaseTriggeredEventHandler(client, WithReleaseRolloutTimeout(100*time.Millisecond))
+			releaseHandler.pollInterval = 10 * time.Millisecond
+
+			event := newEvent("../test/events/release_triggered.json")
+			eventData := keptnv2.ReleaseTriggeredEventData{}
+			require.NoError(t, keptnv2.EventDataAs(event, &eventData))
+			eventData.Deployment.DeploymentStrategy = tt.strategy
+			eventData.Result = tt.result
+			event.Data = eventData
+
+			fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+			fakeKeptn.AddTaskHandler("sh.keptn.event.release.triggered", releaseHandler)
+
+			fakeKeptn.NewEvent(event)
+
+			fakeKeptn.AssertNumberOfEventSent(t, 2)
+			fakeKeptn.AssertSentEventType(t, 1, keptnv2.GetFinishedEventType("release"))
+			fakeKeptn.AssertSentEventStatus(t, 1, tt.wantStatus)
+			fakeKeptn.AssertSentEventResult(t, 1, tt.wantResult)
+			finishedEventData := keptnv2.ReleaseFinishedEventData{}
+			require.NoError(t, keptnv2.EventDataAs(fakeKeptn.SentEvents[1], &finishedEventData))
+			require.Equal(t, tt.wantMessage, finishedEventData.Message)
+
+			if tt.wantPrimaryImage != "" {
+				primary, err := client.Resource(deploymentResource).Namespace("sockshop-dev").Get(ctx, "carts-primary", metav1.GetOptions{})
+				require.NoError(t, err)
+				containers, _, _ := unstructured.NestedSlice(primary.Object, "spec", "template", "spec", "containers")
+				require.Equal(t, tt.wantPrimaryImage, containers[0].(map[string]interface{})["image"])
+				podLabels, _, _ := unstructured.NestedStringMap(primary.Object, "spec", "template", "metadata", "labels")
+				require.Equal(t, primaryTrack, podLabels[trackLabel])
+
+				service, err := client.Resource(serviceResource).Namespace("sockshop-dev").Get(ctx, "carts", metav1.GetOptions{})
+				require.NoError(t, err)
+				selector, _, _ := unstructured.NestedStringMap(service.Object, "spec", "selector")
+				require.Equal(t, primaryTrack, selector[trackLabel])
+
+				ingress, err := client.Resource(ingressResource).Namespace("sockshop-dev").Get(ctx, "carts-canary", metav1.GetOptions{})
+				require.NoError(t, err)
+				require.Equal(t, "0", ingress.GetAnnotations()[canaryWeightAnnotation])
+
+				canary, err := client.Resource(deploymentResource).Namespace("sockshop-dev").Get(ctx, "carts", metav1.GetOptions{})
+				require.NoError(t, err)
+				replicas, _, _ := unstructured.NestedInt64(canary.Object, "spec", "replicas")
+				require.Equal(t, int64(0), replicas)
+			}
+		})
+	}
+}
+
+func Test_Receiving_ReleaseTriggeredEvent_ShuttingDown(t *testing.T) {
+	client := newTestDynamicClient()
+	client.PrependReactor("create", "deployments", rolledOutOnCreate)
+	deployTestChart(t, NewDeploymentTriggeredEventHandler(client, WithCanaryWeights([]int{10}, time.Millisecond)), packageTestChart(t, "../test/charts/carts"), "canary")
+
+	// the service shuts down while the promoted primary is rolled out
+	notRolledOut := `{"status":{"updatedReplicas":0,"availableReplicas":0}}`
+	_, err := client.Resource(deploymentResource).Namespace("sockshop-dev").Patch(context.Background(), "carts-primary", types.MergePatchType, []byte(notRolledOut), metav1.PatchOptions{})
+	require.NoError(t, err)
+	shutdownCtx, shutdown := context.WithCancel(context.Background())
+	shutdown()
+	releaseHandler := NewReleaseTriggeredEventHandler(client, WithReleaseShutdownContext(shutdownCtx), WithReleaseRolloutTimeout(time.Minute))
+
+	event := newEvent("../test/events/release_triggered.json")
+	eventData := keptnv2.ReleaseTriggeredEventData{}
+	require.NoError(t, keptnv2.EventDataAs(event, &eventData))
+	eventData.Deployment.DeploymentStrategy = "canary"
+	eventData.Result = keptnv2.ResultPass
+	event.Data = eventData
+
+	fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+	fakeKeptn.AddTaskHandler("sh.keptn.event.release.triggered", releaseHandler)
+
+	fakeKeptn.NewEvent(event)
+
+	fakeKeptn.AssertNumberOfEventSent(t, 2)
+	fakeKeptn.AssertSentEventStatus(t, 1, keptnv2.StatusErrored)
+	fakeKeptn.AssertSentEventResult(t, 1, keptnv2.ResultFailed)
+	releaseFinishedEventData := keptnv2.ReleaseFinishedEventData{}
+	require.NoError(t, keptnv2.EventDataAs(fakeKeptn.SentEvents[1], &releaseFinishedEventData))
+	require.Contains(t, releaseFinishedEventData.Message, "release of carts was cancelled because the service is shutting down")
+}
@@ -0,0 +1,354 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/sdk"
+	appsv1 "k8s.io/api/apps/v1"
+	k8serrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"time"
+)
+
+const defaultRolloutTimeout = 5 * time.Minute
+const defaultRolloutPollInterval = 2 * time.Second
+
+// restartedAtAnnotation is the pod template annotation kubectl rollout restart sets
+const restartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// RolloutRestartAction restarts the pods of the deployment, statefulset or daemonset named like the service or the target of the request,
+// the same way kubectl rollout restart does, and waits until the rollout has completed
+type RolloutRestartAction struct {
+	clientset      kubernetes.Interface
+	namespace      *NamespaceTemplate
+	rolloutTimeout time.Duration
+	pollInterval   time.Duration
+	now            func() time.Time
+}
+
+// RolloutRestartActionOption can be used to configure the RolloutRestartAction
+type RolloutRestartActionOption func(*RolloutRestartAction)
+
+// WithRestartNamespaceTemplate configures the namespace the workload is looked up in, the default is {{.Project}}-{{.Stage}}
+func WithRestartNamespaceTemplate(namespace *NamespaceTemplate) RolloutRestartActionOption {
+	return func(a *RolloutRestartAction) {
+		a.namespace = namespace
+	}
+}
+
+// WithRolloutTimeout configures how long to wait for the rollout to complete before the action fails
+func WithRolloutTimeout(timeout time.Duration) RolloutRestartActionOption {
+	return func(a *RolloutRestartAction) {
+		if timeout > 0 {
+			a.rolloutTimeout = timeout
+		}
+	}
+}
+
+// NewRolloutRestartAction creates a new RolloutRestartAction restarting workloads using the given clientset
+func NewRolloutRestartAction(clientset kubernetes.Interface, opts ...RolloutRestartActionOption) *RolloutRestartAction {
+	action := &RolloutRestartAction{
+		clientset:      clientset,
+		namespace:      defaultNamespaceTemplate(),
+		rolloutTimeout: defaultRolloutTimeout,
+		pollInterval:   defaultRolloutPollInterval,
+		now:            time.Now,
+	}
+	for _, opt := range opts {
+		opt(action)
+	}
+	return action
+}
+
+// ParameterSchema returns the schema of the value, the restart has no parameters
+func (a *RolloutRestartAction) ParameterSchema() *ParameterSchema {
+	return &ParameterSchema{
+		Type:        ParameterTypeObject,
+		Description: "no parameters, the workload is the one of the service or the target of the request",
+	}
+}
+
+// NewParameters returns the empty value the parameters are decoded into
+func (a *RolloutRestartAction) NewParameters() interface{} {
+	return &struct{}{}
+}
+
+// Describe returns a description of the restart
+func (a *RolloutRestartAction) Describe(req ActionRequest) string {
+	namespace, _ := req.TargetNamespace(a.namespace)
+	return fmt.Sprintf("restart workload %s in namespace %s and wait up to %s for the rollout", req.TargetName(), namespace, a.rolloutTimeout)
+}
+
+// Validate checks that the namespace can be determined
+func (a *RolloutRestartAction) Validate(req ActionRequest) error {
+	_, err := req.TargetNamespace(a.namespace)
+	return err
+}
+
+// Execute restarts the workload and reports whether its rollout completed in time
+func (a *RolloutRestartAction) Execute(ctx context.Context, k sdk.IKeptn, req ActionRequest) (ActionResult, error) {
+	namespace, err := req.TargetNamespace(a.namespace)
+	if err != nil {
+		return ActionResult{}, err
+	}
+
+	workload, err := a.getWorkload(ctx, namespace, req.TargetName())
+	if err != nil {
+		return ActionResult{}, err
+	}
+
+	patch := fmt.Sprintf(`{"spec":{"template":{"metadata":{"annotations":{%q:%q}}}}}`, restartedAtAnnotation, a.now().Format(time.RFC3339))
+	if err := workload.restart(ctx, []byte(patch)); err != nil {
+		return ActionResult{}, fmt.Errorf("could not restart %s: %w", workload, err)
+	}
+	k.Logger().Infof("Restarted %s, waiting for the rollout to complete", workload)
+
+	status, err := waitForRollout(ctx, k, workload, a.rolloutTimeout, a.pollInterval)
+	if errors.Is(err, errRolloutFailed) {
+		return ActionResult{
+			Result:  keptnv2.ResultFailed,
+			Message: fmt.Sprintf("rollout of %s failed: %s", workload, status),
+		}, nil
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return ActionResult{}, ctx.Err()
+		}
+		return ActionResult{
+			Result:  keptnv2.ResultFailed,
+			Message: fmt.Sprintf("rollout of %s did not complete within %s: %s", workload, a.rolloutTimeout, status),
+		}, nil
+	}
+
+	return ActionResult{
+		Message: fmt.Sprintf("restarted %s, rollout completed", workload),
+	}, nil
+}
+
+// getWorkload returns the deployment, statefulset or daemonset with the given name
+func (a *RolloutRestartAction) getWorkload(ctx context.Context, namespace string, name string) (rolloutWorkload, error) {
+	deployment, err := a.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err == nil {
+		return &deploymentWorkload{clientset: a.clientset, deployment: deployment}, nil
+	}
+	if !k8serrors.IsNotFound(err) {
+		return nil, fmt.Errorf("could not get deployment %s in namespace %s: %w", name, namespace, err)
+	}
+
+	statefulSet, err := a.clientset.AppsV1().StatefulSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err == nil {
+		return &statefulSetWorkload{clientset: a.clientset, statefulSet: statefulSet}, nil
+	}
+	if !k8serrors.IsNotFound(err) {
+		return nil, fmt.Errorf("could not get statefulset %s in namespace %s: %w", name, namespace, err)
+	}
+
+	daemonSet, err := a.clientset.AppsV1().DaemonSets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err == nil {
+		return &daemonSetWorkload{clientset: a.clientset, daemonSet: daemonSet}, nil
+	}
+	if !k8serrors.IsNotFound(err) {
+		return nil, fmt.Errorf("could not get daemonset %s in namespace %s: %w", name, namespace, err)
+	}
+
+	return nil, fmt.Errorf("no deployment, statefulset or daemonset named %s found in namespace %s", name, namespace)
+}
+
+// errRolloutFailed is returned by rolloutStatus if the rollout will not complete anymore
+var errRolloutFailed = errors.New("rollout failed")
+
+// rolloutStatusChecker reports the rollout status of a workload
+type rolloutStatusChecker interface {
+	// rolloutStatus returns whether the rollout is complete and a description of its progress
+	rolloutStatus(ctx context.Context) (bool, string, error)
+	String() string
+}
+
+// waitForRollout polls the rollout status of the workload until the rollout completed, failed or the timeout passed.
+// It returns the last reported status, and errRolloutFailed if the rollout failed
+func waitForRollout(ctx context.Context, k sdk.IKeptn, workload rolloutStatusChecker, timeout time.Duration, pollInterval time.Duration) (string, error) {
+	rolloutCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	status := ""
+	err := wait.PollImmediateUntilWithContext(rolloutCtx, pollInterval, func(ctx context.Context) (bool, error) {
+		done, rolloutStatus, statusErr := workload.rolloutStatus(ctx)
+		if rolloutStatus != "" {
+			status = rolloutStatus
+		}
+		if errors.Is(statusErr, errRolloutFailed) {
+			return false, statusErr
+		}
+		if statusErr != nil {
+			// the rollout is still checked until the deadline passes, maybe the API server is only temporarily unavailable
+			k.Logger().Warnf("Could not get rollout status of %s: %s", workload, statusErr.Error())
+			return false, nil
+		}
+		return done, nil
+	})
+	return status, err
+}
+
+// rolloutWorkload is a workload whose pods can be restarted
+type rolloutWorkload interface {
+	rolloutStatusChecker
+	// restart applies the given strategic merge patch to the workload
+	restart(ctx context.Context, patch []byte) error
+}
+
+type deploymentWorkload struct {
+	clientset  kubernetes.Interface
+	deployment *appsv1.Deployment
+}
+
+func (w *deploymentWorkload) restart(ctx context.Context, patch []byte) error {
+	deployment, err := w.clientset.AppsV1().Deployments(w.deployment.Namespace).Patch(ctx, w.deployment.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	if err == nil {
+		w.deployment = deployment
+	}
+	return err
+}
+
+func (w *deploymentWorkload) rolloutStatus(ctx context.Context) (bool, string, error) {
+	deployment, err := w.clientset.AppsV1().Deployments(w.deployment.Namespace).Get(ctx, w.deployment.Name, metav1.GetOptions{})
+	if err != nil {
+		return false, "", err
+	}
+	return deploymentRolloutStatus(deployment)
+}
+
+// deploymentRolloutStatus follows the checks of kubectl rollout status for deployments
+func deploymentRolloutStatus(deployment *appsv1.Deployment) (bool, string, error) {
+	if deployment.Generation > deployment.Status.ObservedGeneration {
+		return false, "waiting for the deployment spec update to be observed", nil
+	}
+	for _, condition := range deployment.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing && condition.Reason == "ProgressDeadlineExceeded" {
+			return false, fmt.Sprintf("deployment exceeded its progress deadline: %s", condition.Message), errRolloutFailed
+		}
+	}
+
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+	status := deployment.Status
+	if status.UpdatedReplicas < replicas {
+		return false, fmt.Sprintf("%d of %d replicas have been updated", status.UpdatedReplicas, replicas), nil
+	}
+	if status.Replicas > status.UpdatedReplicas {
+		return false, fmt.Sprintf("%d old replicas are pending termination", status.Replicas-status.UpdatedReplicas), nil
+	}
+	if status.AvailableReplicas < status.UpdatedReplicas {
+		return false, fmt.Sprintf("%d of %d updated replicas are available", status.AvailableReplicas, status.UpdatedReplicas), nil
+	}
+	return true, "all replicas are updated and available", nil
+}
+
+func (w *deploymentWorkload) String() string {
+	return fmt.Sprintf("deployment %s in namespace %s", w.deployment.Name, w.deployment.Namespace)
+}
+
+type statefulSetWorkload struct {
+	clientset   kubernetes.Interface
+	statefulSet *appsv1.StatefulSet
+}
+
+func (w *statefulSetWorkload) restart(ctx context.Context, patch []byte) error {
+	statefulSet, err := w.clientset.AppsV1().StatefulSets(w.statefulSet.Namespace).Patch(ctx, w.statefulSet.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	if err == nil {
+		w.statefulSet = statefulSet
+	}
+	return err
+}
+
+func (w *statefulSetWorkload) rolloutStatus(ctx context.Context) (bool, string, error) {
+	statefulSet, err := w.clientset.AppsV1().StatefulSets(w.statefulSet.Namespace).Get(ctx, w.statefulSet.Name, metav1.GetOptions{})
+	if err != nil {
+		return false, "", err
+	}
+	return statefulSetRolloutStatus(statefulSet)
+}
+
+// statefulSetRolloutStatus follows the checks of kubectl rollout status for statefulsets
+func statefulSetRolloutStatus(statefulSet *appsv1.StatefulSet) (bool, string, error) {
+	if statefulSet.Spec.UpdateStrategy.Type != appsv1.RollingUpdateStatefulSetStrategyType {
+		return true, "the update strategy does not roll out changes automatically", nil
+	}
+	if statefulSet.Generation > statefulSet.Status.ObservedGeneration {
+		return false, "waiting for the statefulset spec update to be observed", nil
+	}
+
+	replicas := int32(1)
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+	status := statefulSet.Status
+	if status.ReadyReplicas < replicas {
+		return false, fmt.Sprintf("%d of %d replicas are ready", status.ReadyReplicas, replicas), nil
+	}
+	if rollingUpdate := statefulSet.Spec.UpdateStrategy.RollingUpdate; rollingUpdate != nil && rollingUpdate.Partition != nil && *rollingUpdate.Partition > 0 {
+		updatedReplicas := replicas - *rollingUpdate.Partition
+		if status.UpdatedReplicas < updatedReplicas {
+			return false, fmt.Sprintf("%d of %d replicas of the partition have been updated", status.UpdatedReplicas, updatedReplicas), nil
+		}
+		return true, "all replicas of the partition are updated", nil
+	}
+	if status.UpdateRevision != status.CurrentRevision {
+		return false, fmt.Sprintf("%d of %d replicas have been updated", status.UpdatedReplicas, replicas), nil
+	}
+	return true, "all replicas are updated and ready", nil
+}
+
+func (w *statefulSetWorkload) String() string {
+	return fmt.Sprintf("statefulset %s in namespace %s", w.statefulSet.Name, w.statefulSet.Namespace)
+}
+
+type daemonSetWorkload struct {
+	clientset kubernetes.Interface
+	daemonSet *appsv1.DaemonSet
+}
+
+func (w *daemonSetWorkload) restart(ctx context.Context, patch []byte) error {
+	daemonSet, err := w.clientset.AppsV1().DaemonSets(w.daemonSet.Namespace).Patch(ctx, w.daemonSet.Name, types.StrategicMergePatchType, patch, metav1.PatchOptions{})
+	if err == nil {
+		w.daemonSet = daemonSet
+	}
+	return err
+}
+
+func (w *daemonSetWorkload) rolloutStatus(ctx context.Context) (bool, string, error) {
+	daemonSet, err := w.clientset.AppsV1().DaemonSets(w.daemonSet.Namespace).Get(ctx, w.daemonSet.Name, metav1.GetOptions{})
+	if err != nil {
+		return false, "", err
+	}
+	return daemonSetRolloutStatus(daemonSet)
+}
+
+// daemonSetRolloutStatus follows the checks of kubectl rollout status for daemonsets
+func daemonSetRolloutStatus(daemonSet *appsv1.DaemonSet) (bool, string, error) {
+	if daemonSet.Spec.UpdateStrategy.Type != appsv1.RollingUpdateDaemonSetStrategyType {
+		return true, "the update strategy does not roll out changes automatically", nil
+	}
+	if daemonSet.Generation > daemonSet.Status.ObservedGeneration {
+		return false, "waiting for the daemonset spec update to be observed", nil
+	}
+
+	status := daemonSet.Status
+	if status.UpdatedNumberScheduled < status.DesiredNumberScheduled {
+		return false, fmt.Sprintf("%d of %d pods have been updated", status.UpdatedNumberScheduled, status.DesiredNumberScheduled), nil
+	}
+	if status.NumberAvailable < status.DesiredNumberScheduled {
+		return false, fmt.Sprintf("%d of %d updated pods are available", status.NumberAvailable, status.DesiredNumberScheduled), nil
+	}
+	return true, "all pods are updated and available", nil
+}
+
+func (w *daemonSetWorkload) String() string {
+	return fmt.Sprintf("daemonset %s in namespace %s", w.daemonSet.Name, w.daemonSet.Namespace)
+}
@@ -0,0 +1,145 @@
+package handler
+
+import (
+	"context"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/sdk"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	"testing"
+	"time"
+)
+
+func newTestRolloutRestartAction(clientset *fake.Clientset) *RolloutRestartAction {
+	action := NewRolloutRestartAction(clientset, WithRolloutTimeout(100*time.Millisecond))
+	action.pollInterval = 10 * time.Millisecond
+	action.now = func() time.Time { return time.Date(2021, 1, 15, 15, 10, 0, 0, time.UTC) }
+	return action
+}
+
+func newRolledOutDeployment(replicas int32, status appsv1.DeploymentStatus) *appsv1.Deployment {
+	deployment := newDeployment("user-managed-dev", "nginx", replicas)
+	deployment.Generation = 1
+	status.ObservedGeneration = 1
+	deployment.Status = status
+	return deployment
+}
+
+func Test_RolloutRestartAction_Execute(t *testing.T) {
+	tests := []struct {
+		name       string
+		workload   runtime.Object
+		wantResult ActionResult
+	}{
+		{
+			name:       "deployment rolled out",
+			workload:   newRolledOutDeployment(2, appsv1.DeploymentStatus{Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2}),
+			wantResult: ActionResult{Message: "restarted deployment nginx in namespace user-managed-dev, rollout completed"},
+		},
+		{
+			name:     "deployment not rolled out in time",
+			workload: newRolledOutDeployment(3, appsv1.DeploymentStatus{Replicas: 3, UpdatedReplicas: 3, AvailableReplicas: 1}),
+			wantResult: ActionResult{
+				Result:  keptnv2.ResultFailed,
+				Message: "rollout of deployment nginx in namespace user-managed-dev did not complete within 100ms: 1 of 3 updated replicas are available",
+			},
+		},
+		{
+			name: "deployment exceeded progress deadline",
+			workload: newRolledOutDeployment(1, appsv1.DeploymentStatus{
+				Conditions: []appsv1.DeploymentCondition{{Type: appsv1.DeploymentProgressing, Reason: "ProgressDeadlineExceeded", Message: "ReplicaSet nginx-5d9 has timed out progressing."}},
+			}),
+			wantResult: ActionResult{
+				Result:  keptnv2.ResultFailed,
+				Message: "rollout of deployment nginx in namespace user-managed-dev failed: deployment exceeded its progress deadline: ReplicaSet nginx-5d9 has timed out progressing.",
+			},
+		},
+		{
+			name: "statefulset rolled out",
+			workload: &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "user-managed-dev", Name: "nginx"},
+				Spec:       appsv1.StatefulSetSpec{UpdateStrategy: appsv1.StatefulSetUpdateStrategy{Type: appsv1.RollingUpdateStatefulSetStrategyType}},
+				Status:     appsv1.StatefulSetStatus{ReadyReplicas: 1, UpdatedReplicas: 1, CurrentRevision: "nginx-7f8", UpdateRevision: "nginx-7f8"},
+			},
+			wantResult: ActionResult{Message: "restarted statefulset nginx in namespace user-managed-dev, rollout completed"},
+		},
+		{
+			name: "statefulset not rolled out in time",
+			workload: &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "user-managed-dev", Name: "nginx"},
+				Spec:       appsv1.StatefulSetSpec{UpdateStrategy: appsv1.StatefulSetUpdateStrategy{Type: appsv1.RollingUpdateStatefulSetStrategyType}},
+				Status:     appsv1.StatefulSetStatus{ReadyReplicas: 1, CurrentRevision: "nginx-7f8", UpdateRevision: "nginx-9c2"},
+			},
+			wantResult: ActionResult{
+				Result:  keptnv2.ResultFailed,
+				Message: "rollout of statefulset nginx in namespace user-managed-dev did not complete within 100ms: 0 of 1 replicas have been updated",
+			},
+		},
+		{
+			name: "daemonset rolled out",
+			workload: &appsv1.DaemonSet{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "user-managed-dev", Name: "nginx"},
+				Spec:       appsv1.DaemonSetSpec{UpdateStrategy: appsv1.DaemonSetUpdateStrategy{Type: appsv1.RollingUpdateDaemonSetStrategyType}},
+				Status:     appsv1.DaemonSetStatus{DesiredNumberScheduled: 3, UpdatedNumberScheduled: 3, NumberAvailable: 3},
+			},
+			wantResult: ActionResult{Message: "restarted daemonset nginx in namespace user-managed-dev, rollout completed"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(tt.workload)
+
+			result, err := newTestRolloutRestartAction(clientset).Execute(context.Background(), sdk.NewFakeKeptn("test").Keptn, newActionRequest(t, nil))
+
+			require.NoError(t, err)
+			require.Equal(t, tt.wantResult, result)
+		})
+	}
+}
+
+func Test_RolloutRestartAction_PatchesPodTemplate(t *testing.T) {
+	clientset := fake.NewSimpleClientset(newRolledOutDeployment(1, appsv1.DeploymentStatus{Replicas: 1, UpdatedReplicas: 1, AvailableReplicas: 1}))
+
+	_, err := newTestRolloutRestartAction(clientset).Execute(context.Background(), sdk.NewFakeKeptn("test").Keptn, newActionRequest(t, nil))
+	require.NoError(t, err)
+
+	deployment, err := clientset.AppsV1().Deployments("user-managed-dev").Get(context.Background(), "nginx", metav1.GetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{restartedAtAnnotation: "2021-01-15T15:10:00Z"}, deployment.Spec.Template.Annotations)
+}
+
+func Test_RolloutRestartAction_WaitsForRollout(t *testing.T) {
+	clientset := fake.NewSimpleClientset(newRolledOutDeployment(2, appsv1.DeploymentStatus{Replicas: 3, UpdatedReplicas: 1, AvailableReplicas: 1}))
+	action := newTestRolloutRestartAction(clientset)
+	action.rolloutTimeout = 5 * time.Second
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		deployment, err := clientset.AppsV1().Deployments("user-managed-dev").Get(context.Background(), "nginx", metav1.GetOptions{})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		deployment.Status = appsv1.DeploymentStatus{ObservedGeneration: 1, Replicas: 2, UpdatedReplicas: 2, AvailableReplicas: 2}
+		if _, err := clientset.AppsV1().Deployments("user-managed-dev").UpdateStatus(context.Background(), deployment, metav1.UpdateOptions{}); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	result, err := action.Execute(context.Background(), sdk.NewFakeKeptn("test").Keptn, newActionRequest(t, nil))
+
+	require.NoError(t, err)
+	require.Equal(t, ActionResult{Message: "restarted deployment nginx in namespace user-managed-dev, rollout completed"}, result)
+}
+
+func Test_RolloutRestartAction_WorkloadNotFound(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "user-managed-dev", Name: "nginx"}})
+
+	_, err := newTestRolloutRestartAction(clientset).Execute(context.Background(), sdk.NewFakeKeptn("test").Keptn, newActionRequest(t, nil))
+
+	require.EqualError(t, err, "no deployment, statefulset or daemonset named nginx found in namespace user-managed-dev")
+}
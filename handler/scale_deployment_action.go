@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/sdk"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+)
+
+const defaultMinReplicas = 1
+const defaultMaxReplicas = 10
+
+// maxReplicaDelta limits the number of replicas added or removed by a single action
+const maxReplicaDelta = 1000
+
+// ScaleDeploymentAction scales the deployment of the service, or the target of the request, by the number of replicas given in the value of the action,
+// e.g. "2" adds two replicas and "-1" removes one. The resulting number of replicas is kept within the configured limits
+type ScaleDeploymentAction struct {
+	clientset   kubernetes.Interface
+	namespace   *NamespaceTemplate
+	minReplicas int32
+	maxReplicas int32
+}
+
+// ScaleDeploymentActionOption can be used to configure the ScaleDeploymentAction
+type ScaleDeploymentActionOption func(*ScaleDeploymentAction)
+
+// WithScaleNamespaceTemplate configures the namespace the deployment is looked up in, the default is {{.Project}}-{{.Stage}}
+func WithScaleNamespaceTemplate(namespace *NamespaceTemplate) ScaleDeploymentActionOption {
+	return func(a *ScaleDeploymentAction) {
+		a.namespace = namespace
+	}
+}
+
+// WithReplicaLimits configures the minimum and maximum number of replicas a deployment is scaled to
+func WithReplicaLimits(minReplicas int32, maxReplicas int32) ScaleDeploymentActionOption {
+	return func(a *ScaleDeploymentAction) {
+		a.minReplicas = minReplicas
+		a.maxReplicas = maxReplicas
+	}
+}
+
+// NewScaleDeploymentAction creates a new ScaleDeploymentAction scaling deployments using the given clientset
+func NewScaleDeploymentAction(clientset kubernetes.Interface, opts ...ScaleDeploymentActionOption) *ScaleDeploymentAction {
+	action := &ScaleDeploymentAction{
+		clientset:   clientset,
+		namespace:   defaultNamespaceTemplate(),
+		minReplicas: defaultMinReplicas,
+		maxReplicas: defaultMaxReplicas,
+	}
+	for _, opt := range opts {
+		opt(action)
+	}
+	return action
+}
+
+// ParameterSchema returns the schema of the value, the number of replicas to add or remove
+func (a *ScaleDeploymentAction) ParameterSchema() *ParameterSchema {
+	return &ParameterSchema{
+		Type:        ParameterTypeInteger,
+		Description: "number of replicas to add, negative to remove replicas",
+		Minimum:     float64Ptr(-maxReplicaDelta),
+		Maximum:     float64Ptr(maxReplicaDelta),
+	}
+}
+
+// NewParameters returns the value the number of replicas is decoded into
+func (a *ScaleDeploymentAction) NewParameters() interface{} {
+	return new(int32)
+}
+
+// Describe returns a description of the scaling
+func (a *ScaleDeploymentAction) Describe(req ActionRequest) string {
+	namespace, _ := req.TargetNamespace(a.namespace)
+	return fmt.Sprintf("scale deployment %s in namespace %s by %d replicas", req.TargetName(), namespace, replicaDelta(req))
+}
+
+// Validate checks that replicas are added or removed and the namespace can be determined
+func (a *ScaleDeploymentAction) Validate(req ActionRequest) error {
+	if replicaDelta(req) == 0 {
+		return errors.New("value must not be 0")
+	}
+	_, err := req.TargetNamespace(a.namespace)
+	return err
+}
+
+// Execute scales the deployment of the service or the target of the request
+func (a *ScaleDeploymentAction) Execute(ctx context.Context, k sdk.IKeptn, req ActionRequest) (ActionResult, error) {
+	delta := replicaDelta(req)
+	namespace, err := req.TargetNamespace(a.namespace)
+	if err != nil {
+		return ActionResult{}, err
+	}
+	name := req.TargetName()
+
+	var previousReplicas, replicas int32
+	err = retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		deployment, err := a.clientset.AppsV1().Deployments(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		previousReplicas = 1
+		if deployment.Spec.Replicas != nil {
+			previousReplicas = *deployment.Spec.Replicas
+		}
+		replicas = a.limitReplicas(int64(previousReplicas) + int64(delta))
+		if replicas == previousReplicas {
+			return nil
+		}
+
+		deployment.Spec.Replicas = &replicas
+		_, err = a.clientset.AppsV1().Deployments(namespace).Update(ctx, deployment, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return ActionResult{}, fmt.Errorf("could not scale deployment %s in namespace %s: %w", name, namespace, err)
+	}
+
+	if replicas == previousReplicas {
+		return ActionResult{
+			Result:  keptnv2.ResultFailed,
+			Message: fmt.Sprintf("deployment %s in namespace %s already has %d replicas, the limits are %d to %d replicas", name, namespace, replicas, a.minReplicas, a.maxReplicas),
+		}, nil
+	}
+
+	k.Logger().Infof("Scaled deployment %s in namespace %s from %d to %d replicas", name, namespace, previousReplicas, replicas)
+	return ActionResult{
+		Message: fmt.Sprintf("scaled deployment %s in namespace %s from %d to %d replicas", name, namespace, previousReplicas, replicas),
+	}, nil
+}
+
+// limitReplicas keeps the given number of replicas within the configured limits
+func (a *ScaleDeploymentAction) limitReplicas(replicas int64) int32 {
+	if replicas < int64(a.minReplicas) {
+		return a.minReplicas
+	}
+	if replicas > int64(a.maxReplicas) {
+		return a.maxReplicas
+	}
+	return int32(replicas)
+}
+
+// replicaDelta returns the decoded number of replicas to add (or remove, if negative)
+func replicaDelta(req ActionRequest) int32 {
+	if delta, ok := req.Parameters.(*int32); ok && delta != nil {
+		return *delta
+	}
+	return 0
+}
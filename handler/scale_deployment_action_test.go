@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/sdk"
+	"github.com/stretchr/testify/require"
+	appsv1 "k8s.io/api/apps/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+	"testing"
+)
+
+// newActionRequest returns the request of the test action.triggered event with the given value
+func newActionRequest(t *testing.T, value interface{}) ActionRequest {
+	eventData := keptnv2.ActionTriggeredEventData{}
+	require.NoError(t, keptnv2.EventDataAs(newEvent("../test/events/action_triggered.json"), &eventData))
+	eventData.Action.Value = value
+	return ActionRequest{Event: eventData}
+}
+
+// newDecodedActionRequest returns the request of the test action.triggered event with the given value decoded for the action
+func newDecodedActionRequest(t *testing.T, action Action, value interface{}) ActionRequest {
+	req, err := decodeActionParameters(action, newActionRequest(t, value))
+	require.NoError(t, err)
+	return req
+}
+
+func newDeployment(namespace string, name string, replicas int32) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       appsv1.DeploymentSpec{Replicas: &replicas},
+	}
+}
+
+func getDeploymentReplicas(t *testing.T, clientset *fake.Clientset, namespace string, name string) int32 {
+	deployment, err := clientset.AppsV1().Deployments(namespace).Get(context.Background(), name, metav1.GetOptions{})
+	require.NoError(t, err)
+	return *deployment.Spec.Replicas
+}
+
+func Test_ScaleDeploymentAction_Execute(t *testing.T) {
+	tests := []struct {
+		name         string
+		replicas     int32
+		value        interface{}
+		wantReplicas int32
+		wantResult   ActionResult
+	}{
+		{
+			name:         "scale up",
+			replicas:     2,
+			value:        "1",
+			wantReplicas: 3,
+			wantResult:   ActionResult{Message: "scaled deployment nginx in namespace user-managed-dev from 2 to 3 replicas"},
+		},
+		{
+			name:         "scale down",
+			replicas:     3,
+			value:        float64(-2),
+			wantReplicas: 1,
+			wantResult:   ActionResult{Message: "scaled deployment nginx in namespace user-managed-dev from 3 to 1 replicas"},
+		},
+		{
+			name:         "limited to max replicas",
+			replicas:     4,
+			value:        "+3",
+			wantReplicas: 5,
+			wantResult:   ActionResult{Message: "scaled deployment nginx in namespace user-managed-dev from 4 to 5 replicas"},
+		},
+		{
+			name:         "min replicas reached",
+			replicas:     1,
+			value:        "-1",
+			wantReplicas: 1,
+			wantResult: ActionResult{
+				Result:  keptnv2.ResultFailed,
+				Message: "deployment nginx in namespace user-managed-dev already has 1 replicas, the limits are 1 to 5 replicas",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(newDeployment("user-managed-dev", "nginx", tt.replicas))
+			action := NewScaleDeploymentAction(clientset, WithReplicaLimits(1, 5))
+			req := newDecodedActionRequest(t, action, tt.value)
+
+			require.NoError(t, action.Validate(req))
+			result, err := action.Execute(context.Background(), sdk.NewFakeKeptn("test").Keptn, req)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.wantResult, result)
+			require.Equal(t, tt.wantReplicas, getDeploymentReplicas(t, clientset, "user-managed-dev", "nginx"))
+		})
+	}
+}
+
+func Test_ScaleDeploymentAction_NamespaceTemplate(t *testing.T) {
+	clientset := fake.NewSimpleClientset(newDeployment("dev", "nginx", 1))
+	namespace, err := ParseNamespaceTemplate("{{.Stage}}")
+	require.NoError(t, err)
+	action := NewScaleDeploymentAction(clientset, WithScaleNamespaceTemplate(namespace))
+
+	_, err = action.Execute(context.Background(), sdk.NewFakeKeptn("test").Keptn, newDecodedActionRequest(t, action, "1"))
+
+	require.NoError(t, err)
+	require.Equal(t, int32(2), getDeploymentReplicas(t, clientset, "dev", "nginx"))
+}
+
+func Test_ScaleDeploymentAction_Target(t *testing.T) {
+	clientset := fake.NewSimpleClientset(newDeployment("databases", "carts-db", 1))
+	action := NewScaleDeploymentAction(clientset)
+	req := newDecodedActionRequest(t, action, "1")
+	req.Target = ActionTarget{Name: "carts-db", Namespace: "databases"}
+
+	result, err := action.Execute(context.Background(), sdk.NewFakeKeptn("test").Keptn, req)
+
+	require.NoError(t, err)
+	require.Equal(t, "scaled deployment carts-db in namespace databases from 1 to 2 replicas", result.Message)
+	require.Equal(t, int32(2), getDeploymentReplicas(t, clientset, "databases", "carts-db"))
+}
+
+func Test_ScaleDeploymentAction_RetriesOnConflict(t *testing.T) {
+	clientset := fake.NewSimpleClientset(newDeployment("user-managed-dev", "nginx", 1))
+	conflicts := 1
+	clientset.PrependReactor("update", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if conflicts > 0 {
+			conflicts--
+			return true, nil, apierrors.NewConflict(schema.GroupResource{Group: "apps", Resource: "deployments"}, "nginx", errors.New("object was modified"))
+		}
+		return false, nil, nil
+	})
+
+	action := NewScaleDeploymentAction(clientset)
+	_, err := action.Execute(context.Background(), sdk.NewFakeKeptn("test").Keptn, newDecodedActionRequest(t, action, "1"))
+
+	require.NoError(t, err)
+	require.Equal(t, int32(2), getDeploymentReplicas(t, clientset, "user-managed-dev", "nginx"))
+}
+
+func Test_ScaleDeploymentAction_DeploymentNotFound(t *testing.T) {
+	action := NewScaleDeploymentAction(fake.NewSimpleClientset())
+
+	_, err := action.Execute(context.Background(), sdk.NewFakeKeptn("test").Keptn, newDecodedActionRequest(t, action, "1"))
+
+	require.EqualError(t, err, `could not scale deployment nginx in namespace user-managed-dev: deployments.apps "nginx" not found`)
+}
+
+func Test_ScaleDeploymentAction_Validate(t *testing.T) {
+	action := NewScaleDeploymentAction(fake.NewSimpleClientset())
+
+	require.NoError(t, action.Validate(newDecodedActionRequest(t, action, " 2 ")))
+	require.EqualError(t, action.Validate(newDecodedActionRequest(t, action, "0")), "value must not be 0")
+
+	for value, wantErr := range map[interface{}]string{
+		nil:    "value is required",
+		"two":  `value must be a number, got "two"`,
+		1.5:    "value must be an integer, got 1.5",
+		"2000": "value must be at most 1000, got 2000",
+	} {
+		_, err := decodeActionParameters(action, newActionRequest(t, value))
+		require.EqualError(t, err, wantErr)
+	}
+
+	namespace, err := ParseNamespaceTemplate("{{.Project}}_{{.Stage}}")
+	require.NoError(t, err)
+	action = NewScaleDeploymentAction(fake.NewSimpleClientset(), WithScaleNamespaceTemplate(namespace))
+	require.ErrorContains(t, action.Validate(newDecodedActionRequest(t, action, "1")), `invalid namespace "user-managed_dev"`)
+}
+
+func Test_NamespaceTemplate(t *testing.T) {
+	eventData := keptnv2.EventData{Project: "sockshop", Stage: "production", Service: "carts", Labels: map[string]string{"namespace": "shop"}}
+
+	namespace, err := defaultNamespaceTemplate().Namespace(eventData)
+	require.NoError(t, err)
+	require.Equal(t, "sockshop-production", namespace)
+
+	tmpl, err := ParseNamespaceTemplate(`{{index .Labels "namespace"}}`)
+	require.NoError(t, err)
+	namespace, err = tmpl.Namespace(eventData)
+	require.NoError(t, err)
+	require.Equal(t, "shop", namespace)
+
+	_, err = ParseNamespaceTemplate("{{.Project")
+	require.ErrorContains(t, err, `could not parse namespace template "{{.Project"`)
+
+	tmpl, err = ParseNamespaceTemplate("{{.Unknown}}")
+	require.NoError(t, err)
+	_, err = tmpl.Namespace(eventData)
+	require.ErrorContains(t, err, `could not render namespace template "{{.Unknown}}"`)
+}
@@ -0,0 +1,278 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	api "github.com/keptn/go-utils/pkg/api/utils"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/sdk"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const defaultScriptTimeout = 2 * time.Minute
+
+// scriptOutputTailLength limits the output of a script included in the action.finished event
+const scriptOutputTailLength = 1000
+
+// defaultScriptUser is the user and group scripts run as, nobody and nogroup
+const defaultScriptUser = 65534
+
+// scriptPath is the PATH of scripts, the environment of the service is not passed on
+const scriptPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+var nonEnvVarCharacters = regexp.MustCompile(`[^A-Z0-9_]`)
+
+// geteuid returns the user the service runs as, it is replaced by tests
+var geteuid = os.Geteuid
+
+// ScriptAction runs the shell script keptn-service-template-go/actions/<script>.sh from the config repo of the service.
+// The script does not inherit the environment of the service, it receives the event data as environment variables:
+//
+//	KEPTN_PROJECT, KEPTN_STAGE, KEPTN_SERVICE: project, stage and service of the event
+//	KEPTN_ACTION, KEPTN_ACTION_VALUE: the name and value of the action
+//	KEPTN_PROBLEM_TITLE, KEPTN_PROBLEM_ROOT_CAUSE: the problem that triggered the action
+//	KEPTN_LABEL_<NAME>: the labels of the event, e.g. KEPTN_LABEL_BUILD_ID for the label buildId
+//
+// The exit code of the script determines the result of the action, by default 0 is pass and everything else is fail.
+//
+// The script runs as an unprivileged user in a scratch working directory owned by that user, which is removed afterwards.
+// This requires the service to run as root. Files only readable by root, like the token of the service account mounted by
+// the chart of the service, and the environment of the service in /proc are not accessible by the script.
+// It still shares the file system and the network of the container
+type ScriptAction struct {
+	script      string
+	timeout     time.Duration
+	exitResults map[int]keptnv2.ResultType
+	credential  *syscall.Credential
+}
+
+// ScriptActionOption can be used to configure the ScriptAction
+type ScriptActionOption func(*ScriptAction)
+
+// WithScriptTimeout configures after which time the script is killed and the action fails
+func WithScriptTimeout(timeout time.Duration) ScriptActionOption {
+	return func(a *ScriptAction) {
+		if timeout > 0 {
+			a.timeout = timeout
+		}
+	}
+}
+
+// WithExitCodeResults configures the result reported for exit codes of the script, unlisted exit codes are reported as fail
+func WithExitCodeResults(exitResults map[int]keptnv2.ResultType) ScriptActionOption {
+	return func(a *ScriptAction) {
+		a.exitResults = exitResults
+	}
+}
+
+// WithScriptUser configures the unprivileged user and group scripts run as, the default is 65534 (nobody).
+// The root user is not accepted
+func WithScriptUser(uid uint32, gid uint32) ScriptActionOption {
+	return func(a *ScriptAction) {
+		if uid != 0 && gid != 0 {
+			a.credential = &syscall.Credential{Uid: uid, Gid: gid}
+		}
+	}
+}
+
+// NewScriptAction creates a new ScriptAction running the given script
+func NewScriptAction(script string, opts ...ScriptActionOption) *ScriptAction {
+	action := &ScriptAction{
+		script:      script,
+		timeout:     defaultScriptTimeout,
+		exitResults: map[int]keptnv2.ResultType{0: keptnv2.ResultPass},
+		credential:  &syscall.Credential{Uid: defaultScriptUser, Gid: defaultScriptUser},
+	}
+	for _, opt := range opts {
+		opt(action)
+	}
+	return action
+}
+
+// ParameterSchema returns the schema of the value, an optional string passed to the script as KEPTN_ACTION_VALUE
+func (a *ScriptAction) ParameterSchema() *ParameterSchema {
+	return &ParameterSchema{
+		Type:        ParameterTypeString,
+		Description: "passed to the script as KEPTN_ACTION_VALUE",
+		Optional:    true,
+	}
+}
+
+// NewParameters returns the value the string is decoded into
+func (a *ScriptAction) NewParameters() interface{} {
+	return new(string)
+}
+
+// Describe returns a description of the script execution
+func (a *ScriptAction) Describe(req ActionRequest) string {
+	return fmt.Sprintf("run script %s with a timeout of %s", a.resource(), a.timeout)
+}
+
+// Validate checks that the event contains everything needed to fetch the script
+func (a *ScriptAction) Validate(req ActionRequest) error {
+	if req.Event.Project == "" || req.Event.Stage == "" || req.Event.Service == "" {
+		return errors.New("project, stage and service must be set to fetch the script")
+	}
+	return nil
+}
+
+// Execute fetches and runs the script
+func (a *ScriptAction) Execute(ctx context.Context, k sdk.IKeptn, req ActionRequest) (ActionResult, error) {
+	resourceScope := *api.NewResourceScope().Project(req.Event.Project).Stage(req.Event.Stage).Service(req.Event.Service).Resource(a.resource())
+	resource, err := k.GetResourceHandler().GetResource(resourceScope)
+	if err != nil {
+		return ActionResult{}, fmt.Errorf("could not fetch %s: %w", a.resource(), err)
+	}
+	if resource == nil {
+		return ActionResult{}, fmt.Errorf("could not find %s", a.resource())
+	}
+
+	if geteuid() != 0 {
+		return ActionResult{}, fmt.Errorf("could not run script %s: the service must run as root to run scripts as user %d", a.resource(), a.credential.Uid)
+	}
+
+	workDir, err := ioutil.TempDir("", "action-")
+	if err != nil {
+		return ActionResult{}, fmt.Errorf("could not create working directory: %w", err)
+	}
+	defer os.RemoveAll(workDir)
+	if err := os.Chown(workDir, int(a.credential.Uid), int(a.credential.Gid)); err != nil {
+		return ActionResult{}, fmt.Errorf("could not create working directory: %w", err)
+	}
+
+	scriptFile := filepath.Join(workDir, "script.sh")
+	if err := ioutil.WriteFile(scriptFile, []byte(resource.ResourceContent), 0500); err != nil {
+		return ActionResult{}, fmt.Errorf("could not write script: %w", err)
+	}
+	if err := os.Chown(scriptFile, int(a.credential.Uid), int(a.credential.Gid)); err != nil {
+		return ActionResult{}, fmt.Errorf("could not write script: %w", err)
+	}
+
+	// the output is written to a file instead of a pipe, so waiting for the script does not block on
+	// background processes that keep the output open after the script was killed.
+	// It is kept outside of the working directory, so the script cannot replace it
+	outputFile, err := ioutil.TempFile("", "action-output-")
+	if err != nil {
+		return ActionResult{}, fmt.Errorf("could not create output file: %w", err)
+	}
+	defer os.Remove(outputFile.Name())
+	defer outputFile.Close()
+
+	scriptCtx, cancel := context.WithTimeout(ctx, a.timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(scriptCtx, "sh", scriptFile)
+	cmd.Dir = workDir
+	cmd.Env = scriptEnv(req, workDir)
+	cmd.Stdout = outputFile
+	cmd.Stderr = outputFile
+	// the script runs as the unprivileged user without the supplementary groups of the service
+	cmd.SysProcAttr = &syscall.SysProcAttr{Credential: a.credential}
+
+	k.Logger().Infof("Running script %s", a.resource())
+	runErr := cmd.Run()
+
+	output, err := ioutil.ReadFile(outputFile.Name())
+	if err != nil {
+		return ActionResult{}, fmt.Errorf("could not read output of script: %w", err)
+	}
+	tail := outputTail(string(output), scriptOutputTailLength)
+
+	if errors.Is(scriptCtx.Err(), context.DeadlineExceeded) {
+		return ActionResult{
+			Result:  keptnv2.ResultFailed,
+			Message: withOutput(fmt.Sprintf("script %s did not finish within %s", a.resource(), a.timeout), tail),
+		}, nil
+	}
+	if ctx.Err() != nil {
+		return ActionResult{}, ctx.Err()
+	}
+
+	exitCode := 0
+	if runErr != nil {
+		exitErr := &exec.ExitError{}
+		if !errors.As(runErr, &exitErr) {
+			return ActionResult{}, fmt.Errorf("could not run script %s: %w", a.resource(), runErr)
+		}
+		exitCode = exitErr.ExitCode()
+	}
+
+	result, ok := a.exitResults[exitCode]
+	if !ok {
+		result = keptnv2.ResultFailed
+	}
+	return ActionResult{
+		Result:  result,
+		Message: withOutput(fmt.Sprintf("script %s exited with code %d", a.resource(), exitCode), tail),
+	}, nil
+}
+
+// resource returns the location of the script in the config repo
+func (a *ScriptAction) resource() string {
+	return fmt.Sprintf("keptn-service-template-go/actions/%s.sh", a.script)
+}
+
+// scriptEnv returns the environment variables a script is run with
+func scriptEnv(req ActionRequest, workDir string) []string {
+	env := []string{
+		"PATH=" + scriptPath,
+		"HOME=" + workDir,
+		"TMPDIR=" + workDir,
+		"KEPTN_PROJECT=" + req.Event.Project,
+		"KEPTN_STAGE=" + req.Event.Stage,
+		"KEPTN_SERVICE=" + req.Event.Service,
+		"KEPTN_ACTION=" + req.Event.Action.Action,
+		"KEPTN_PROBLEM_TITLE=" + req.Event.Problem.ProblemTitle,
+		"KEPTN_PROBLEM_ROOT_CAUSE=" + req.Event.Problem.RootCause,
+		"KEPTN_TARGET_NAME=" + req.TargetName(),
+		"KEPTN_TARGET_NAMESPACE=" + req.Target.Namespace,
+	}
+	if value, ok := req.Parameters.(*string); ok && *value != "" {
+		env = append(env, "KEPTN_ACTION_VALUE="+*value)
+	}
+
+	labels := make([]string, 0, len(req.Event.Labels))
+	for name, value := range req.Event.Labels {
+		labels = append(labels, "KEPTN_LABEL_"+labelEnvVarName(name)+"="+value)
+	}
+	sort.Strings(labels)
+
+	return append(env, labels...)
+}
+
+// labelEnvVarName converts a label name to an environment variable name, e.g. buildId to BUILD_ID
+func labelEnvVarName(name string) string {
+	converted := strings.Builder{}
+	for i, r := range name {
+		if i > 0 && r >= 'A' && r <= 'Z' && name[i-1] >= 'a' && name[i-1] <= 'z' {
+			converted.WriteByte('_')
+		}
+		converted.WriteRune(r)
+	}
+	return nonEnvVarCharacters.ReplaceAllString(strings.ToUpper(converted.String()), "_")
+}
+
+// outputTail returns the last maxLength bytes of the given output
+func outputTail(output string, maxLength int) string {
+	output = strings.TrimSpace(output)
+	if len(output) <= maxLength {
+		return output
+	}
+	return "..." + output[len(output)-maxLength:]
+}
+
+func withOutput(message string, output string) string {
+	if output == "" {
+		return message
+	}
+	return message + ", output:\n" + output
+}
@@ -0,0 +1,150 @@
+package handler
+
+import (
+	"context"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/sdk"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// executeScriptAction runs the given script content as ScriptAction for the test action.triggered event
+func executeScriptAction(t *testing.T, content string, opts ...ScriptActionOption) (ActionResult, error) {
+	fakeKeptn := sdk.NewFakeKeptn("test")
+	fakeKeptn.SetResourceHandler(sdk.StringResourceHandler{ResourceContent: content})
+
+	action := NewScriptAction("restart-cache", opts...)
+	req := newDecodedActionRequest(t, action, "1")
+	req.Event.Problem = keptnv2.ProblemDetails{ProblemTitle: "Response time degradation", RootCause: "high load"}
+
+	require.NoError(t, action.Validate(req))
+	return action.Execute(context.Background(), fakeKeptn.Keptn, req)
+}
+
+func Test_ScriptAction_Execute(t *testing.T) {
+	tests := []struct {
+		name       string
+		script     string
+		opts       []ScriptActionOption
+		wantResult ActionResult
+	}{
+		{
+			name:   "script succeeds",
+			script: "echo restarting cache of $KEPTN_SERVICE",
+			wantResult: ActionResult{
+				Result:  keptnv2.ResultPass,
+				Message: "script keptn-service-template-go/actions/restart-cache.sh exited with code 0, output:\nrestarting cache of nginx",
+			},
+		},
+		{
+			name:   "script fails",
+			script: "echo cache not reachable >&2\nexit 3",
+			wantResult: ActionResult{
+				Result:  keptnv2.ResultFailed,
+				Message: "script keptn-service-template-go/actions/restart-cache.sh exited with code 3, output:\ncache not reachable",
+			},
+		},
+		{
+			name:   "exit code mapped to warning",
+			script: "exit 3",
+			opts:   []ScriptActionOption{WithExitCodeResults(map[int]keptnv2.ResultType{0: keptnv2.ResultPass, 3: keptnv2.ResultWarning})},
+			wantResult: ActionResult{
+				Result:  keptnv2.ResultWarning,
+				Message: "script keptn-service-template-go/actions/restart-cache.sh exited with code 3",
+			},
+		},
+		{
+			name:   "script times out",
+			script: "echo waiting\nsleep 10",
+			opts:   []ScriptActionOption{WithScriptTimeout(100 * time.Millisecond)},
+			wantResult: ActionResult{
+				Result:  keptnv2.ResultFailed,
+				Message: "script keptn-service-template-go/actions/restart-cache.sh did not finish within 100ms, output:\nwaiting",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := executeScriptAction(t, tt.script, tt.opts...)
+
+			require.NoError(t, err)
+			require.Equal(t, tt.wantResult, result)
+		})
+	}
+}
+
+func Test_ScriptAction_Environment(t *testing.T) {
+	t.Setenv("KEPTN_API_TOKEN", "secret")
+
+	result, err := executeScriptAction(t, "env | grep -v '^PWD=\\|^SHLVL=\\|^_=' | sort")
+
+	require.NoError(t, err)
+	output := strings.SplitN(result.Message, "\n", 2)[1]
+	require.NotContains(t, output, "secret")
+	require.Contains(t, output, "KEPTN_PROJECT=user-managed\n")
+	require.Contains(t, output, "KEPTN_STAGE=dev\n")
+	require.Contains(t, output, "KEPTN_SERVICE=nginx\n")
+	require.Contains(t, output, "KEPTN_ACTION=action-xyz\n")
+	require.Contains(t, output, "KEPTN_ACTION_VALUE=1\n")
+	require.Contains(t, output, "KEPTN_PROBLEM_TITLE=Response time degradation\n")
+	require.Contains(t, output, "KEPTN_PROBLEM_ROOT_CAUSE=high load\n")
+	require.Contains(t, output, "KEPTN_TARGET_NAME=nginx\n")
+	require.Contains(t, output, "KEPTN_TARGET_NAMESPACE=\n")
+	require.Contains(t, output, "KEPTN_LABEL_BUILD_ID=build-17\n")
+	require.Contains(t, output, "KEPTN_LABEL_TEST_ID=4711\n")
+	require.Contains(t, output, "KEPTN_LABEL_OWNER=JohnDoe")
+}
+
+func Test_ScriptAction_Unprivileged(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip("scripts can only be run as an unprivileged user by root")
+	}
+	secret := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, ioutil.WriteFile(secret, []byte("secret"), 0400))
+
+	result, err := executeScriptAction(t, "id -u\nid -G\ntouch file && pwd\ncat "+secret+" || exit 1", WithScriptUser(1234, 5678))
+
+	require.NoError(t, err)
+	require.Equal(t, keptnv2.ResultFailed, result.Result)
+	lines := strings.Split(strings.SplitN(result.Message, "\n", 2)[1], "\n")
+	require.Equal(t, []string{"1234", "5678"}, lines[:2])
+	require.True(t, strings.HasPrefix(lines[2], filepath.Join(os.TempDir(), "action-")))
+	require.Contains(t, lines[3], "Permission denied")
+}
+
+func Test_ScriptAction_NotRoot(t *testing.T) {
+	defer func(original func() int) { geteuid = original }(geteuid)
+	geteuid = func() int { return 1000 }
+
+	_, err := executeScriptAction(t, "exit 0")
+
+	require.EqualError(t, err, "could not run script keptn-service-template-go/actions/restart-cache.sh: the service must run as root to run scripts as user 65534")
+}
+
+func Test_ScriptAction_OutputTail(t *testing.T) {
+	result, err := executeScriptAction(t, "i=0; while [ $i -lt 500 ]; do echo line $i; i=$((i+1)); done")
+
+	require.NoError(t, err)
+	require.True(t, strings.HasSuffix(result.Message, "line 498\nline 499"))
+	require.Less(t, len(result.Message), scriptOutputTailLength+100)
+}
+
+func Test_ScriptAction_ScriptNotFound(t *testing.T) {
+	fakeKeptn := sdk.NewFakeKeptn("test")
+
+	_, err := NewScriptAction("unknown").Execute(context.Background(), fakeKeptn.Keptn, newActionRequest(t, nil))
+
+	require.EqualError(t, err, "could not find keptn-service-template-go/actions/unknown.sh")
+}
+
+func Test_labelEnvVarName(t *testing.T) {
+	require.Equal(t, "BUILD_ID", labelEnvVarName("buildId"))
+	require.Equal(t, "OWNER", labelEnvVarName("owner"))
+	require.Equal(t, "APP_KUBERNETES_IO_NAME", labelEnvVarName("app.kubernetes.io/name"))
+	require.Equal(t, "HTTP_URL", labelEnvVarName("HTTP-url"))
+}
@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SLIQuery describes the value of a single indicator that shall be retrieved from an SLIBackend
+type SLIQuery struct {
+	// Indicator is the name of the indicator
+	Indicator string
+	// Query is the query defined in sli.yaml with all placeholders expanded
+	Query string
+	// Definition is the complete definition of the indicator in sli.yaml with all placeholders expanded
+	Definition SLIIndicator
+	// Start and End define the time window the indicator is evaluated for
+	Start time.Time
+	End   time.Time
+	// Filters contains the custom filters of the get-sli.triggered event
+	Filters map[string]string
+	// Credentials contains the credentials for the project of the event, nil if there are none
+	Credentials Credentials
+}
+
+// SLIBackend retrieves SLI values from a monitoring tool
+type SLIBackend interface {
+	// GetSLIValue returns the value of the given query. The context carries the deadline of the query
+	GetSLIValue(ctx context.Context, query SLIQuery) (float64, error)
+}
+
+// SLIBackendRegistry maps sliProvider names to the SLIBackend answering get-sli events for them
+type SLIBackendRegistry struct {
+	mutex    sync.RWMutex
+	backends map[string]SLIBackend
+}
+
+// NewSLIBackendRegistry creates a new, empty SLIBackendRegistry
+func NewSLIBackendRegistry() *SLIBackendRegistry {
+	return &SLIBackendRegistry{
+		backends: map[string]SLIBackend{},
+	}
+}
+
+// Register makes the backend responsible for get-sli events of the given sliProvider.
+// An already registered backend for the same sliProvider is replaced
+func (r *SLIBackendRegistry) Register(sliProvider string, backend SLIBackend) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.backends[sliProvider] = backend
+}
+
+// Get returns the backend registered for the given sliProvider
+func (r *SLIBackendRegistry) Get(sliProvider string) (SLIBackend, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	backend, ok := r.backends[sliProvider]
+	return backend, ok
+}
+
+// Providers returns the sorted names of all registered sliProviders
+func (r *SLIBackendRegistry) Providers() []string {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	providers := make([]string, 0, len(r.backends))
+	for provider := range r.backends {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+	return providers
+}
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// sliBackendFunc allows using a function as SLIBackend in tests
+type sliBackendFunc func(ctx context.Context, query SLIQuery) (float64, error)
+
+func (f sliBackendFunc) GetSLIValue(ctx context.Context, query SLIQuery) (float64, error) {
+	return f(ctx, query)
+}
+
+// constantSLIBackend returns an SLIBackend answering every query with the given value
+func constantSLIBackend(value float64) SLIBackend {
+	return sliBackendFunc(func(ctx context.Context, query SLIQuery) (float64, error) {
+		return value, nil
+	})
+}
+
+func Test_SLIBackendRegistry(t *testing.T) {
+	registry := NewSLIBackendRegistry()
+
+	_, ok := registry.Get("prometheus")
+	require.False(t, ok)
+	require.Empty(t, registry.Providers())
+
+	first := constantSLIBackend(1)
+	second := constantSLIBackend(2)
+	registry.Register("prometheus", first)
+	registry.Register("in-house", second)
+
+	backend, ok := registry.Get("prometheus")
+	require.True(t, ok)
+	value, err := backend.GetSLIValue(context.Background(), SLIQuery{})
+	require.NoError(t, err)
+	require.Equal(t, float64(1), value)
+
+	registry.Register("prometheus", second)
+	backend, _ = registry.Get("prometheus")
+	value, err = backend.GetSLIValue(context.Background(), SLIQuery{})
+	require.NoError(t, err)
+	require.Equal(t, float64(2), value)
+
+	require.Equal(t, []string{"in-house", "prometheus"}, registry.Providers())
+}
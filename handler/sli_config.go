@@ -0,0 +1,167 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// sliFile is the location of the SLI configuration within the config repo of a service
+const sliFile = "keptn-service-template-go/sli.yaml"
+
+// SLIConfig represents the content of the sli.yaml file stored in the config repo
+type SLIConfig struct {
+	SpecVersion string                  `yaml:"spec_version"`
+	Indicators  map[string]SLIIndicator `yaml:"indicators"`
+}
+
+// SLIIndicator defines how the value of an indicator is retrieved.
+// It is either a query (e.g. PromQL) or an HTTP request returning a JSON document the value is extracted from.
+// An indicator given as plain string in sli.yaml is treated as query
+type SLIIndicator struct {
+	Query    string            `yaml:"query,omitempty"`
+	Method   string            `yaml:"method,omitempty"`
+	URL      string            `yaml:"url,omitempty"`
+	Headers  map[string]string `yaml:"headers,omitempty"`
+	Body     string            `yaml:"body,omitempty"`
+	JSONPath string            `yaml:"jsonPath,omitempty"`
+}
+
+// UnmarshalYAML allows defining an indicator either as plain query string or as mapping
+func (i *SLIIndicator) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		return value.Decode(&i.Query)
+	}
+
+	// decode into an alias type to avoid calling UnmarshalYAML recursively
+	type plain SLIIndicator
+	return value.Decode((*plain)(i))
+}
+
+// IsHTTPRequest returns true if the value of the indicator is retrieved using an HTTP request
+func (i SLIIndicator) IsHTTPRequest() bool {
+	return i.URL != ""
+}
+
+// String returns the query or the method and url of the indicator. Headers and body are omitted as they may contain credentials
+func (i SLIIndicator) String() string {
+	if !i.IsHTTPRequest() {
+		return i.Query
+	}
+	method := i.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+	return strings.ToUpper(method) + " " + i.URL
+}
+
+// validate checks that the indicator either defines a query or a complete HTTP request
+func (i SLIIndicator) validate() error {
+	if !i.IsHTTPRequest() {
+		if strings.TrimSpace(i.Query) == "" {
+			return errors.New("has an empty query")
+		}
+		return nil
+	}
+
+	if i.Query != "" {
+		return errors.New("must not define both a query and a url")
+	}
+	switch strings.ToUpper(i.Method) {
+	case "", http.MethodGet, http.MethodPost, http.MethodPut:
+	default:
+		return fmt.Errorf("has unsupported method %s", i.Method)
+	}
+	if strings.TrimSpace(i.JSONPath) == "" {
+		return errors.New("must define a jsonPath")
+	}
+	if _, err := parseJSONPath(i.JSONPath); err != nil {
+		return fmt.Errorf("has an invalid jsonPath: %w", err)
+	}
+	return nil
+}
+
+// expand replaces the placeholders in all fields of the indicator
+func (i SLIIndicator) expand(placeholders SLIQueryPlaceholders) (SLIIndicator, error) {
+	var err error
+	expanded := SLIIndicator{
+		Method:   i.Method,
+		JSONPath: i.JSONPath,
+	}
+
+	if expanded.Query, err = placeholders.Expand(i.Query); err != nil {
+		return SLIIndicator{}, err
+	}
+	if expanded.URL, err = placeholders.ExpandURL(i.URL); err != nil {
+		return SLIIndicator{}, err
+	}
+	if expanded.Body, err = placeholders.Expand(i.Body); err != nil {
+		return SLIIndicator{}, err
+	}
+
+	if i.Headers != nil {
+		expanded.Headers = map[string]string{}
+		for name, value := range i.Headers {
+			if expanded.Headers[name], err = placeholders.Expand(value); err != nil {
+				return SLIIndicator{}, err
+			}
+		}
+	}
+
+	return expanded, nil
+}
+
+// ParseSLIConfig parses and validates the content of an sli.yaml file
+func ParseSLIConfig(content []byte) (*SLIConfig, error) {
+	config := &SLIConfig{}
+	if err := yaml.Unmarshal(content, config); err != nil {
+		return nil, fmt.Errorf("could not parse SLI config: %w", err)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+// Validate checks that the SLI config declares a spec version and a valid definition for every indicator
+func (c *SLIConfig) Validate() error {
+	if strings.TrimSpace(c.SpecVersion) == "" {
+		return errors.New("invalid SLI config: spec_version must be set")
+	}
+
+	if len(c.Indicators) == 0 {
+		return errors.New("invalid SLI config: no indicators defined")
+	}
+
+	// iterate in a stable order so the reported indicator does not change between runs
+	names := make([]string, 0, len(c.Indicators))
+	for name := range c.Indicators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if strings.TrimSpace(name) == "" {
+			return errors.New("invalid SLI config: indicator name must not be empty")
+		}
+		if err := c.Indicators[name].validate(); err != nil {
+			return fmt.Errorf("invalid SLI config: indicator %s %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// GetIndicator returns the definition of the given indicator
+func (c *SLIConfig) GetIndicator(indicator string) (SLIIndicator, error) {
+	definition, ok := c.Indicators[indicator]
+	if !ok {
+		return SLIIndicator{}, fmt.Errorf("no query defined for indicator %s in %s", indicator, sliFile)
+	}
+	return definition, nil
+}
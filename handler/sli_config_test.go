@@ -0,0 +1,176 @@
+package handler
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func Test_ParseSLIConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		wantErr    string
+		wantConfig *SLIConfig
+	}{
+		{
+			name: "valid config",
+			content: `---
+spec_version: '1.0'
+indicators:
+  response_time_p95: "histogram_quantile(0.95, sum(rate(http_response_time_bucket[$DURATION])) by (le))"
+  throughput: "sum(rate(http_requests_total[$DURATION]))"
+`,
+			wantConfig: &SLIConfig{
+				SpecVersion: "1.0",
+				Indicators: map[string]SLIIndicator{
+					"response_time_p95": {Query: "histogram_quantile(0.95, sum(rate(http_response_time_bucket[$DURATION])) by (le))"},
+					"throughput":        {Query: "sum(rate(http_requests_total[$DURATION]))"},
+				},
+			},
+		},
+		{
+			name: "http indicator",
+			content: `---
+spec_version: '1.0'
+indicators:
+  open_tickets:
+    method: POST
+    url: "https://tickets.example.com/api/stats"
+    headers:
+      Content-Type: application/json
+    body: '{"service": "$SERVICE"}'
+    jsonPath: "$.data.open"
+`,
+			wantConfig: &SLIConfig{
+				SpecVersion: "1.0",
+				Indicators: map[string]SLIIndicator{
+					"open_tickets": {
+						Method:   "POST",
+						URL:      "https://tickets.example.com/api/stats",
+						Headers:  map[string]string{"Content-Type": "application/json"},
+						Body:     `{"service": "$SERVICE"}`,
+						JSONPath: "$.data.open",
+					},
+				},
+			},
+		},
+		{
+			name: "http indicator without jsonPath",
+			content: `spec_version: '1.0'
+indicators:
+  open_tickets:
+    url: "https://tickets.example.com/api/stats"
+`,
+			wantErr: "indicator open_tickets must define a jsonPath",
+		},
+		{
+			name: "http indicator with invalid jsonPath",
+			content: `spec_version: '1.0'
+indicators:
+  open_tickets:
+    url: "https://tickets.example.com/api/stats"
+    jsonPath: "data.open"
+`,
+			wantErr: "indicator open_tickets has an invalid jsonPath: expression must start with $",
+		},
+		{
+			name: "http indicator with unsupported method",
+			content: `spec_version: '1.0'
+indicators:
+  open_tickets:
+    method: DELETE
+    url: "https://tickets.example.com/api/stats"
+    jsonPath: "$.open"
+`,
+			wantErr: "indicator open_tickets has unsupported method DELETE",
+		},
+		{
+			name: "query and url",
+			content: `spec_version: '1.0'
+indicators:
+  open_tickets:
+    query: "up"
+    url: "https://tickets.example.com/api/stats"
+    jsonPath: "$.open"
+`,
+			wantErr: "indicator open_tickets must not define both a query and a url",
+		},
+		{
+			name:    "invalid yaml",
+			content: "indicators: [",
+			wantErr: "could not parse SLI config",
+		},
+		{
+			name: "missing spec version",
+			content: `indicators:
+  throughput: "sum(rate(http_requests_total[5m]))"
+`,
+			wantErr: "spec_version must be set",
+		},
+		{
+			name:    "no indicators",
+			content: "spec_version: '1.0'\n",
+			wantErr: "no indicators defined",
+		},
+		{
+			name: "empty query",
+			content: `spec_version: '1.0'
+indicators:
+  throughput: "sum(rate(http_requests_total[5m]))"
+  error_rate: ""
+`,
+			wantErr: "indicator error_rate has an empty query",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ParseSLIConfig([]byte(tt.content))
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantConfig, config)
+		})
+	}
+}
+
+func Test_SLIConfig_GetIndicator(t *testing.T) {
+	config := &SLIConfig{
+		SpecVersion: "1.0",
+		Indicators:  map[string]SLIIndicator{"throughput": {Query: "sum(rate(http_requests_total[5m]))"}},
+	}
+
+	definition, err := config.GetIndicator("throughput")
+	require.NoError(t, err)
+	require.Equal(t, SLIIndicator{Query: "sum(rate(http_requests_total[5m]))"}, definition)
+
+	_, err = config.GetIndicator("response_time_p95")
+	require.EqualError(t, err, "no query defined for indicator response_time_p95 in keptn-service-template-go/sli.yaml")
+}
+
+func Test_SLIIndicator_expand(t *testing.T) {
+	placeholders := SLIQueryPlaceholders{"SERVICE": "carts", "token": "secret", "injection": "} or {"}
+
+	expanded, err := SLIIndicator{
+		Method:   "POST",
+		URL:      "https://tickets.example.com/api/$SERVICE/stats",
+		Headers:  map[string]string{"Authorization": "Bearer $token"},
+		Body:     `{"service": "$SERVICE"}`,
+		JSONPath: "$.data.open",
+	}.expand(placeholders)
+
+	require.NoError(t, err)
+	require.Equal(t, SLIIndicator{
+		Method:   "POST",
+		URL:      "https://tickets.example.com/api/carts/stats",
+		Headers:  map[string]string{"Authorization": "Bearer secret"},
+		Body:     `{"service": "carts"}`,
+		JSONPath: "$.data.open",
+	}, expanded)
+	require.Equal(t, "POST https://tickets.example.com/api/carts/stats", expanded.String())
+
+	_, err = SLIIndicator{URL: "https://tickets.example.com/api/$token", Body: "$injection", JSONPath: "$.open"}.expand(placeholders)
+	require.ErrorContains(t, err, "invalid value for placeholder $injection")
+}
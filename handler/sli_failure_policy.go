@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"fmt"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"strings"
+)
+
+// SLIFailurePolicy determines the result of a get-sli.finished event when some of the indicators could not be retrieved
+type SLIFailurePolicy string
+
+const (
+	// SLIFailurePolicyWarning reports a warning if some indicators failed and fails only if all indicators failed
+	SLIFailurePolicyWarning SLIFailurePolicy = "warning"
+	// SLIFailurePolicyFail fails as soon as a single indicator failed
+	SLIFailurePolicyFail SLIFailurePolicy = "fail"
+)
+
+// ParseSLIFailurePolicy returns the SLIFailurePolicy with the given name
+func ParseSLIFailurePolicy(name string) (SLIFailurePolicy, error) {
+	switch policy := SLIFailurePolicy(strings.ToLower(name)); policy {
+	case SLIFailurePolicyWarning, SLIFailurePolicyFail:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown SLI failure policy %q, expected %q or %q", name, SLIFailurePolicyWarning, SLIFailurePolicyFail)
+	}
+}
+
+// evaluate returns the overall result and message for the given SLI results
+func (p SLIFailurePolicy) evaluate(sliResults []*keptnv2.SLIResult) (keptnv2.ResultType, string) {
+	var failed []string
+	for _, sliResult := range sliResults {
+		if !sliResult.Success {
+			failed = append(failed, sliResult.Metric)
+		}
+	}
+
+	if len(failed) == 0 {
+		return keptnv2.ResultPass, ""
+	}
+
+	message := fmt.Sprintf("%d of %d indicators could not be retrieved: %s", len(failed), len(sliResults), strings.Join(failed, ", "))
+	if p == SLIFailurePolicyWarning && len(failed) < len(sliResults) {
+		return keptnv2.ResultWarning, message
+	}
+	return keptnv2.ResultFailed, message
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func Test_ParseSLIFailurePolicy(t *testing.T) {
+	policy, err := ParseSLIFailurePolicy("Fail")
+	require.NoError(t, err)
+	require.Equal(t, SLIFailurePolicyFail, policy)
+
+	policy, err = ParseSLIFailurePolicy("warning")
+	require.NoError(t, err)
+	require.Equal(t, SLIFailurePolicyWarning, policy)
+
+	_, err = ParseSLIFailurePolicy("ignore")
+	require.EqualError(t, err, `unknown SLI failure policy "ignore", expected "warning" or "fail"`)
+}
+
+func Test_SLIFailurePolicy_evaluate(t *testing.T) {
+	succeeded := &keptnv2.SLIResult{Metric: "throughput", Value: 10, Success: true}
+	failed := &keptnv2.SLIResult{Metric: "response_time_p95", Success: false, Message: "query returned no result"}
+
+	tests := []struct {
+		name        string
+		policy      SLIFailurePolicy
+		sliResults  []*keptnv2.SLIResult
+		wantResult  keptnv2.ResultType
+		wantMessage string
+	}{
+		{
+			name:       "all succeeded",
+			policy:     SLIFailurePolicyFail,
+			sliResults: []*keptnv2.SLIResult{succeeded, succeeded},
+			wantResult: keptnv2.ResultPass,
+		},
+		{
+			name:        "partial failure with warning policy",
+			policy:      SLIFailurePolicyWarning,
+			sliResults:  []*keptnv2.SLIResult{succeeded, failed},
+			wantResult:  keptnv2.ResultWarning,
+			wantMessage: "1 of 2 indicators could not be retrieved: response_time_p95",
+		},
+		{
+			name:        "all failed with warning policy",
+			policy:      SLIFailurePolicyWarning,
+			sliResults:  []*keptnv2.SLIResult{failed},
+			wantResult:  keptnv2.ResultFailed,
+			wantMessage: "1 of 1 indicators could not be retrieved: response_time_p95",
+		},
+		{
+			name:        "partial failure with fail policy",
+			policy:      SLIFailurePolicyFail,
+			sliResults:  []*keptnv2.SLIResult{succeeded, failed},
+			wantResult:  keptnv2.ResultFailed,
+			wantMessage: "1 of 2 indicators could not be retrieved: response_time_p95",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, message := tt.policy.evaluate(tt.sliResults)
+			require.Equal(t, tt.wantResult, result)
+			require.Equal(t, tt.wantMessage, message)
+		})
+	}
+}
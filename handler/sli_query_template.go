@@ -0,0 +1,206 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// labelPlaceholderPrefix is the prefix of placeholders referring to a label of the get-sli.triggered event, e.g. $LABEL.buildId
+const labelPlaceholderPrefix = "LABEL."
+
+// unquotedValuePattern restricts values that are substituted outside a quoted string, where escaping is not possible
+var unquotedValuePattern = regexp.MustCompile(`^[a-zA-Z0-9_.:/-]*$`)
+
+// SLIQueryPlaceholders maps placeholder names (without the leading $) to the values they are replaced with
+type SLIQueryPlaceholders map[string]string
+
+// NewSLIQueryPlaceholders creates the placeholders available in the SLI queries for the given get-sli.triggered event:
+// $PROJECT, $STAGE, $SERVICE, $DEPLOYMENT, $DURATION (length of the time window in seconds, e.g. 300s),
+// $LABEL.<name> for each label and $<key> for each custom filter.
+// Custom filters cannot override the standard placeholders.
+func NewSLIQueryPlaceholders(sliTriggeredEvent keptnv2.GetSLITriggeredEventData, start, end time.Time) SLIQueryPlaceholders {
+	placeholders := SLIQueryPlaceholders{}
+
+	for _, filter := range sliTriggeredEvent.GetSLI.CustomFilters {
+		if filter == nil {
+			continue
+		}
+		placeholders[filter.Key] = filter.Value
+	}
+
+	for name, value := range sliTriggeredEvent.Labels {
+		placeholders[labelPlaceholderPrefix+name] = value
+	}
+
+	placeholders["PROJECT"] = sliTriggeredEvent.Project
+	placeholders["STAGE"] = sliTriggeredEvent.Stage
+	placeholders["SERVICE"] = sliTriggeredEvent.Service
+	placeholders["DEPLOYMENT"] = sliTriggeredEvent.Deployment
+	placeholders["DURATION"] = fmt.Sprintf("%ds", int64(end.Sub(start).Seconds()))
+
+	return placeholders
+}
+
+// Expand replaces all placeholders in the given query.
+// Values substituted within a quoted string are escaped, values substituted outside of a quoted string must not contain
+// characters that could alter the structure of the query. A $ that does not start a known placeholder is kept as is,
+// $$ can be used to insert a literal $ in front of the name of a placeholder.
+func (p SLIQueryPlaceholders) Expand(query string) (string, error) {
+	var result strings.Builder
+	var quote rune
+
+	runes := []rune(query)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case r == '$':
+			if i+1 < len(runes) && runes[i+1] == '$' {
+				result.WriteRune('$')
+				i++
+				continue
+			}
+
+			name := placeholderName(runes[i+1:])
+			value, ok := p[name]
+			if !ok {
+				// a $ that is no known placeholder is kept, e.g. the end anchor of a regular expression
+				break
+			}
+
+			escaped, err := escapePlaceholderValue(value, quote)
+			if err != nil {
+				return "", fmt.Errorf("invalid value for placeholder $%s: %w", name, err)
+			}
+			result.WriteString(escaped)
+			i += len([]rune(name))
+			continue
+		case quote != 0 && r == '\\' && quote != '`':
+			// keep escape sequences of the query itself untouched
+			result.WriteRune(r)
+			if i+1 < len(runes) {
+				result.WriteRune(runes[i+1])
+				i++
+			}
+			continue
+		case quote == 0 && (r == '"' || r == '\'' || r == '`'):
+			quote = r
+		case quote != 0 && r == quote:
+			quote = 0
+		}
+
+		result.WriteRune(r)
+	}
+
+	return result.String(), nil
+}
+
+// ExpandURL replaces all placeholders in the given URL. Values are escaped for the part of the URL they are inserted into,
+// so that they cannot change its structure, e.g. a value inserted into the path cannot add or remove path segments.
+// The expanded URL must not contain .. segments.
+func (p SLIQueryPlaceholders) ExpandURL(rawURL string) (string, error) {
+	var result strings.Builder
+	escape := url.PathEscape
+
+	runes := []rune(rawURL)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+
+		switch {
+		case r == '$':
+			if i+1 < len(runes) && runes[i+1] == '$' {
+				result.WriteRune('$')
+				i++
+				continue
+			}
+
+			name := placeholderName(runes[i+1:])
+			if value, ok := p[name]; ok {
+				result.WriteString(escape(value))
+				i += len([]rune(name))
+				continue
+			}
+		case r == '?' || r == '#':
+			escape = url.QueryEscape
+		}
+
+		result.WriteRune(r)
+	}
+
+	expanded, err := url.Parse(result.String())
+	if err != nil {
+		return "", fmt.Errorf("invalid url: %w", err)
+	}
+	for _, segment := range strings.Split(expanded.Path, "/") {
+		if segment == ".." {
+			return "", fmt.Errorf("url %s must not contain .. segments", expanded.Redacted())
+		}
+	}
+	return result.String(), nil
+}
+
+// placeholderName returns the name of the placeholder at the beginning of the given runes
+func placeholderName(runes []rune) string {
+	name := identifierPrefix(runes)
+	if name+"." != labelPlaceholderPrefix || len(runes) <= len(name) || runes[len(name)] != '.' {
+		return name
+	}
+
+	// label names may contain characters that are not allowed in other placeholders
+	end := len(labelPlaceholderPrefix)
+	for end < len(runes) && (isIdentifierRune(runes[end]) || runes[end] == '-' || runes[end] == '.') {
+		end++
+	}
+	labelPlaceholder := strings.TrimRight(string(runes[:end]), ".")
+	if labelPlaceholder+"." == labelPlaceholderPrefix {
+		return name
+	}
+	return labelPlaceholder
+}
+
+func identifierPrefix(runes []rune) string {
+	end := 0
+	for end < len(runes) && isIdentifierRune(runes[end]) {
+		if end == 0 && unicode.IsDigit(runes[end]) {
+			return ""
+		}
+		end++
+	}
+	return string(runes[:end])
+}
+
+func isIdentifierRune(r rune) bool {
+	return r == '_' || r <= unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// escapePlaceholderValue escapes a value depending on the kind of quoted string it is inserted into
+func escapePlaceholderValue(value string, quote rune) (string, error) {
+	for _, r := range value {
+		if unicode.IsControl(r) {
+			return "", errors.New("control characters are not allowed")
+		}
+	}
+
+	switch quote {
+	case 0:
+		if !unquotedValuePattern.MatchString(value) {
+			return "", fmt.Errorf("%q may only contain alphanumeric characters and _.:/- outside of a quoted string", value)
+		}
+		return value, nil
+	case '`':
+		// raw strings do not support escaping
+		if strings.ContainsRune(value, '`') {
+			return "", fmt.Errorf("%q must not contain a backtick", value)
+		}
+		return value, nil
+	default:
+		value = strings.ReplaceAll(value, `\`, `\\`)
+		return strings.ReplaceAll(value, string(quote), `\`+string(quote)), nil
+	}
+}
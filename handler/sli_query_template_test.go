@@ -0,0 +1,194 @@
+package handler
+
+import (
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func Test_NewSLIQueryPlaceholders(t *testing.T) {
+	start := time.Date(2021, 1, 15, 15, 4, 45, 0, time.UTC)
+	end := time.Date(2021, 1, 15, 15, 9, 45, 0, time.UTC)
+
+	placeholders := NewSLIQueryPlaceholders(keptnv2.GetSLITriggeredEventData{
+		EventData: keptnv2.EventData{
+			Project: "sockshop",
+			Stage:   "staging",
+			Service: "carts",
+			Labels:  map[string]string{"buildId": "build-17"},
+		},
+		Deployment: "canary",
+		GetSLI: keptnv2.GetSLI{
+			CustomFilters: []*keptnv2.SLIFilter{
+				{Key: "handler", Value: "ItemsController"},
+				{Key: "PROJECT", Value: "other-project"},
+				nil,
+			},
+		},
+	}, start, end)
+
+	require.Equal(t, SLIQueryPlaceholders{
+		"PROJECT":       "sockshop",
+		"STAGE":         "staging",
+		"SERVICE":       "carts",
+		"DEPLOYMENT":    "canary",
+		"DURATION":      "300s",
+		"LABEL.buildId": "build-17",
+		"handler":       "ItemsController",
+	}, placeholders)
+}
+
+func Test_SLIQueryPlaceholders_Expand(t *testing.T) {
+	placeholders := SLIQueryPlaceholders{
+		"PROJECT":        "sockshop",
+		"STAGE":          "staging",
+		"SERVICE":        "carts",
+		"DURATION":       "300s",
+		"LABEL.build-id": "build-17",
+		"handler":        "ItemsController",
+		"injection":      `"} or vector(1) or {x="`,
+		"path":           `C:\temp`,
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    string
+		wantErr string
+	}{
+		{
+			name:  "standard placeholders",
+			query: `sum(rate(http_requests_total{job="$SERVICE-$PROJECT-$STAGE"}[$DURATION]))`,
+			want:  `sum(rate(http_requests_total{job="carts-sockshop-staging"}[300s]))`,
+		},
+		{
+			name:  "label and custom filter placeholders",
+			query: `sum(rate(http_requests_total{build="$LABEL.build-id",handler="$handler"}[$DURATION]))`,
+			want:  `sum(rate(http_requests_total{build="build-17",handler="ItemsController"}[300s]))`,
+		},
+		{
+			name:  "placeholder followed by a dot",
+			query: `label_replace(up, "svc", "$SERVICE.$STAGE", "", "")`,
+			want:  `label_replace(up, "svc", "carts.staging", "", "")`,
+		},
+		{
+			name:  "literal dollar",
+			query: `label_replace(up, "a", "$$1", "b", "(.*)")`,
+			want:  `label_replace(up, "a", "$1", "b", "(.*)")`,
+		},
+		{
+			name:  "value is escaped within double quotes",
+			query: `up{job="$injection"}`,
+			want:  `up{job="\"} or vector(1) or {x=\""}`,
+		},
+		{
+			name:  "value is escaped within single quotes",
+			query: `up{path='$path'}`,
+			want:  `up{path='C:\\temp'}`,
+		},
+		{
+			name:  "escaped quote in query does not end the string",
+			query: `up{job="a\"$SERVICE"}`,
+			want:  `up{job="a\"carts"}`,
+		},
+		{
+			name:    "value with special characters outside of quotes",
+			query:   `up{job="x"} or $injection`,
+			wantErr: "invalid value for placeholder $injection",
+		},
+		{
+			name:  "unknown placeholder is kept",
+			query: `up{job="$UNKNOWN"}`,
+			want:  `up{job="$UNKNOWN"}`,
+		},
+		{
+			name:  "unknown label is kept",
+			query: `up{job="$LABEL.owner"}`,
+			want:  `up{job="$LABEL.owner"}`,
+		},
+		{
+			name:  "regular expression anchor",
+			query: `up{job=~"^$SERVICE$",instance=~".*:8080$"}`,
+			want:  `up{job=~"^carts$",instance=~".*:8080$"}`,
+		},
+		{
+			name:  "dangling dollar",
+			query: `up{job="$"} $`,
+			want:  `up{job="$"} $`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := placeholders.Expand(tt.query)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func Test_SLIQueryPlaceholders_Expand_RejectsControlCharacters(t *testing.T) {
+	placeholders := SLIQueryPlaceholders{"handler": "a\nb"}
+
+	_, err := placeholders.Expand(`up{handler="$handler"}`)
+	require.EqualError(t, err, "invalid value for placeholder $handler: control characters are not allowed")
+}
+
+func Test_SLIQueryPlaceholders_ExpandURL(t *testing.T) {
+	placeholders := SLIQueryPlaceholders{
+		"SERVICE":      "carts",
+		"LABEL.owner":  "John Doe & Co",
+		"LABEL.path":   "../admin",
+		"LABEL.slash":  "team/carts",
+		"LABEL.dotted": "v1.2",
+	}
+
+	tests := []struct {
+		name    string
+		url     string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "path and query",
+			url:  "https://tickets.example.com/api/$SERVICE/stats?owner=$LABEL.owner&release=$LABEL.dotted",
+			want: "https://tickets.example.com/api/carts/stats?owner=John+Doe+%26+Co&release=v1.2",
+		},
+		{
+			name: "slashes are escaped within the path",
+			url:  "https://tickets.example.com/api/$LABEL.slash/stats",
+			want: "https://tickets.example.com/api/team%2Fcarts/stats",
+		},
+		{
+			name: "unknown placeholder is kept",
+			url:  "https://tickets.example.com/api/$UNKNOWN",
+			want: "https://tickets.example.com/api/$UNKNOWN",
+		},
+		{
+			name:    "dot segment from a value",
+			url:     "https://tickets.example.com/api/$LABEL.path",
+			wantErr: "url https://tickets.example.com/api/..%2Fadmin must not contain .. segments",
+		},
+		{
+			name:    "encoded dot segment",
+			url:     "https://tickets.example.com/api/%2e%2e/admin",
+			wantErr: "must not contain .. segments",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := placeholders.ExpandURL(tt.url)
+			if tt.wantErr != "" {
+				require.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"container/list"
+	"encoding/json"
+	"expvar"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SLIResultCacheStats contains the hit and miss counters of an SLIResultCache
+type SLIResultCacheStats struct {
+	Hits   uint64 `json:"hits"`
+	Misses uint64 `json:"misses"`
+	Size   int    `json:"size"`
+}
+
+// sliResultCacheKey identifies a query by its fully expanded definition and time window.
+// The project and the URL override of its credentials are part of the key, as they determine which monitoring tool is asked
+type sliResultCacheKey struct {
+	SLIProvider    string
+	Project        string
+	CredentialsURL string
+	Definition     SLIIndicator
+	Filters        map[string]string
+	Start          time.Time
+	End            time.Time
+}
+
+type sliResultCacheEntry struct {
+	key       string
+	value     float64
+	expiresAt time.Time
+}
+
+// SLIResultCache is a size-bounded in-memory cache for SLI values with a time to live per entry.
+// When the cache is full, the least recently used entry is evicted. It is safe for concurrent use
+type SLIResultCache struct {
+	maxSize int
+	ttl     time.Duration
+	now     func() time.Time
+
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+
+	hits   uint64
+	misses uint64
+}
+
+// NewSLIResultCache creates a new SLIResultCache holding at most maxSize entries for the given ttl
+func NewSLIResultCache(maxSize int, ttl time.Duration) *SLIResultCache {
+	return &SLIResultCache{
+		maxSize: maxSize,
+		ttl:     ttl,
+		now:     time.Now,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+// Get returns the cached value for the given key
+func (c *SLIResultCache) Get(key sliResultCacheKey) (float64, bool) {
+	cacheKey := key.String()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	element, ok := c.entries[cacheKey]
+	if ok && c.now().After(element.Value.(*sliResultCacheEntry).expiresAt) {
+		c.remove(element)
+		ok = false
+	}
+	if !ok {
+		atomic.AddUint64(&c.misses, 1)
+		return 0, false
+	}
+
+	atomic.AddUint64(&c.hits, 1)
+	c.lru.MoveToFront(element)
+	return element.Value.(*sliResultCacheEntry).value, true
+}
+
+// Add stores the value for the given key, evicting the least recently used entry if the cache is full
+func (c *SLIResultCache) Add(key sliResultCacheKey, value float64) {
+	cacheKey := key.String()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if element, ok := c.entries[cacheKey]; ok {
+		entry := element.Value.(*sliResultCacheEntry)
+		entry.value = value
+		entry.expiresAt = c.now().Add(c.ttl)
+		c.lru.MoveToFront(element)
+		return
+	}
+
+	for c.lru.Len() >= c.maxSize && c.lru.Len() > 0 {
+		c.remove(c.lru.Back())
+	}
+
+	c.entries[cacheKey] = c.lru.PushFront(&sliResultCacheEntry{
+		key:       cacheKey,
+		value:     value,
+		expiresAt: c.now().Add(c.ttl),
+	})
+}
+
+// Stats returns the number of hits and misses since the cache was created as well as its current size
+func (c *SLIResultCache) Stats() SLIResultCacheStats {
+	c.mutex.Lock()
+	size := c.lru.Len()
+	c.mutex.Unlock()
+
+	return SLIResultCacheStats{
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+		Size:   size,
+	}
+}
+
+// Publish exports the Stats of the cache as expvar with the given name, served at /debug/vars of the health endpoint.
+// Like expvar.Publish, it panics if the name is already in use
+func (c *SLIResultCache) Publish(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return c.Stats()
+	}))
+}
+
+func (c *SLIResultCache) remove(element *list.Element) {
+	c.lru.Remove(element)
+	delete(c.entries, element.Value.(*sliResultCacheEntry).key)
+}
+
+// String serializes the key; maps are encoded with sorted keys, so equal keys result in equal strings
+func (k sliResultCacheKey) String() string {
+	serialized, _ := json.Marshal(k)
+	return string(serialized)
+}
@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/sdk"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testSLIResultCacheKey(query string) sliResultCacheKey {
+	return sliResultCacheKey{
+		SLIProvider: "prometheus",
+		Project:     "sockshop",
+		Definition:  SLIIndicator{Query: query},
+		Start:       time.Date(2021, 1, 15, 15, 4, 45, 0, time.UTC),
+		End:         time.Date(2021, 1, 15, 15, 9, 45, 0, time.UTC),
+	}
+}
+
+func Test_SLIResultCache_GetAndAdd(t *testing.T) {
+	cache := NewSLIResultCache(10, time.Minute)
+
+	_, ok := cache.Get(testSLIResultCacheKey("up"))
+	require.False(t, ok)
+
+	cache.Add(testSLIResultCacheKey("up"), 1)
+
+	value, ok := cache.Get(testSLIResultCacheKey("up"))
+	require.True(t, ok)
+	require.Equal(t, 1.0, value)
+
+	otherWindow := testSLIResultCacheKey("up")
+	otherWindow.End = otherWindow.End.Add(time.Minute)
+	_, ok = cache.Get(otherWindow)
+	require.False(t, ok)
+
+	otherProject := testSLIResultCacheKey("up")
+	otherProject.Project = "podtato-head"
+	_, ok = cache.Get(otherProject)
+	require.False(t, ok)
+
+	require.Equal(t, SLIResultCacheStats{Hits: 1, Misses: 3, Size: 1}, cache.Stats())
+}
+
+func Test_SLIResultCache_Expires(t *testing.T) {
+	now := time.Date(2021, 1, 15, 15, 10, 0, 0, time.UTC)
+	cache := NewSLIResultCache(10, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.Add(testSLIResultCacheKey("up"), 1)
+
+	now = now.Add(59 * time.Second)
+	_, ok := cache.Get(testSLIResultCacheKey("up"))
+	require.True(t, ok)
+
+	now = now.Add(2 * time.Second)
+	_, ok = cache.Get(testSLIResultCacheKey("up"))
+	require.False(t, ok)
+	require.Equal(t, 0, cache.Stats().Size)
+}
+
+func Test_SLIResultCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewSLIResultCache(2, time.Minute)
+
+	cache.Add(testSLIResultCacheKey("a"), 1)
+	cache.Add(testSLIResultCacheKey("b"), 2)
+	_, ok := cache.Get(testSLIResultCacheKey("a"))
+	require.True(t, ok)
+
+	cache.Add(testSLIResultCacheKey("c"), 3)
+
+	_, ok = cache.Get(testSLIResultCacheKey("b"))
+	require.False(t, ok)
+	_, ok = cache.Get(testSLIResultCacheKey("a"))
+	require.True(t, ok)
+	_, ok = cache.Get(testSLIResultCacheKey("c"))
+	require.True(t, ok)
+	require.Equal(t, 2, cache.Stats().Size)
+}
+
+func Test_SLIResultCache_ConcurrentAccess(t *testing.T) {
+	cache := NewSLIResultCache(50, time.Minute)
+	wg := sync.WaitGroup{}
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := testSLIResultCacheKey(fmt.Sprintf("query_%d", (i+j)%80))
+				if _, ok := cache.Get(key); !ok {
+					cache.Add(key, float64(j))
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats := cache.Stats()
+	require.Equal(t, uint64(2000), stats.Hits+stats.Misses)
+	require.LessOrEqual(t, stats.Size, 50)
+}
+
+func Test_SLIResultCache_Publish(t *testing.T) {
+	cache := NewSLIResultCache(10, time.Minute)
+	cache.Publish("test_sli_result_cache")
+
+	published := func() SLIResultCacheStats {
+		stats := SLIResultCacheStats{}
+		require.NoError(t, json.Unmarshal([]byte(expvar.Get("test_sli_result_cache").String()), &stats))
+		return stats
+	}
+	require.Equal(t, SLIResultCacheStats{}, published())
+
+	_, _ = cache.Get(testSLIResultCacheKey("up"))
+	cache.Add(testSLIResultCacheKey("up"), 1)
+	_, _ = cache.Get(testSLIResultCacheKey("up"))
+
+	require.Equal(t, SLIResultCacheStats{Hits: 1, Misses: 1, Size: 1}, published())
+}
+
+func Test_Receiving_GetSliTriggeredEvent_UsesSLIResultCache(t *testing.T) {
+	var calls int32
+	var failing int32 = 1
+	backend := sliBackendFunc(func(ctx context.Context, query SLIQuery) (float64, error) {
+		atomic.AddInt32(&calls, 1)
+		if query.Indicator == "some_other_metric" && atomic.LoadInt32(&failing) == 1 {
+			return 0, errors.New("connection refused")
+		}
+		return 42, nil
+	})
+	cache := NewSLIResultCache(10, time.Minute)
+
+	fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+	fakeKeptn.SetResourceHandler(sdk.StringResourceHandler{ResourceContent: testSLIConfig})
+	fakeKeptn.AddTaskHandler("sh.keptn.event.get-sli.triggered", NewGetSliEventHandler(
+		withTestSLIBackend(backend),
+		WithSLIResultCache(cache)))
+
+	fakeKeptn.NewEvent(newEvent("../test/events/get_sli_triggered.json"))
+	require.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	fakeKeptn.AssertSentEventResult(t, 1, keptnv2.ResultWarning)
+
+	// the retried event only queries the indicator that failed before
+	atomic.StoreInt32(&failing, 0)
+	fakeKeptn.NewEvent(newEvent("../test/events/get_sli_triggered.json"))
+	require.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	fakeKeptn.AssertSentEventResult(t, 3, keptnv2.ResultPass)
+
+	finishedEventData := getSliFinishedEventData(t, fakeKeptn.SentEvents[3])
+	require.Equal(t, []*keptnv2.SLIResult{
+		{Metric: "response_time_p95", Value: 42, Success: true},
+		{Metric: "some_other_metric", Value: 42, Success: true},
+	}, finishedEventData.GetSLI.IndicatorValues)
+	require.Equal(t, SLIResultCacheStats{Hits: 1, Misses: 3, Size: 2}, cache.Stats())
+}
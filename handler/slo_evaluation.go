@@ -0,0 +1,368 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	keptn "github.com/keptn/go-utils/pkg/lib"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"gopkg.in/yaml.v3"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// sloFile is the location of the SLOs within the config repo of a service, the same location the lighthouse-service of Keptn uses
+const sloFile = "slo.yaml"
+
+const defaultSLOPassScore = 90
+const defaultSLOWarningScore = 75
+
+// the statuses of scored objectives, objectives without pass criteria are informational and not scored
+const (
+	sloStatusPass    = "pass"
+	sloStatusWarning = "warning"
+	sloStatusFail    = "fail"
+	sloStatusInfo    = "info"
+)
+
+// the comparison settings of slo.yaml, the first value of each is the default
+var (
+	sloCompareWith        = []string{"single_result", "several_results"}
+	sloIncludeResults     = []string{"pass", "pass_or_warn", "all"}
+	sloAggregateFunctions = []string{"avg", "p50", "p90", "p95"}
+)
+
+// ParseSLO parses and validates the content of a slo.yaml file, e.g.:
+//
+//	spec_version: '1.0'
+//	comparison:
+//	  compare_with: several_results
+//	  include_result_with_score: pass
+//	  number_of_comparison_results: 3
+//	  aggregate_function: avg
+//	objectives:
+//	  - sli: response_time_p95
+//	    pass:
+//	      - criteria: ["<=+10%", "<600"]
+//	    warning:
+//	      - criteria: ["<=800"]
+//	    weight: 2
+//	    key_sli: true
+//	  - sli: throughput
+//	total_score:
+//	  pass: "90%"
+//	  warning: "75%"
+//
+// Relative criteria like <=+10% or <+50 compare the value with the aggregated values of previous evaluations,
+// they are met if there are no previous results
+func ParseSLO(content []byte) (*keptn.ServiceLevelObjectives, error) {
+	slo := &keptn.ServiceLevelObjectives{}
+	if err := yaml.Unmarshal(content, slo); err != nil {
+		return nil, fmt.Errorf("could not parse SLOs: %w", err)
+	}
+
+	if slo.SpecVersion == "" {
+		return nil, errors.New("invalid SLOs: spec_version must be set")
+	}
+	if len(slo.Objectives) == 0 {
+		return nil, errors.New("invalid SLOs: no objectives defined")
+	}
+	for i, objective := range slo.Objectives {
+		if objective == nil || strings.TrimSpace(objective.SLI) == "" {
+			return nil, fmt.Errorf("invalid SLOs: objective %d does not define an sli", i+1)
+		}
+		if objective.Weight < 0 {
+			return nil, fmt.Errorf("invalid SLOs: weight of %s must not be negative", objective.SLI)
+		}
+		for _, group := range append(append([]*keptn.SLOCriteria{}, objective.Pass...), objective.Warning...) {
+			if group == nil {
+				continue
+			}
+			for _, criterion := range group.Criteria {
+				if _, err := parseSLOCriterion(criterion); err != nil {
+					return nil, fmt.Errorf("invalid SLOs: objective %s has an %w", objective.SLI, err)
+				}
+			}
+		}
+	}
+
+	if comparison := slo.Comparison; comparison != nil {
+		if comparison.CompareWith != "" && !containsString(sloCompareWith, comparison.CompareWith) {
+			return nil, fmt.Errorf("invalid SLOs: compare_with must be one of %s", strings.Join(sloCompareWith, ", "))
+		}
+		if comparison.IncludeResultWithScore != "" && !containsString(sloIncludeResults, comparison.IncludeResultWithScore) {
+			return nil, fmt.Errorf("invalid SLOs: include_result_with_score must be one of %s", strings.Join(sloIncludeResults, ", "))
+		}
+		if comparison.AggregateFunction != "" && !containsString(sloAggregateFunctions, comparison.AggregateFunction) {
+			return nil, fmt.Errorf("invalid SLOs: aggregate_function must be one of %s", strings.Join(sloAggregateFunctions, ", "))
+		}
+		if comparison.NumberOfComparisonResults < 0 || comparison.NumberOfComparisonResults > maxEvaluationHistory {
+			return nil, fmt.Errorf("invalid SLOs: number_of_comparison_results must be between 0 and %d", maxEvaluationHistory)
+		}
+	}
+
+	if _, _, err := sloTotalScore(slo); err != nil {
+		return nil, fmt.Errorf("invalid SLOs: %w", err)
+	}
+	return slo, nil
+}
+
+// sloTotalScore returns the minimum scores in percent for the evaluation to pass or result in a warning
+func sloTotalScore(slo *keptn.ServiceLevelObjectives) (float64, float64, error) {
+	pass, warning := float64(defaultSLOPassScore), float64(defaultSLOWarningScore)
+	if slo.TotalScore == nil {
+		return pass, warning, nil
+	}
+	parse := func(name string, text string, defaultValue float64) (float64, error) {
+		text = strings.TrimSuffix(strings.TrimSpace(text), "%")
+		if text == "" {
+			return defaultValue, nil
+		}
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil || value < 0 || value > 100 {
+			return 0, fmt.Errorf("%s score of total_score must be a percentage", name)
+		}
+		return value, nil
+	}
+	pass, err := parse("pass", slo.TotalScore.Pass, pass)
+	if err != nil {
+		return 0, 0, err
+	}
+	warning, err = parse("warning", slo.TotalScore.Warning, warning)
+	if err != nil {
+		return 0, 0, err
+	}
+	return pass, warning, nil
+}
+
+// sloCriterion is a parsed criterion of an objective
+type sloCriterion struct {
+	operator string
+	value    float64
+	// relative criteria are compared with the value of previous evaluations, by a percentage or an absolute difference
+	relative bool
+	percent  bool
+}
+
+// parseSLOCriterion parses criteria like <=800, <=+10% or >-5
+func parseSLOCriterion(text string) (sloCriterion, error) {
+	compact := strings.ReplaceAll(strings.TrimSpace(text), " ", "")
+	for _, operator := range []string{"<=", ">=", "<", ">", "="} {
+		if !strings.HasPrefix(compact, operator) {
+			continue
+		}
+		criterion := sloCriterion{operator: operator}
+		number := strings.TrimPrefix(compact, operator)
+		if strings.HasSuffix(number, "%") {
+			criterion.percent = true
+			number = strings.TrimSuffix(number, "%")
+		}
+		criterion.relative = criterion.percent || strings.HasPrefix(number, "+") || strings.HasPrefix(number, "-")
+		value, err := strconv.ParseFloat(number, 64)
+		if err != nil {
+			return sloCriterion{}, fmt.Errorf("invalid criterion %q: value is not a number", text)
+		}
+		criterion.value = value
+		return criterion, nil
+	}
+	return sloCriterion{}, fmt.Errorf("invalid criterion %q: must start with <=, >=, <, > or =", text)
+}
+
+// target returns the value the criterion compares with given the value of previous evaluations
+func (c sloCriterion) target(compared float64) float64 {
+	switch {
+	case !c.relative:
+		return c.value
+	case c.percent:
+		return compared + compared*c.value/100
+	default:
+		return compared + c.value
+	}
+}
+
+// evaluateSLOCriteria returns whether the value meets all criteria of at least one of the groups and the targets of the criteria.
+// Relative criteria are met and have no target if there is no compared value
+func evaluateSLOCriteria(groups []*keptn.SLOCriteria, value float64, compared *float64) (bool, []*keptnv2.SLITarget) {
+	met := false
+	targets := []*keptnv2.SLITarget{}
+	for _, group := range groups {
+		if group == nil {
+			continue
+		}
+		groupMet := true
+		for _, text := range group.Criteria {
+			criterion, _ := parseSLOCriterion(text)
+			if criterion.relative && compared == nil {
+				continue
+			}
+			var comparedValue float64
+			if compared != nil {
+				comparedValue = *compared
+			}
+			target := criterion.target(comparedValue)
+			violated := !sliThreshold{operator: criterion.operator, value: target}.isMet(value)
+			targets = append(targets, &keptnv2.SLITarget{Criteria: text, TargetValue: target, Violated: violated})
+			if violated {
+				groupMet = false
+			}
+		}
+		met = met || groupMet
+	}
+	return met, targets
+}
+
+// evaluateSLO scores the objectives using the given SLI values and the values of previous evaluations, keyed by indicator.
+// Objectives meeting their pass criteria score their weight, objectives only meeting their warning criteria half of it.
+// The evaluation fails if a key SLI fails, otherwise its result depends on the total score in percent of the maximum score
+func evaluateSLO(slo *keptn.ServiceLevelObjectives, sliResults []*keptnv2.SLIResult, compared map[string]float64) keptnv2.EvaluationDetails {
+	values := map[string]*keptnv2.SLIResult{}
+	for _, sliResult := range sliResults {
+		values[sliResult.Metric] = sliResult
+	}
+
+	var maximum, achieved float64
+	keySLIFailed := false
+	indicatorResults := make([]*keptnv2.SLIEvaluationResult, 0, len(slo.Objectives))
+	for _, objective := range slo.Objectives {
+		value := &keptnv2.SLIResult{Metric: objective.SLI, Message: "no value received from the SLI backend"}
+		if sliResult, ok := values[objective.SLI]; ok {
+			copied := *sliResult
+			value = &copied
+		}
+		var comparedValue *float64
+		if c, ok := compared[objective.SLI]; ok {
+			comparedValue = &c
+			value.ComparedValue = c
+		}
+
+		indicatorResult := &keptnv2.SLIEvaluationResult{
+			Value:          value,
+			DisplayName:    objective.DisplayName,
+			KeySLI:         objective.KeySLI,
+			PassTargets:    []*keptnv2.SLITarget{},
+			WarningTargets: []*keptnv2.SLITarget{},
+		}
+		if indicatorResult.DisplayName == "" {
+			indicatorResult.DisplayName = objective.SLI
+		}
+		indicatorResults = append(indicatorResults, indicatorResult)
+		if len(objective.Pass) == 0 {
+			indicatorResult.Status = sloStatusInfo
+			continue
+		}
+
+		weight := float64(objective.Weight)
+		if weight == 0 {
+			weight = 1
+		}
+		maximum += weight
+
+		var passed, warned bool
+		if value.Success {
+			passed, indicatorResult.PassTargets = evaluateSLOCriteria(objective.Pass, value.Value, comparedValue)
+			warned, indicatorResult.WarningTargets = evaluateSLOCriteria(objective.Warning, value.Value, comparedValue)
+		}
+		switch {
+		case passed:
+			indicatorResult.Status = sloStatusPass
+			indicatorResult.Score = weight
+		case warned:
+			indicatorResult.Status = sloStatusWarning
+			indicatorResult.Score = weight / 2
+		default:
+			indicatorResult.Status = sloStatusFail
+			keySLIFailed = keySLIFailed || objective.KeySLI
+		}
+		achieved += indicatorResult.Score
+	}
+
+	score := float64(100)
+	if maximum > 0 {
+		score = math.Round(achieved/maximum*10000) / 100
+	}
+	passScore, warningScore, _ := sloTotalScore(slo)
+	result := sloStatusFail
+	switch {
+	case keySLIFailed:
+	case score >= passScore:
+		result = sloStatusPass
+	case score >= warningScore:
+		result = sloStatusWarning
+	}
+
+	return keptnv2.EvaluationDetails{
+		Result:           result,
+		Score:            score,
+		IndicatorResults: indicatorResults,
+	}
+}
+
+// comparedSLIValues selects the previous evaluations to compare with according to the comparison settings of the SLOs
+// and aggregates their values by indicator. The records must be ordered newest first, the IDs of the selected records are returned as well
+func comparedSLIValues(comparison *keptn.SLOComparison, records []EvaluationRecord) (map[string]float64, []string) {
+	settings := keptn.SLOComparison{}
+	if comparison != nil {
+		settings = *comparison
+	}
+	limit := 1
+	if settings.CompareWith == "several_results" {
+		limit = 3
+		if settings.NumberOfComparisonResults > 0 {
+			limit = settings.NumberOfComparisonResults
+		}
+	}
+
+	var selected []EvaluationRecord
+	for _, record := range records {
+		if len(selected) == limit {
+			break
+		}
+		switch settings.IncludeResultWithScore {
+		case "all":
+		case "pass_or_warn":
+			if record.Result != sloStatusPass && record.Result != sloStatusWarning {
+				continue
+			}
+		default:
+			if record.Result != sloStatusPass {
+				continue
+			}
+		}
+		selected = append(selected, record)
+	}
+
+	samples := map[string][]float64{}
+	eventIDs := make([]string, 0, len(selected))
+	for _, record := range selected {
+		eventIDs = append(eventIDs, record.EventID)
+		for indicator, value := range record.Values {
+			samples[indicator] = append(samples[indicator], value)
+		}
+	}
+	compared := make(map[string]float64, len(samples))
+	for indicator, values := range samples {
+		compared[indicator] = aggregateSLIValues(settings.AggregateFunction, values)
+	}
+	return compared, eventIDs
+}
+
+// aggregateSLIValues returns the average or the nearest-rank percentile of the values
+func aggregateSLIValues(function string, values []float64) float64 {
+	if function == "" || function == "avg" {
+		var sum float64
+		for _, value := range values {
+			sum += value
+		}
+		return sum / float64(len(values))
+	}
+
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	percentile, _ := strconv.ParseFloat(strings.TrimPrefix(function, "p"), 64)
+	rank := int(math.Ceil(percentile / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,229 @@
+package handler
+
+import (
+	keptn "github.com/keptn/go-utils/pkg/lib"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+const testSLO = `---
+spec_version: '1.0'
+comparison:
+  compare_with: several_results
+  include_result_with_score: pass_or_warn
+  number_of_comparison_results: 2
+  aggregate_function: avg
+objectives:
+  - sli: response_time_p95
+    displayName: Response time P95
+    pass:
+      - criteria: ["<=+10%", "<600"]
+    warning:
+      - criteria: ["<=800"]
+    weight: 2
+  - sli: error_rate
+    pass:
+      - criteria: ["<=0.01"]
+    key_sli: true
+  - sli: throughput
+total_score:
+  pass: "90%"
+  warning: "60%"
+`
+
+func Test_ParseSLO(t *testing.T) {
+	slo, err := ParseSLO([]byte(testSLO))
+	require.NoError(t, err)
+	require.Len(t, slo.Objectives, 3)
+	require.Equal(t, "several_results", slo.Comparison.CompareWith)
+	require.Equal(t, []string{"<=+10%", "<600"}, slo.Objectives[0].Pass[0].Criteria)
+	require.True(t, slo.Objectives[1].KeySLI)
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "spec_version missing",
+			content: "objectives:\n  - sli: error_rate\n",
+			wantErr: "invalid SLOs: spec_version must be set",
+		},
+		{
+			name:    "no objectives",
+			content: "spec_version: '1.0'\n",
+			wantErr: "invalid SLOs: no objectives defined",
+		},
+		{
+			name:    "invalid criterion",
+			content: "spec_version: '1.0'\nobjectives:\n  - sli: error_rate\n    pass:\n      - criteria: ['0.01']\n",
+			wantErr: `invalid SLOs: objective error_rate has an invalid criterion "0.01": must start with <=, >=, <, > or =`,
+		},
+		{
+			name:    "unknown aggregate function",
+			content: "spec_version: '1.0'\ncomparison:\n  aggregate_function: median\nobjectives:\n  - sli: error_rate\n",
+			wantErr: "invalid SLOs: aggregate_function must be one of avg, p50, p90, p95",
+		},
+		{
+			name:    "invalid total score",
+			content: "spec_version: '1.0'\nobjectives:\n  - sli: error_rate\ntotal_score:\n  pass: high\n",
+			wantErr: "invalid SLOs: pass score of total_score must be a percentage",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseSLO([]byte(tt.content))
+			require.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func Test_evaluateSLO(t *testing.T) {
+	slo, err := ParseSLO([]byte(testSLO))
+	require.NoError(t, err)
+
+	sliResults := func(responseTime float64, errorRate float64) []*keptnv2.SLIResult {
+		return []*keptnv2.SLIResult{
+			{Metric: "response_time_p95", Value: responseTime, Success: true},
+			{Metric: "error_rate", Value: errorRate, Success: true},
+			{Metric: "throughput", Value: 120, Success: true},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		sliResults   []*keptnv2.SLIResult
+		compared     map[string]float64
+		wantResult   string
+		wantScore    float64
+		wantStatuses []string
+	}{
+		{
+			name:         "first evaluation",
+			sliResults:   sliResults(550, 0),
+			wantResult:   "pass",
+			wantScore:    100,
+			wantStatuses: []string{"pass", "pass", "info"},
+		},
+		{
+			name:         "slower than before",
+			sliResults:   sliResults(550, 0),
+			compared:     map[string]float64{"response_time_p95": 400},
+			wantResult:   "warning",
+			wantScore:    66.67,
+			wantStatuses: []string{"warning", "pass", "info"},
+		},
+		{
+			name:         "response time too high",
+			sliResults:   sliResults(900, 0),
+			compared:     map[string]float64{"response_time_p95": 880},
+			wantResult:   "fail",
+			wantScore:    33.33,
+			wantStatuses: []string{"fail", "pass", "info"},
+		},
+		{
+			name:         "key SLI failed",
+			sliResults:   sliResults(300, 0.05),
+			wantResult:   "fail",
+			wantScore:    66.67,
+			wantStatuses: []string{"pass", "fail", "info"},
+		},
+		{
+			name:         "SLI could not be retrieved",
+			sliResults:   []*keptnv2.SLIResult{{Metric: "response_time_p95", Value: 300, Success: true}},
+			wantResult:   "fail",
+			wantScore:    66.67,
+			wantStatuses: []string{"pass", "fail", "info"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evaluation := evaluateSLO(slo, tt.sliResults, tt.compared)
+			require.Equal(t, tt.wantResult, evaluation.Result)
+			require.Equal(t, tt.wantScore, evaluation.Score)
+			var statuses []string
+			for _, indicatorResult := range evaluation.IndicatorResults {
+				statuses = append(statuses, indicatorResult.Status)
+			}
+			require.Equal(t, tt.wantStatuses, statuses)
+		})
+	}
+
+	evaluation := evaluateSLO(slo, sliResults(550, 0), map[string]float64{"response_time_p95": 400})
+	responseTime := evaluation.IndicatorResults[0]
+	require.Equal(t, "Response time P95", responseTime.DisplayName)
+	require.Equal(t, float64(400), responseTime.Value.ComparedValue)
+	require.Equal(t, []*keptnv2.SLITarget{
+		{Criteria: "<=+10%", TargetValue: 440, Violated: true},
+		{Criteria: "<600", TargetValue: 600},
+	}, responseTime.PassTargets)
+	require.Equal(t, []*keptnv2.SLITarget{{Criteria: "<=800", TargetValue: 800}}, responseTime.WarningTargets)
+}
+
+func Test_parseSLOCriterion(t *testing.T) {
+	tests := []struct {
+		criterion  string
+		compared   float64
+		wantTarget float64
+		wantErr    string
+	}{
+		{criterion: "<=800", compared: 100, wantTarget: 800},
+		{criterion: "<= +10%", compared: 200, wantTarget: 220},
+		{criterion: ">=-5%", compared: 200, wantTarget: 190},
+		{criterion: "<+50", compared: 200, wantTarget: 250},
+		{criterion: "<=ten", wantErr: `invalid criterion "<=ten": value is not a number`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.criterion, func(t *testing.T) {
+			criterion, err := parseSLOCriterion(tt.criterion)
+			if tt.wantErr != "" {
+				require.EqualError(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.InDelta(t, tt.wantTarget, criterion.target(tt.compared), 1e-9)
+		})
+	}
+}
+
+func Test_comparedSLIValues(t *testing.T) {
+	records := []EvaluationRecord{
+		{EventID: "event-4", Result: "fail", Values: map[string]float64{"response_time_p95": 900}},
+		{EventID: "event-3", Result: "warning", Values: map[string]float64{"response_time_p95": 500}},
+		{EventID: "event-2", Result: "pass", Values: map[string]float64{"response_time_p95": 300, "error_rate": 0.01}},
+		{EventID: "event-1", Result: "pass", Values: map[string]float64{"response_time_p95": 100}},
+	}
+
+	tests := []struct {
+		name         string
+		comparison   *keptn.SLOComparison
+		wantCompared map[string]float64
+		wantEvents   []string
+	}{
+		{
+			name:         "defaults",
+			wantCompared: map[string]float64{"response_time_p95": 300, "error_rate": 0.01},
+			wantEvents:   []string{"event-2"},
+		},
+		{
+			name:         "several results with pass or warning",
+			comparison:   &keptn.SLOComparison{CompareWith: "several_results", IncludeResultWithScore: "pass_or_warn", NumberOfComparisonResults: 2},
+			wantCompared: map[string]float64{"response_time_p95": 400, "error_rate": 0.01},
+			wantEvents:   []string{"event-3", "event-2"},
+		},
+		{
+			name:         "p90 of all results",
+			comparison:   &keptn.SLOComparison{CompareWith: "several_results", IncludeResultWithScore: "all", NumberOfComparisonResults: 4, AggregateFunction: "p90"},
+			wantCompared: map[string]float64{"response_time_p95": 900, "error_rate": 0.01},
+			wantEvents:   []string{"event-4", "event-3", "event-2", "event-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			compared, events := comparedSLIValues(tt.comparison, records)
+			require.Equal(t, tt.wantCompared, compared)
+			require.Equal(t, tt.wantEvents, events)
+		})
+	}
+}
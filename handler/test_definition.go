@@ -0,0 +1,297 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// testDefinitionFile returns the location of the test definition of a test strategy within the config repo of a service
+func testDefinitionFile(testStrategy string) string {
+	return fmt.Sprintf("keptn-service-template-go/tests/%s.yaml", testStrategy)
+}
+
+const defaultTestRequestTimeout = 30 * time.Second
+
+// the metrics of a test run the thresholds of a TestDefinition can refer to
+const (
+	testMetricRequests        = "requests"
+	testMetricErrorRate       = "error_rate"
+	testMetricThroughput      = "throughput"
+	testMetricResponseTimeAvg = "response_time_avg"
+	testMetricResponseTimeMax = "response_time_max"
+	// testMetricPercentilePrefix is followed by the percentile, e.g. response_time_p95
+	testMetricPercentilePrefix = "response_time_p"
+)
+
+// TestDefinition represents the content of a test definition stored as keptn-service-template-go/tests/<teststrategy>.yaml
+// in the config repo. It defines an HTTP scenario that is run against the deploymentURIs of the test.triggered event, e.g.:
+//
+//	spec_version: '1.0'
+//	concurrency: 10
+//	duration: 2m
+//	requests:
+//	  - name: add item
+//	    method: POST
+//	    path: /carts/1/items
+//	    headers:
+//	      Content-Type: application/json
+//	    body: '{"itemId": "03fef6ac-1896-4ce8-bd69-b798f85c6e0b", "unitPrice": "99.90"}'
+//	    status: 201
+//	thresholds:
+//	  error_rate: "<=0.01"
+//	  response_time_p95: "<=500"
+//
+// Each virtual user sends the requests of the scenario one after another to every URI, repeating the scenario until the duration elapsed
+type TestDefinition struct {
+	SpecVersion string `yaml:"spec_version"`
+	// Concurrency is the number of virtual users running the scenario in parallel, the default of the handler if not set
+	Concurrency int `yaml:"concurrency,omitempty"`
+	// Duration is the time the scenario is repeated for, the scenario is run once by each virtual user if not set
+	// and the handler has no default duration
+	Duration time.Duration `yaml:"duration,omitempty"`
+	// Timeout is the deadline of a single request
+	Timeout  time.Duration `yaml:"timeout,omitempty"`
+	Requests []TestRequest `yaml:"requests"`
+	// Thresholds maps metrics of the test run to the thresholds they must meet, e.g. <=500.
+	// The metrics are requests, error_rate, throughput in requests per second, and response_time_avg, response_time_max
+	// and response_time_p<percentile>, e.g. response_time_p95, in milliseconds. No request may fail if no thresholds are defined
+	Thresholds map[string]string `yaml:"thresholds,omitempty"`
+}
+
+// TestRequest is a request of the scenario of a TestDefinition
+type TestRequest struct {
+	Name   string `yaml:"name,omitempty"`
+	Method string `yaml:"method,omitempty"`
+	// Path is appended to the deploymentURIs
+	Path    string            `yaml:"path"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+	Body    string            `yaml:"body,omitempty"`
+	// Status is the expected status code of the response, any status below 400 is accepted if not set
+	Status int `yaml:"status,omitempty"`
+}
+
+// ParseTestDefinition parses and validates the content of a test definition
+func ParseTestDefinition(content []byte) (*TestDefinition, error) {
+	definition := &TestDefinition{}
+	if err := yaml.Unmarshal(content, definition); err != nil {
+		return nil, fmt.Errorf("could not parse test definition: %w", err)
+	}
+
+	if definition.SpecVersion == "" {
+		return nil, errors.New("invalid test definition: spec_version must be set")
+	}
+	if len(definition.Requests) == 0 {
+		return nil, errors.New("invalid test definition: no requests defined")
+	}
+	if definition.Concurrency < 0 {
+		return nil, errors.New("invalid test definition: concurrency must not be negative")
+	}
+	for i, request := range definition.Requests {
+		if !strings.HasPrefix(request.Path, "/") {
+			return nil, fmt.Errorf("invalid test definition: path of request %d must start with /", i+1)
+		}
+	}
+	for metric, threshold := range definition.Thresholds {
+		if !isTestMetric(metric) {
+			return nil, fmt.Errorf("invalid test definition: unknown metric %s", metric)
+		}
+		if _, err := parseSLIThreshold(threshold); err != nil {
+			return nil, fmt.Errorf("invalid test definition: metric %s %w", metric, err)
+		}
+	}
+
+	if len(definition.Thresholds) == 0 {
+		definition.Thresholds = map[string]string{testMetricErrorRate: "=0"}
+	}
+	if definition.Timeout <= 0 {
+		definition.Timeout = defaultTestRequestTimeout
+	}
+	return definition, nil
+}
+
+// isTestMetric returns true for the metrics of testRunResult.metric
+func isTestMetric(metric string) bool {
+	switch metric {
+	case testMetricRequests, testMetricErrorRate, testMetricThroughput, testMetricResponseTimeAvg, testMetricResponseTimeMax:
+		return true
+	}
+	_, ok := responseTimePercentile(metric)
+	return ok
+}
+
+// responseTimePercentile parses metrics like response_time_p95
+func responseTimePercentile(metric string) (float64, bool) {
+	if !strings.HasPrefix(metric, testMetricPercentilePrefix) {
+		return 0, false
+	}
+	percentile, err := strconv.ParseFloat(strings.TrimPrefix(metric, testMetricPercentilePrefix), 64)
+	if err != nil {
+		return 0, false
+	}
+	return percentile, percentile > 0 && percentile <= 100
+}
+
+// testRunResult collects the outcome of the requests of a test run
+type testRunResult struct {
+	mu            sync.Mutex
+	start         time.Time
+	end           time.Time
+	responseTimes []time.Duration
+	failures      int
+	// firstFailure describes the first failed request for the message of the test.finished event
+	firstFailure string
+}
+
+func (r *testRunResult) record(responseTime time.Duration, failure string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.responseTimes = append(r.responseTimes, responseTime)
+	if failure != "" {
+		r.failures++
+		if r.firstFailure == "" {
+			r.firstFailure = failure
+		}
+	}
+}
+
+// metric returns the value of a metric as documented for TestDefinition.Thresholds
+func (r *testRunResult) metric(metric string) float64 {
+	requests := len(r.responseTimes)
+	switch metric {
+	case testMetricRequests:
+		return float64(requests)
+	case testMetricErrorRate:
+		if requests == 0 {
+			return 0
+		}
+		return float64(r.failures) / float64(requests)
+	case testMetricThroughput:
+		seconds := r.end.Sub(r.start).Seconds()
+		if seconds <= 0 {
+			return 0
+		}
+		return float64(requests) / seconds
+	}
+
+	if requests == 0 {
+		return 0
+	}
+	sorted := make([]time.Duration, requests)
+	copy(sorted, r.responseTimes)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	milliseconds := func(d time.Duration) float64 {
+		return float64(d) / float64(time.Millisecond)
+	}
+
+	switch metric {
+	case testMetricResponseTimeAvg:
+		var total time.Duration
+		for _, responseTime := range sorted {
+			total += responseTime
+		}
+		return milliseconds(total / time.Duration(requests))
+	case testMetricResponseTimeMax:
+		return milliseconds(sorted[requests-1])
+	default:
+		// nearest-rank percentile
+		percentile, _ := responseTimePercentile(metric)
+		rank := int(math.Ceil(percentile / 100 * float64(requests)))
+		if rank < 1 {
+			rank = 1
+		}
+		return milliseconds(sorted[rank-1])
+	}
+}
+
+// runTestScenario runs the scenario of the definition against the given URIs with the given number of virtual users.
+// The scenario is repeated until the duration elapsed, or run once by each user if the duration is 0
+func runTestScenario(ctx context.Context, httpClient *http.Client, definition *TestDefinition, uris []string, concurrency int, duration time.Duration) *testRunResult {
+	result := &testRunResult{start: time.Now()}
+	runCtx := ctx
+	if duration > 0 {
+		var cancel context.CancelFunc
+		runCtx, cancel = context.WithTimeout(ctx, duration)
+		defer cancel()
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				for _, uri := range uris {
+					for _, request := range definition.Requests {
+						if runCtx.Err() != nil {
+							return
+						}
+						responseTime, failure := sendTestRequest(runCtx, httpClient, uri, request, definition.Timeout)
+						// requests interrupted by the end of the test run are not counted
+						if runCtx.Err() != nil {
+							return
+						}
+						result.record(responseTime, failure)
+					}
+				}
+				if duration <= 0 {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	result.end = time.Now()
+	return result
+}
+
+// sendTestRequest sends the request to the URI and returns its response time and a description of the failure if it failed
+func sendTestRequest(ctx context.Context, httpClient *http.Client, uri string, request TestRequest, timeout time.Duration) (time.Duration, string) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	method := strings.ToUpper(request.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	name := request.Name
+	if name == "" {
+		name = method + " " + request.Path
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(uri, "/")+request.Path, strings.NewReader(request.Body))
+	if err != nil {
+		return 0, fmt.Sprintf("%s: could not create request: %s", name, err)
+	}
+	for header, value := range request.Headers {
+		req.Header.Set(header, value)
+	}
+
+	start := time.Now()
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return time.Since(start), fmt.Sprintf("%s: %s", name, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	responseTime := time.Since(start)
+
+	if request.Status != 0 && resp.StatusCode != request.Status {
+		return responseTime, fmt.Sprintf("%s to %s returned status %d instead of %d", name, uri, resp.StatusCode, request.Status)
+	}
+	if request.Status == 0 && resp.StatusCode >= 400 {
+		return responseTime, fmt.Sprintf("%s to %s returned status %d", name, uri, resp.StatusCode)
+	}
+	return responseTime, ""
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"context"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_ParseTestDefinition(t *testing.T) {
+	definition, err := ParseTestDefinition([]byte("spec_version: '1.0'\nconcurrency: 2\nrequests:\n  - path: /health\n"))
+	require.NoError(t, err)
+	require.Equal(t, &TestDefinition{
+		SpecVersion: "1.0",
+		Concurrency: 2,
+		Timeout:     defaultTestRequestTimeout,
+		Requests:    []TestRequest{{Path: "/health"}},
+		Thresholds:  map[string]string{"error_rate": "=0"},
+	}, definition)
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "spec_version missing",
+			content: "requests:\n  - path: /health\n",
+			wantErr: "invalid test definition: spec_version must be set",
+		},
+		{
+			name:    "no requests",
+			content: "spec_version: '1.0'\n",
+			wantErr: "invalid test definition: no requests defined",
+		},
+		{
+			name:    "relative path",
+			content: "spec_version: '1.0'\nrequests:\n  - path: health\n",
+			wantErr: "invalid test definition: path of request 1 must start with /",
+		},
+		{
+			name:    "unknown metric",
+			content: "spec_version: '1.0'\nrequests:\n  - path: /health\nthresholds:\n  response_time_p101: '<500'\n",
+			wantErr: "invalid test definition: unknown metric response_time_p101",
+		},
+		{
+			name:    "invalid threshold",
+			content: "spec_version: '1.0'\nrequests:\n  - path: /health\nthresholds:\n  error_rate: '0.01'\n",
+			wantErr: `invalid test definition: metric error_rate has an invalid threshold "0.01": must start with <=, >=, <, > or =`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseTestDefinition([]byte(tt.content))
+			require.EqualError(t, err, tt.wantErr)
+		})
+	}
+}
+
+func Test_testRunResult_metric(t *testing.T) {
+	start := time.Date(2022, 6, 1, 10, 0, 0, 0, time.UTC)
+	result := &testRunResult{start: start, end: start.Add(2 * time.Second)}
+	for i := 1; i <= 10; i++ {
+		failure := ""
+		if i > 8 {
+			failure = "GET /health returned status 500"
+		}
+		result.record(time.Duration(i)*10*time.Millisecond, failure)
+	}
+
+	require.Equal(t, float64(10), result.metric("requests"))
+	require.Equal(t, 0.2, result.metric("error_rate"))
+	require.Equal(t, float64(5), result.metric("throughput"))
+	require.Equal(t, float64(55), result.metric("response_time_avg"))
+	require.Equal(t, float64(100), result.metric("response_time_max"))
+	require.Equal(t, float64(90), result.metric("response_time_p90"))
+	require.Equal(t, float64(100), result.metric("response_time_p95"))
+	require.Equal(t, float64(50), result.metric("response_time_p50"))
+	require.Equal(t, "GET /health returned status 500", result.firstFailure)
+}
+
+func Test_runTestScenario(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path == "/carts/1/items" && r.Method == http.MethodPost {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	definition := &TestDefinition{
+		Timeout: time.Second,
+		Requests: []TestRequest{
+			{Name: "add item", Method: "post", Path: "/carts/1/items", Status: http.StatusCreated},
+			{Path: "/health"},
+		},
+	}
+
+	t.Run("run once", func(t *testing.T) {
+		atomic.StoreInt32(&requests, 0)
+		result := runTestScenario(context.Background(), server.Client(), definition, []string{server.URL, server.URL + "/"}, 3, 0)
+		require.Equal(t, int32(12), atomic.LoadInt32(&requests))
+		require.Len(t, result.responseTimes, 12)
+		require.Equal(t, 6, result.failures)
+		require.Contains(t, result.firstFailure, "GET /health to "+server.URL)
+		require.Contains(t, result.firstFailure, "returned status 404")
+		require.False(t, result.end.Before(result.start))
+	})
+
+	t.Run("repeated for the duration", func(t *testing.T) {
+		result := runTestScenario(context.Background(), server.Client(), definition, []string{server.URL}, 2, 50*time.Millisecond)
+		require.Greater(t, len(result.responseTimes), 4)
+		require.GreaterOrEqual(t, result.end.Sub(result.start), 50*time.Millisecond)
+	})
+
+	t.Run("unreachable", func(t *testing.T) {
+		result := runTestScenario(context.Background(), server.Client(), &TestDefinition{Timeout: time.Second, Requests: []TestRequest{{Path: "/health"}}}, []string{"http://127.0.0.1:1"}, 1, 0)
+		require.Equal(t, 1, result.failures)
+		require.Contains(t, result.firstFailure, "GET /health: ")
+	})
+}
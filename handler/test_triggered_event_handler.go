@@ -0,0 +1,191 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	api "github.com/keptn/go-utils/pkg/api/utils"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/sdk"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const defaultTestStrategy = "functional"
+const defaultTestConcurrency = 1
+
+// TestTriggeredEventHandler runs the HTTP scenario of the TestDefinition of the test strategy of the event against the deploymentURIs
+// of the event, preferring the local URIs. The test.finished event reports the start and end of the test run
+// and whether the thresholds of the definition were met
+type TestTriggeredEventHandler struct {
+	httpClient  *http.Client
+	ctx         context.Context
+	concurrency int
+	duration    time.Duration
+}
+
+// TestTriggeredEventHandlerOption can be used to configure the TestTriggeredEventHandler
+type TestTriggeredEventHandlerOption func(*TestTriggeredEventHandler)
+
+// WithTestShutdownContext configures a context that is cancelled when the service shuts down.
+// A test run in progress is stopped and reported as errored when it is done
+func WithTestShutdownContext(ctx context.Context) TestTriggeredEventHandlerOption {
+	return func(t *TestTriggeredEventHandler) {
+		t.ctx = ctx
+	}
+}
+
+// WithTestConcurrency configures the number of virtual users of test definitions that do not define a concurrency
+func WithTestConcurrency(concurrency int) TestTriggeredEventHandlerOption {
+	return func(t *TestTriggeredEventHandler) {
+		if concurrency > 0 {
+			t.concurrency = concurrency
+		}
+	}
+}
+
+// WithTestDuration configures the time the scenario of test definitions that do not define a duration is repeated for
+func WithTestDuration(duration time.Duration) TestTriggeredEventHandlerOption {
+	return func(t *TestTriggeredEventHandler) {
+		if duration > 0 {
+			t.duration = duration
+		}
+	}
+}
+
+// NewTestTriggeredEventHandler creates a new TestTriggeredEventHandler sending the requests of the tests using the given client
+func NewTestTriggeredEventHandler(httpClient *http.Client, opts ...TestTriggeredEventHandlerOption) *TestTriggeredEventHandler {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	handler := &TestTriggeredEventHandler{
+		httpClient:  httpClient,
+		ctx:         context.Background(),
+		concurrency: defaultTestConcurrency,
+	}
+	for _, opt := range opts {
+		opt(handler)
+	}
+	return handler
+}
+
+// Execute runs the tests of the test strategy of the event, the tests pass if no test definition is stored for the strategy
+func (t *TestTriggeredEventHandler) Execute(k sdk.IKeptn, event sdk.KeptnEvent) (interface{}, *sdk.Error) {
+	k.Logger().Infof("Handling test.triggered Event: %s", event.ID)
+	testTriggeredEvent := &keptnv2.TestTriggeredEventData{}
+
+	if err := keptnv2.Decode(event.Data, testTriggeredEvent); err != nil {
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: "failed to decode test.triggered event: " + err.Error()}
+	}
+
+	testStrategy := testTriggeredEvent.Test.TestStrategy
+	if testStrategy == "" {
+		testStrategy = defaultTestStrategy
+	}
+	definitionFile := testDefinitionFile(testStrategy)
+	resourceScope := *api.NewResourceScope().Project(testTriggeredEvent.Project).Stage(testTriggeredEvent.Stage).Service(testTriggeredEvent.Service).Resource(definitionFile)
+	resource, err := k.GetResourceHandler().GetResource(resourceScope)
+	if errors.Is(err, api.ResourceNotFoundError) {
+		resource, err = nil, nil
+	}
+	if err != nil {
+		err = fmt.Errorf("error while fetching test definition: %w", err)
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+	}
+	if resource == nil {
+		now := time.Now().UTC()
+		message := fmt.Sprintf("no tests were run as there is no %s", definitionFile)
+		return getTestFinishedEvent(keptnv2.ResultPass, keptnv2.StatusSucceeded, *testTriggeredEvent, message, now, now), nil
+	}
+
+	definition, err := ParseTestDefinition([]byte(resource.ResourceContent))
+	if err != nil {
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+	}
+
+	uris := testTriggeredEvent.Deployment.DeploymentURIsLocal
+	if len(uris) == 0 {
+		uris = testTriggeredEvent.Deployment.DeploymentURIsPublic
+	}
+	if len(uris) == 0 {
+		err := fmt.Errorf("no deploymentURIs of %s to run the tests against", testTriggeredEvent.Service)
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+	}
+
+	concurrency := definition.Concurrency
+	if concurrency == 0 {
+		concurrency = t.concurrency
+	}
+	duration := definition.Duration
+	if duration <= 0 {
+		duration = t.duration
+	}
+
+	k.Logger().Infof("Running %s tests of %s with %d virtual users against %s", testStrategy, testTriggeredEvent.Service, concurrency, strings.Join(uris, ", "))
+	result := runTestScenario(t.ctx, t.httpClient, definition, uris, concurrency, duration)
+	if t.ctx.Err() != nil {
+		err := fmt.Errorf("%s tests of %s were cancelled because the service is shutting down: %w", testStrategy, testTriggeredEvent.Service, t.ctx.Err())
+		return nil, &sdk.Error{Err: err, StatusType: keptnv2.StatusErrored, ResultType: keptnv2.ResultFailed, Message: err.Error()}
+	}
+
+	passed, observations := evaluateTestThresholds(definition.Thresholds, result)
+	message := fmt.Sprintf("%s tests of %s passed: ", testStrategy, testTriggeredEvent.Service)
+	testResult := keptnv2.ResultPass
+	if !passed {
+		message = fmt.Sprintf("%s tests of %s failed: ", testStrategy, testTriggeredEvent.Service)
+		testResult = keptnv2.ResultFailed
+	}
+	message += fmt.Sprintf("%d requests, %d failed, %s", len(result.responseTimes), result.failures, strings.Join(observations, ", "))
+	if result.firstFailure != "" {
+		message += ", first failure: " + result.firstFailure
+	}
+	return getTestFinishedEvent(testResult, keptnv2.StatusSucceeded, *testTriggeredEvent, message, result.start, result.end), nil
+}
+
+// evaluateTestThresholds returns whether the result meets all thresholds, listing the observed values ordered by metric
+func evaluateTestThresholds(thresholds map[string]string, result *testRunResult) (bool, []string) {
+	metrics := make([]string, 0, len(thresholds))
+	for metric := range thresholds {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+
+	passed := true
+	observations := make([]string, 0, len(metrics))
+	for _, metric := range metrics {
+		threshold, _ := parseSLIThreshold(thresholds[metric])
+		value := result.metric(metric)
+		// response times are reported in milliseconds, two decimals suffice for all metrics
+		rounded := strconv.FormatFloat(math.Round(value*100)/100, 'f', -1, 64)
+		if !threshold.isMet(value) {
+			passed = false
+			observations = append(observations, fmt.Sprintf("%s=%s violates %s", metric, rounded, thresholds[metric]))
+		} else {
+			observations = append(observations, fmt.Sprintf("%s=%s meets %s", metric, rounded, thresholds[metric]))
+		}
+	}
+	return passed, observations
+}
+
+func getTestFinishedEvent(result keptnv2.ResultType, status keptnv2.StatusType, testTriggeredEvent keptnv2.TestTriggeredEventData, message string, start time.Time, end time.Time) keptnv2.TestFinishedEventData {
+
+	return keptnv2.TestFinishedEventData{
+		EventData: keptnv2.EventData{
+			Project: testTriggeredEvent.Project,
+			Stage:   testTriggeredEvent.Stage,
+			Service: testTriggeredEvent.Service,
+			Labels:  testTriggeredEvent.Labels,
+			Status:  status,
+			Result:  result,
+			Message: message,
+		},
+		Test: keptnv2.TestFinishedDetails{
+			Start: start.UTC().Format(time.RFC3339),
+			End:   end.UTC().Format(time.RFC3339),
+		},
+	}
+}
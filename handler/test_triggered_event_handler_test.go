@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"context"
+	keptnapi "github.com/keptn/go-utils/pkg/api/models"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/sdk"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testPerformanceDefinition = `spec_version: '1.0'
+concurrency: 2
+requests:
+  - name: list items
+    path: /carts/1/items
+  - name: add item
+    method: POST
+    path: /carts/1/items
+    body: '{"itemId": "03fef6ac-1896-4ce8-bd69-b798f85c6e0b"}'
+    status: 201
+thresholds:
+  error_rate: "<=0.5"
+  requests: "=4"
+`
+
+func getTestFinishedEventData(t *testing.T, ce keptnapi.KeptnContextExtendedCE) keptnv2.TestFinishedEventData {
+	eventData := keptnv2.TestFinishedEventData{}
+	require.NoError(t, keptnv2.EventDataAs(ce, &eventData))
+	return eventData
+}
+
+func Test_Receiving_TestTriggeredEvent(t *testing.T) {
+	// the carts service only accepts new items
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		resources   resourcesHandler
+		urisLocal   []string
+		urisPublic  []string
+		wantStatus  keptnv2.StatusType
+		wantResult  keptnv2.ResultType
+		wantMessage string
+	}{
+		{
+			name:        "thresholds met",
+			resources:   resourcesHandler{"keptn-service-template-go/tests/performance.yaml": testPerformanceDefinition},
+			urisLocal:   []string{server.URL},
+			wantStatus:  keptnv2.StatusSucceeded,
+			wantResult:  keptnv2.ResultPass,
+			wantMessage: "performance tests of carts passed: 4 requests, 2 failed, error_rate=0.5 meets <=0.5, requests=4 meets =4, first failure: list items to " + server.URL + " returned status 503",
+		},
+		{
+			name:        "thresholds violated",
+			resources:   resourcesHandler{"keptn-service-template-go/tests/performance.yaml": "spec_version: '1.0'\nrequests:\n  - path: /health\n"},
+			urisPublic:  []string{server.URL},
+			wantStatus:  keptnv2.StatusSucceeded,
+			wantResult:  keptnv2.ResultFailed,
+			wantMessage: "performance tests of carts failed: 1 requests, 1 failed, error_rate=1 violates =0, first failure: GET /health to " + server.URL + " returned status 503",
+		},
+		{
+			name:        "no test definition",
+			resources:   resourcesHandler{},
+			urisLocal:   []string{server.URL},
+			wantStatus:  keptnv2.StatusSucceeded,
+			wantResult:  keptnv2.ResultPass,
+			wantMessage: "no tests were run as there is no keptn-service-template-go/tests/performance.yaml",
+		},
+		{
+			name:        "invalid test definition",
+			resources:   resourcesHandler{"keptn-service-template-go/tests/performance.yaml": "requests: []"},
+			urisLocal:   []string{server.URL},
+			wantStatus:  keptnv2.StatusErrored,
+			wantResult:  keptnv2.ResultFailed,
+			wantMessage: "invalid test definition: spec_version must be set",
+		},
+		{
+			name:        "no deploymentURIs",
+			resources:   resourcesHandler{"keptn-service-template-go/tests/performance.yaml": testPerformanceDefinition},
+			wantStatus:  keptnv2.StatusErrored,
+			wantResult:  keptnv2.ResultFailed,
+			wantMessage: "no deploymentURIs of carts to run the tests against",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			event := newEvent("../test/events/test_triggered.json")
+			eventData := keptnv2.TestTriggeredEventData{}
+			require.NoError(t, keptnv2.EventDataAs(event, &eventData))
+			eventData.Deployment.DeploymentURIsLocal = tt.urisLocal
+			eventData.Deployment.DeploymentURIsPublic = tt.urisPublic
+			event.Data = eventData
+
+			fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+			fakeKeptn.SetResourceHandler(tt.resources)
+			fakeKeptn.AddTaskHandler("sh.keptn.event.test.triggered", NewTestTriggeredEventHandler(server.Client()))
+
+			fakeKeptn.NewEvent(event)
+
+			fakeKeptn.AssertNumberOfEventSent(t, 2)
+			fakeKeptn.AssertSentEventType(t, 1, keptnv2.GetFinishedEventType("test"))
+			fakeKeptn.AssertSentEventStatus(t, 1, tt.wantStatus)
+			fakeKeptn.AssertSentEventResult(t, 1, tt.wantResult)
+			finishedEventData := getTestFinishedEventData(t, fakeKeptn.SentEvents[1])
+			require.Equal(t, tt.wantMessage, finishedEventData.Message)
+			if tt.wantStatus == keptnv2.StatusSucceeded {
+				start, err := time.Parse(time.RFC3339, finishedEventData.Test.Start)
+				require.NoError(t, err)
+				end, err := time.Parse(time.RFC3339, finishedEventData.Test.End)
+				require.NoError(t, err)
+				require.False(t, end.Before(start))
+			}
+		})
+	}
+}
+
+func Test_Receiving_TestTriggeredEvent_ShuttingDown(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	shutdownCtx, shutdown := context.WithCancel(context.Background())
+	shutdown()
+
+	event := newEvent("../test/events/test_triggered.json")
+	eventData := keptnv2.TestTriggeredEventData{}
+	require.NoError(t, keptnv2.EventDataAs(event, &eventData))
+	eventData.Deployment.DeploymentURIsLocal = []string{server.URL}
+	event.Data = eventData
+
+	fakeKeptn := sdk.NewFakeKeptn("test-service-template-svc")
+	fakeKeptn.SetResourceHandler(resourcesHandler{"keptn-service-template-go/tests/performance.yaml": testPerformanceDefinition})
+	fakeKeptn.AddTaskHandler("sh.keptn.event.test.triggered", NewTestTriggeredEventHandler(server.Client(), WithTestShutdownContext(shutdownCtx)))
+
+	fakeKeptn.NewEvent(event)
+
+	fakeKeptn.AssertNumberOfEventSent(t, 2)
+	fakeKeptn.AssertSentEventStatus(t, 1, keptnv2.StatusErrored)
+	fakeKeptn.AssertSentEventResult(t, 1, keptnv2.ResultFailed)
+	require.Equal(t, "performance tests of carts were cancelled because the service is shutting down: context canceled",
+		getTestFinishedEventData(t, fakeKeptn.SentEvents[1]).Message)
+}
@@ -0,0 +1,324 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/sdk"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const defaultWebhookTimeout = 10 * time.Second
+const defaultWebhookRetries = 2
+const defaultWebhookRetryDelay = time.Second
+
+// WebhookConfig represents the configuration of the webhook actions, keyed by action name, e.g.:
+//
+//	webhooks:
+//	  notify-oncall:
+//	    method: POST
+//	    url: "https://hooks.example.com/services/{{.Project}}"
+//	    headers:
+//	      Content-Type: application/json
+//	    body: '{"text": {{json .Problem.ProblemTitle}}, "stage": {{json .Stage}}}'
+type WebhookConfig struct {
+	Webhooks map[string]WebhookDefinition `yaml:"webhooks"`
+}
+
+// WebhookDefinition defines the HTTP request sent by a webhook action.
+// URL, headers and body are Go templates rendered with the data of the action.triggered event and the Target of the request,
+// the template function json encodes a value as JSON
+type WebhookDefinition struct {
+	Method  string            `yaml:"method,omitempty"`
+	URL     string            `yaml:"url"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+	Body    string            `yaml:"body,omitempty"`
+	// Timeout is the deadline for a single request
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Retries is the number of times a request is repeated after a network error or a 5xx or 429 response
+	Retries *int `yaml:"retries,omitempty"`
+	// RetryDelay is the delay before the first retry, it is doubled for every further retry
+	RetryDelay time.Duration `yaml:"retryDelay,omitempty"`
+	// Value is the type of the optional value of the action the templates can use as .Action.Value,
+	// the action takes no value if it is not set
+	Value ParameterType `yaml:"value,omitempty"`
+}
+
+// ParseWebhookConfig parses and validates the configuration of the webhook actions
+func ParseWebhookConfig(content []byte) (*WebhookConfig, error) {
+	config := &WebhookConfig{}
+	if err := yaml.Unmarshal(content, config); err != nil {
+		return nil, fmt.Errorf("could not parse webhook config: %w", err)
+	}
+
+	names := make([]string, 0, len(config.Webhooks))
+	for name := range config.Webhooks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := config.Webhooks[name].validate(); err != nil {
+			return nil, fmt.Errorf("invalid webhook config: webhook %s %w", name, err)
+		}
+	}
+	return config, nil
+}
+
+// validate checks that the webhook defines a valid request
+func (d WebhookDefinition) validate() error {
+	if strings.TrimSpace(d.URL) == "" {
+		return errors.New("must define a url")
+	}
+	switch strings.ToUpper(d.Method) {
+	case "", http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+	default:
+		return fmt.Errorf("has unsupported method %s", d.Method)
+	}
+	if d.Retries != nil && *d.Retries < 0 {
+		return errors.New("must not define a negative number of retries")
+	}
+	switch d.Value {
+	case "", ParameterTypeObject, ParameterTypeString, ParameterTypeNumber, ParameterTypeInteger, ParameterTypeBoolean:
+	default:
+		return fmt.Errorf("has unsupported value type %s", d.Value)
+	}
+
+	templates := map[string]string{"url": d.URL, "body": d.Body}
+	for name, value := range d.Headers {
+		templates["header "+name] = value
+	}
+	for name, text := range templates {
+		if _, err := parseWebhookTemplate(name, text); err != nil {
+			return fmt.Errorf("has an invalid %s template: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// WebhookAction sends an HTTP request rendered from the action.triggered event.
+// A 2xx response reports pass, any other response after all retries reports fail.
+// Messages and logs only contain the host of the request, as webhook URLs often contain secrets
+type WebhookAction struct {
+	definition WebhookDefinition
+	httpClient *http.Client
+}
+
+// NewWebhookAction creates a new WebhookAction sending the request defined by the given definition
+func NewWebhookAction(definition WebhookDefinition, httpClient *http.Client) *WebhookAction {
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	if definition.Method == "" {
+		definition.Method = http.MethodPost
+	}
+	definition.Method = strings.ToUpper(definition.Method)
+	if definition.Timeout <= 0 {
+		definition.Timeout = defaultWebhookTimeout
+	}
+	if definition.Retries == nil {
+		retries := defaultWebhookRetries
+		definition.Retries = &retries
+	}
+	if definition.RetryDelay <= 0 {
+		definition.RetryDelay = defaultWebhookRetryDelay
+	}
+	return &WebhookAction{
+		definition: definition,
+		httpClient: httpClient,
+	}
+}
+
+// ParameterSchema returns the schema of the value, an optional value of the type defined by the webhook or no value
+func (a *WebhookAction) ParameterSchema() *ParameterSchema {
+	if a.definition.Value == "" {
+		return &ParameterSchema{Type: ParameterTypeObject, Description: "no parameters"}
+	}
+	return &ParameterSchema{
+		Type:                 a.definition.Value,
+		Description:          "available to the templates as .Action.Value",
+		AdditionalProperties: true,
+		Optional:             true,
+	}
+}
+
+// NewParameters returns the value the value is decoded into
+func (a *WebhookAction) NewParameters() interface{} {
+	return new(interface{})
+}
+
+// Describe returns a description of the request
+func (a *WebhookAction) Describe(req ActionRequest) string {
+	request, err := a.render(req)
+	if err != nil {
+		return fmt.Sprintf("send %s request", a.definition.Method)
+	}
+	return fmt.Sprintf("send %s request to %s", a.definition.Method, request.host)
+}
+
+// Validate checks that the request can be rendered for the event
+func (a *WebhookAction) Validate(req ActionRequest) error {
+	_, err := a.render(req)
+	return err
+}
+
+// Execute sends the request, retrying it on network errors and 5xx or 429 responses
+func (a *WebhookAction) Execute(ctx context.Context, k sdk.IKeptn, req ActionRequest) (ActionResult, error) {
+	request, err := a.render(req)
+	if err != nil {
+		return ActionResult{}, err
+	}
+
+	retryDelay := a.definition.RetryDelay
+	for attempt := 0; ; attempt++ {
+		statusCode, body, err := a.send(ctx, request)
+
+		retry := err != nil || statusCode >= 500 || statusCode == http.StatusTooManyRequests
+		if !retry || attempt >= *a.definition.Retries {
+			if err != nil {
+				return ActionResult{}, fmt.Errorf("could not send %s request to %s: %w", a.definition.Method, request.host, err)
+			}
+			return webhookResult(a.definition.Method, request.host, statusCode, body), nil
+		}
+
+		if err != nil {
+			k.Logger().Warnf("Could not send %s request to %s, retrying in %s: %s", a.definition.Method, request.host, retryDelay, err.Error())
+		} else {
+			k.Logger().Warnf("%s request to %s responded with status code %d, retrying in %s", a.definition.Method, request.host, statusCode, retryDelay)
+		}
+
+		select {
+		case <-time.After(retryDelay):
+		case <-ctx.Done():
+			return ActionResult{}, ctx.Err()
+		}
+		retryDelay *= 2
+	}
+}
+
+// webhookRequest is a request with all templates rendered
+type webhookRequest struct {
+	url string
+	// host is the host of the url, it is reported instead of the url
+	host    string
+	headers map[string]string
+	body    string
+}
+
+// webhookTemplateData is passed to the templates of a webhook, the fields of the event can be used directly, e.g. {{.Project}}
+type webhookTemplateData struct {
+	keptnv2.ActionTriggeredEventData
+	// Target is the workload the action is applied to, its name defaults to the service of the event
+	Target ActionTarget
+}
+
+// render renders the templates of the definition with the data of the event
+func (a *WebhookAction) render(req ActionRequest) (webhookRequest, error) {
+	request := webhookRequest{headers: map[string]string{}}
+	data := webhookTemplateData{
+		ActionTriggeredEventData: req.Event,
+		Target:                   ActionTarget{Name: req.TargetName(), Namespace: req.Target.Namespace},
+	}
+
+	var err error
+	if request.url, err = renderWebhookTemplate("url", a.definition.URL, data); err != nil {
+		return webhookRequest{}, err
+	}
+	parsed, err := url.Parse(request.url)
+	if err != nil {
+		// the error of url.Parse contains the url
+		return webhookRequest{}, fmt.Errorf("rendered url is invalid: %w", errors.Unwrap(err))
+	}
+	if parsed.Host == "" {
+		return webhookRequest{}, errors.New("rendered url has no host")
+	}
+	request.host = parsed.Host
+	if request.body, err = renderWebhookTemplate("body", a.definition.Body, data); err != nil {
+		return webhookRequest{}, err
+	}
+	for name, value := range a.definition.Headers {
+		if request.headers[name], err = renderWebhookTemplate("header "+name, value, data); err != nil {
+			return webhookRequest{}, err
+		}
+	}
+	return request, nil
+}
+
+// send sends the request once, using the configured timeout
+func (a *WebhookAction) send(ctx context.Context, request webhookRequest) (int, string, error) {
+	requestCtx, cancel := context.WithTimeout(ctx, a.definition.Timeout)
+	defer cancel()
+
+	var body io.Reader
+	if request.body != "" {
+		body = strings.NewReader(request.body)
+	}
+	httpRequest, err := http.NewRequestWithContext(requestCtx, a.definition.Method, request.url, body)
+	if err != nil {
+		return 0, "", fmt.Errorf("could not create request: %w", err)
+	}
+	for name, value := range request.headers {
+		httpRequest.Header.Set(name, value)
+	}
+
+	resp, err := a.httpClient.Do(httpRequest)
+	if err != nil {
+		// the error of the client contains the url
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, "", fmt.Errorf("could not read response: %w", err)
+	}
+	return resp.StatusCode, string(responseBody), nil
+}
+
+// webhookResult maps the status code of the response to the result of the action
+func webhookResult(method string, host string, statusCode int, body string) ActionResult {
+	message := fmt.Sprintf("%s request to %s responded with status code %d", method, host, statusCode)
+	if statusCode >= 200 && statusCode <= 299 {
+		return ActionResult{Result: keptnv2.ResultPass, Message: message}
+	}
+	if body = strings.TrimSpace(body); body != "" {
+		message += ": " + truncate(body, 200)
+	}
+	return ActionResult{Result: keptnv2.ResultFailed, Message: message}
+}
+
+func parseWebhookTemplate(name string, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Funcs(template.FuncMap{
+		"json": func(value interface{}) (string, error) {
+			encoded, err := json.Marshal(value)
+			return string(encoded), err
+		},
+	}).Parse(text)
+}
+
+func renderWebhookTemplate(name string, text string, data webhookTemplateData) (string, error) {
+	tmpl, err := parseWebhookTemplate(name, text)
+	if err != nil {
+		return "", fmt.Errorf("could not parse %s template: %w", name, err)
+	}
+	buf := bytes.Buffer{}
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("could not render %s template: %w", name, err)
+	}
+	return buf.String(), nil
+}
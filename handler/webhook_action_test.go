@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"context"
+	keptnv2 "github.com/keptn/go-utils/pkg/lib/v0_2_0"
+	"github.com/keptn/go-utils/pkg/sdk"
+	"github.com/stretchr/testify/require"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_ParseWebhookConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		content    string
+		wantErr    string
+		wantConfig *WebhookConfig
+	}{
+		{
+			name: "valid config",
+			content: `webhooks:
+  notify-oncall:
+    method: POST
+    url: "https://hooks.example.com/{{.Project}}"
+    headers:
+      Content-Type: application/json
+    body: '{"text": {{json .Problem.ProblemTitle}}}'
+    timeout: 5s
+    retries: 0
+    retryDelay: 500ms
+    value: string
+`,
+			wantConfig: &WebhookConfig{
+				Webhooks: map[string]WebhookDefinition{
+					"notify-oncall": {
+						Method:     "POST",
+						URL:        "https://hooks.example.com/{{.Project}}",
+						Headers:    map[string]string{"Content-Type": "application/json"},
+						Body:       `{"text": {{json .Problem.ProblemTitle}}}`,
+						Timeout:    5 * time.Second,
+						Retries:    new(int),
+						RetryDelay: 500 * time.Millisecond,
+						Value:      ParameterTypeString,
+					},
+				},
+			},
+		},
+		{
+			name:    "invalid yaml",
+			content: "webhooks: [",
+			wantErr: "could not parse webhook config",
+		},
+		{
+			name: "missing url",
+			content: `webhooks:
+  notify-oncall:
+    body: "{}"
+`,
+			wantErr: "invalid webhook config: webhook notify-oncall must define a url",
+		},
+		{
+			name: "unsupported method",
+			content: `webhooks:
+  notify-oncall:
+    method: CONNECT
+    url: "https://hooks.example.com"
+`,
+			wantErr: "invalid webhook config: webhook notify-oncall has unsupported method CONNECT",
+		},
+		{
+			name: "unsupported value type",
+			content: `webhooks:
+  notify-oncall:
+    url: "https://hooks.example.com"
+    value: list
+`,
+			wantErr: "invalid webhook config: webhook notify-oncall has unsupported value type list",
+		},
+		{
+			name: "invalid template",
+			content: `webhooks:
+  notify-oncall:
+    url: "https://hooks.example.com/{{.Project"
+`,
+			wantErr: "invalid webhook config: webhook notify-oncall has an invalid url template",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := ParseWebhookConfig([]byte(tt.content))
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.wantConfig, config)
+		})
+	}
+}
+
+func Test_WebhookAction_Execute(t *testing.T) {
+	var received *http.Request
+	var receivedBody string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received, receivedBody = r, string(body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer ts.Close()
+
+	action := NewWebhookAction(WebhookDefinition{
+		URL:     ts.URL + "/hooks/{{.Project}}/{{.Stage}}?service={{urlquery .Service}}",
+		Headers: map[string]string{"Content-Type": "application/json", "X-Build": `{{index .Labels "buildId"}}`},
+		Body:    `{"text": {{json .Problem.ProblemTitle}}, "action": {{json .Action.Action}}, "value": {{json .Action.Value}}}`,
+		Value:   ParameterTypeString,
+	}, ts.Client())
+	req := newActionRequest(t, "1")
+	req.Event.Problem = keptnv2.ProblemDetails{ProblemTitle: `Response time "p95" degradation`}
+
+	require.NoError(t, action.Validate(req))
+	// the url of webhooks often contains secrets, only its host is reported
+	host := strings.TrimPrefix(ts.URL, "http://")
+	require.Equal(t, "send POST request to "+host, action.Describe(req))
+	result, err := action.Execute(context.Background(), sdk.NewFakeKeptn("test").Keptn, req)
+
+	require.NoError(t, err)
+	require.Equal(t, ActionResult{
+		Result:  keptnv2.ResultPass,
+		Message: "POST request to " + host + " responded with status code 202",
+	}, result)
+	require.Equal(t, http.MethodPost, received.Method)
+	require.Equal(t, "/hooks/user-managed/dev", received.URL.Path)
+	require.Equal(t, "application/json", received.Header.Get("Content-Type"))
+	require.Equal(t, "build-17", received.Header.Get("X-Build"))
+	require.JSONEq(t, `{"text": "Response time \"p95\" degradation", "action": "action-xyz", "value": "1"}`, receivedBody)
+}
+
+func Test_WebhookAction_StatusCodes(t *testing.T) {
+	tests := []struct {
+		name         string
+		statusCodes  []int
+		wantRequests int32
+		wantResult   keptnv2.ResultType
+		wantMessage  string
+	}{
+		{
+			name:         "retried after server error",
+			statusCodes:  []int{http.StatusServiceUnavailable, http.StatusOK},
+			wantRequests: 2,
+			wantResult:   keptnv2.ResultPass,
+			wantMessage:  "responded with status code 200",
+		},
+		{
+			name:         "retried after too many requests",
+			statusCodes:  []int{http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusNoContent},
+			wantRequests: 3,
+			wantResult:   keptnv2.ResultPass,
+			wantMessage:  "responded with status code 204",
+		},
+		{
+			name:         "fails after all retries",
+			statusCodes:  []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway},
+			wantRequests: 3,
+			wantResult:   keptnv2.ResultFailed,
+			wantMessage:  "responded with status code 502: upstream unavailable",
+		},
+		{
+			name:         "client error is not retried",
+			statusCodes:  []int{http.StatusNotFound},
+			wantRequests: 1,
+			wantResult:   keptnv2.ResultFailed,
+			wantMessage:  "responded with status code 404: upstream unavailable",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				request := atomic.AddInt32(&requests, 1)
+				w.WriteHeader(tt.statusCodes[request-1])
+				if tt.statusCodes[request-1] >= 300 {
+					w.Write([]byte("upstream unavailable"))
+				}
+			}))
+			defer ts.Close()
+
+			action := NewWebhookAction(WebhookDefinition{URL: ts.URL, RetryDelay: time.Millisecond}, ts.Client())
+			result, err := action.Execute(context.Background(), sdk.NewFakeKeptn("test").Keptn, newActionRequest(t, nil))
+
+			require.NoError(t, err)
+			require.Equal(t, tt.wantRequests, atomic.LoadInt32(&requests))
+			require.Equal(t, tt.wantResult, result.Result)
+			require.Equal(t, "POST request to "+strings.TrimPrefix(ts.URL, "http://")+" "+tt.wantMessage, result.Message)
+		})
+	}
+}
+
+func Test_WebhookAction_Timeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	}))
+	defer ts.Close()
+
+	retries := 0
+	action := NewWebhookAction(WebhookDefinition{URL: ts.URL + "/hooks/secret-token", Timeout: 50 * time.Millisecond, Retries: &retries}, ts.Client())
+	_, err := action.Execute(context.Background(), sdk.NewFakeKeptn("test").Keptn, newActionRequest(t, nil))
+
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "could not send POST request to "+strings.TrimPrefix(ts.URL, "http://")+": ")
+	require.NotContains(t, err.Error(), "secret-token")
+	require.Contains(t, err.Error(), "context deadline exceeded")
+}
+
+func Test_WebhookAction_Validate(t *testing.T) {
+	action := NewWebhookAction(WebhookDefinition{URL: "https://hooks.example.com/{{.Unknown}}"}, nil)
+
+	err := action.Validate(newActionRequest(t, nil))
+
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "could not render url template")
+}
+
+func Test_WebhookAction_ValidateHost(t *testing.T) {
+	action := NewWebhookAction(WebhookDefinition{URL: "/hooks/{{.Project}}"}, nil)
+
+	require.EqualError(t, action.Validate(newActionRequest(t, nil)), "rendered url has no host")
+}
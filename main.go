@@ -1,17 +1,74 @@
 package main
 
 import (
+	"context"
 	"github.com/keptn-service-template-go/handler"
 	"github.com/keptn/go-utils/pkg/sdk"
 	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/restmapper"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
 const getSliTriggeredEvent = "sh.keptn.event.get-sli.triggered"
 const actionTriggeredEvent = "sh.keptn.event.action.triggered"
+const deploymentTriggeredEvent = "sh.keptn.event.deployment.triggered"
+const releaseTriggeredEvent = "sh.keptn.event.release.triggered"
+const testTriggeredEvent = "sh.keptn.event.test.triggered"
+const evaluationTriggeredEvent = "sh.keptn.event.evaluation.triggered"
 const serviceName = "keptn-service-template-go"
 const envVarLogLevel = "LOG_LEVEL"
+const envVarPrometheusURL = "PROMETHEUS_URL"
+const envVarHTTPSLIProvider = "HTTP_SLI_PROVIDER"
+const envVarSLIFailurePolicy = "SLI_FAILURE_POLICY"
+const envVarSLIMaxParallelism = "SLI_MAX_PARALLELISM"
+const envVarSLIQueryTimeout = "SLI_QUERY_TIMEOUT"
+const envVarCredentialsCacheTTL = "CREDENTIALS_CACHE_TTL"
+const envVarK8sNamespace = "K8S_NAMESPACE"
+const envVarSLICacheSize = "SLI_CACHE_SIZE"
+const envVarSLICacheTTL = "SLI_CACHE_TTL"
+const envVarReportUnknownActions = "REPORT_UNKNOWN_ACTIONS"
+const envVarActionDryRun = "ACTION_DRY_RUN"
+const envVarActionTimeout = "ACTION_TIMEOUT"
+const envVarActionTimeouts = "ACTION_TIMEOUTS"
+const envVarActionRecordStore = "ACTION_RECORD_STORE"
+const envVarActionRecordFile = "ACTION_RECORD_FILE"
+const envVarActionRecordConfigMap = "ACTION_RECORD_CONFIGMAP"
+const envVarActionRecordRetention = "ACTION_RECORD_RETENTION"
+const envVarActionNamespaceTemplate = "ACTION_NAMESPACE_TEMPLATE"
+const envVarScaleMinReplicas = "SCALE_MIN_REPLICAS"
+const envVarScaleMaxReplicas = "SCALE_MAX_REPLICAS"
+const envVarRolloutTimeout = "ROLLOUT_TIMEOUT"
+const envVarScriptActions = "SCRIPT_ACTIONS"
+const envVarScriptTimeout = "SCRIPT_TIMEOUT"
+const envVarWebhookConfig = "WEBHOOK_CONFIG"
+const envVarDeploymentEnabled = "DEPLOYMENT_ENABLED"
+const envVarDeploymentNamespaceTemplate = "DEPLOYMENT_NAMESPACE_TEMPLATE"
+const envVarDeploymentRolloutTimeout = "DEPLOYMENT_ROLLOUT_TIMEOUT"
+const envVarCanaryWeights = "CANARY_WEIGHTS"
+const envVarCanaryStepInterval = "CANARY_STEP_INTERVAL"
+const envVarTestEnabled = "TEST_ENABLED"
+const envVarTestConcurrency = "TEST_CONCURRENCY"
+const envVarTestDuration = "TEST_DURATION"
+const envVarEvaluationEnabled = "EVALUATION_ENABLED"
+const envVarEvaluationSLIProvider = "EVALUATION_SLI_PROVIDER"
+const envVarEvaluationHistoryFile = "EVALUATION_HISTORY_FILE"
+
+const defaultSLICacheSize = 1000
+const defaultSLICacheTTL = 5 * time.Minute
+const defaultActionRecordConfigMap = serviceName + "-action-records"
 
 func main() {
 	if os.Getenv(envVarLogLevel) != "" {
@@ -24,16 +81,490 @@ func main() {
 		}
 	}
 
-	log.Printf("Starting %s", serviceName)
+	clientset, dynamicClient, err := getKubernetesClients()
+	if err != nil {
+		logrus.WithError(err).Warn("could not create Kubernetes client, functionality accessing the cluster is disabled")
+	}
+
+	// register a backend for each sliProvider this service shall answer get-sli events for
+	sliBackends := handler.NewSLIBackendRegistry()
+	prometheusURL := os.Getenv(envVarPrometheusURL)
+	if prometheusURL == "" {
+		logrus.Warnf("%s is not set, indicators of the sliProvider %s fail unless the credentials of the project define a url", envVarPrometheusURL, serviceName)
+	}
+	sliBackends.Register(serviceName, handler.NewPrometheusBackend(prometheusURL, &http.Client{}))
+	if httpSLIProvider := os.Getenv(envVarHTTPSLIProvider); httpSLIProvider != "" {
+		sliBackends.Register(httpSLIProvider, handler.NewHTTPJSONBackend(&http.Client{}))
+	}
 
-	log.Fatal(sdk.NewKeptn(
-		serviceName,
+	// register the remediation actions this service shall execute for action.triggered events
+	actions := handler.NewActionRegistry()
+	actions.Register("action-xyz", handler.NewExampleAction(1*time.Second))
+	for _, script := range strings.Split(os.Getenv(envVarScriptActions), ",") {
+		if script = strings.TrimSpace(script); script != "" {
+			if os.Geteuid() != 0 {
+				logrus.Fatalf("script action %s provided by 'SCRIPT_ACTIONS' env var requires the service to run as root, scripts are run as an unprivileged user", script)
+			}
+			logrus.Warnf("script action %s runs scripts of the config repo in the network of this service", script)
+			actions.Register(script, handler.NewScriptAction(script, scriptActionOptions()...))
+		}
+	}
+	if webhookConfigFile := os.Getenv(envVarWebhookConfig); webhookConfigFile != "" {
+		for name, definition := range readWebhookConfig(webhookConfigFile).Webhooks {
+			actions.Register(name, handler.NewWebhookAction(definition, &http.Client{}))
+		}
+	}
+	if clientset != nil {
+		actions.Register("scaling", handler.NewScaleDeploymentAction(clientset, scaleDeploymentActionOptions()...))
+		actions.Register("rollout-restart", handler.NewRolloutRestartAction(clientset, rolloutRestartActionOptions()...))
+	}
+
+	// the SLIs are retrieved by the same handler for get-sli events and the verification of remediation actions
+	getSliEventHandler := handler.NewGetSliEventHandler(getSliEventHandlerOptions(sliBackends, clientset)...)
+
+	// actions, deployments and tests in progress are cancelled on shutdown, so that their finished events are sent before the service exits
+	shutdownCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	actionHandler := handler.NewActionTriggeredEventHandler(actionTriggeredEventHandlerOptions(shutdownCtx, actions, getSliEventHandler, clientset)...)
+	keptnOptions := []sdk.KeptnOption{
 		sdk.WithTaskHandler(
 			actionTriggeredEvent,
-			handler.NewActionTriggeredEventHandler()),
+			actionHandler,
+			actionHandler.Filter),
 		sdk.WithTaskHandler(
 			getSliTriggeredEvent,
-			handler.NewGetSliEventHandler()),
+			getSliEventHandler,
+			getSliEventHandler.Filter),
 		sdk.WithLogger(logrus.StandardLogger()),
-	).Start())
+	}
+	// tests are usually run by a test provider like the jmeter-service, the built-in tests have to be enabled explicitly
+	if handlerEnabled(envVarTestEnabled) {
+		keptnOptions = append(keptnOptions,
+			sdk.WithTaskHandler(
+				testTriggeredEvent,
+				handler.NewTestTriggeredEventHandler(&http.Client{}, testTriggeredEventHandlerOptions(shutdownCtx)...)))
+	}
+	// evaluations are usually handled by the lighthouse-service of Keptn, the built-in evaluation has to be enabled explicitly
+	if handlerEnabled(envVarEvaluationEnabled) {
+		keptnOptions = append(keptnOptions,
+			sdk.WithTaskHandler(
+				evaluationTriggeredEvent,
+				handler.NewEvaluationTriggeredEventHandler(getSliEventHandler, evaluationTriggeredEventHandlerOptions(sliBackends)...)))
+	}
+	// deployments are usually handled by the helm-service of Keptn, the built-in deployments have to be enabled explicitly
+	// and can only be handled if the service runs in the cluster the charts are deployed to
+	if handlerEnabled(envVarDeploymentEnabled) {
+		if dynamicClient == nil {
+			logrus.Fatal("deployments can only be enabled by 'DEPLOYMENT_ENABLED' env var if the service runs in a Kubernetes cluster")
+		}
+		keptnOptions = append(keptnOptions,
+			sdk.WithTaskHandler(
+				deploymentTriggeredEvent,
+				handler.NewDeploymentTriggeredEventHandler(dynamicClient, deploymentTriggeredEventHandlerOptions(shutdownCtx, clientset.Discovery())...)),
+			sdk.WithTaskHandler(
+				releaseTriggeredEvent,
+				handler.NewReleaseTriggeredEventHandler(dynamicClient,
+					handler.WithReleaseShutdownContext(shutdownCtx),
+					handler.WithReleaseNamespaceTemplate(deploymentNamespaceTemplate()),
+					handler.WithReleaseRolloutTimeout(deploymentRolloutTimeout()))))
+	}
+
+	log.Printf("Starting %s", serviceName)
+
+	log.Fatal(sdk.NewKeptn(serviceName, keptnOptions...).Start())
+}
+
+// deploymentTriggeredEventHandlerOptions configures the DeploymentTriggeredEventHandler using environment variables
+func deploymentTriggeredEventHandlerOptions(shutdownCtx context.Context, discoveryClient discovery.DiscoveryInterface) []handler.DeploymentTriggeredEventHandlerOption {
+	deploymentOptions := []handler.DeploymentTriggeredEventHandlerOption{
+		handler.WithDeploymentShutdownContext(shutdownCtx),
+		// the discovery API is cached, it is queried again when a chart contains a kind that is not known yet
+		handler.WithDeploymentRESTMapper(restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(discoveryClient))),
+		handler.WithDeploymentNamespaceTemplate(deploymentNamespaceTemplate()),
+		handler.WithDeploymentRolloutTimeout(deploymentRolloutTimeout()),
+	}
+
+	if os.Getenv(envVarCanaryWeights) != "" || os.Getenv(envVarCanaryStepInterval) != "" {
+		var weights []int
+		for _, weight := range strings.Split(os.Getenv(envVarCanaryWeights), ",") {
+			if weight = strings.TrimSpace(weight); weight == "" {
+				continue
+			}
+			value, err := strconv.Atoi(weight)
+			if err != nil {
+				logrus.WithError(err).Fatal("could not parse canary weights provided by 'CANARY_WEIGHTS' env var")
+			}
+			weights = append(weights, value)
+		}
+		if len(weights) > 0 {
+			if err := handler.ValidateCanaryWeights(weights); err != nil {
+				logrus.WithError(err).Fatal("invalid canary weights provided by 'CANARY_WEIGHTS' env var")
+			}
+		}
+
+		var stepInterval time.Duration
+		if os.Getenv(envVarCanaryStepInterval) != "" {
+			var err error
+			stepInterval, err = time.ParseDuration(os.Getenv(envVarCanaryStepInterval))
+			if err != nil {
+				logrus.WithError(err).Fatal("could not parse canary step interval provided by 'CANARY_STEP_INTERVAL' env var")
+			}
+		}
+		deploymentOptions = append(deploymentOptions, handler.WithCanaryWeights(weights, stepInterval))
+	}
+
+	return deploymentOptions
+}
+
+// handlerEnabled returns whether the handler enabled by the given env var shall be registered, handlers are disabled by default
+func handlerEnabled(envVar string) bool {
+	if os.Getenv(envVar) == "" {
+		return false
+	}
+	enabled, err := strconv.ParseBool(os.Getenv(envVar))
+	if err != nil {
+		logrus.WithError(err).Fatalf("could not parse '%s' env var", envVar)
+	}
+	return enabled
+}
+
+// evaluationTriggeredEventHandlerOptions configures the EvaluationTriggeredEventHandler using environment variables
+func evaluationTriggeredEventHandlerOptions(sliBackends *handler.SLIBackendRegistry) []handler.EvaluationTriggeredEventHandlerOption {
+	sliProvider := os.Getenv(envVarEvaluationSLIProvider)
+	if sliProvider == "" {
+		sliProvider = serviceName
+	}
+	if _, ok := sliBackends.Get(sliProvider); !ok {
+		logrus.Fatalf("no SLI backend is registered for the sliProvider %s provided by 'EVALUATION_SLI_PROVIDER' env var, registered are: %s",
+			sliProvider, strings.Join(sliBackends.Providers(), ", "))
+	}
+
+	evaluationOptions := []handler.EvaluationTriggeredEventHandlerOption{
+		handler.WithEvaluationSLIProvider(sliProvider),
+	}
+
+	if os.Getenv(envVarEvaluationHistoryFile) != "" {
+		evaluationOptions = append(evaluationOptions, handler.WithEvaluationHistory(handler.NewFileEvaluationHistoryStore(os.Getenv(envVarEvaluationHistoryFile))))
+	}
+
+	return evaluationOptions
+}
+
+// testTriggeredEventHandlerOptions configures the TestTriggeredEventHandler using environment variables
+func testTriggeredEventHandlerOptions(shutdownCtx context.Context) []handler.TestTriggeredEventHandlerOption {
+	testOptions := []handler.TestTriggeredEventHandlerOption{
+		handler.WithTestShutdownContext(shutdownCtx),
+	}
+
+	if os.Getenv(envVarTestConcurrency) != "" {
+		concurrency, err := strconv.Atoi(os.Getenv(envVarTestConcurrency))
+		if err != nil || concurrency <= 0 {
+			logrus.WithError(err).Fatal("could not parse number of virtual users provided by 'TEST_CONCURRENCY' env var")
+		}
+		testOptions = append(testOptions, handler.WithTestConcurrency(concurrency))
+	}
+
+	if os.Getenv(envVarTestDuration) != "" {
+		duration, err := time.ParseDuration(os.Getenv(envVarTestDuration))
+		if err != nil {
+			logrus.WithError(err).Fatal("could not parse test duration provided by 'TEST_DURATION' env var")
+		}
+		testOptions = append(testOptions, handler.WithTestDuration(duration))
+	}
+
+	return testOptions
+}
+
+// deploymentNamespaceTemplate returns the template for the namespace the charts of deployment.triggered events are applied to
+func deploymentNamespaceTemplate() *handler.NamespaceTemplate {
+	text := handler.DefaultNamespaceTemplate
+	if os.Getenv(envVarDeploymentNamespaceTemplate) != "" {
+		text = os.Getenv(envVarDeploymentNamespaceTemplate)
+	}
+	namespaceTemplate, err := handler.ParseNamespaceTemplate(text)
+	if err != nil {
+		logrus.WithError(err).Fatal("could not parse namespace template provided by 'DEPLOYMENT_NAMESPACE_TEMPLATE' env var")
+	}
+	return namespaceTemplate
+}
+
+// deploymentRolloutTimeout returns the time deployments and releases wait for the rollout of workloads, 0 for the default
+func deploymentRolloutTimeout() time.Duration {
+	if os.Getenv(envVarDeploymentRolloutTimeout) == "" {
+		return 0
+	}
+	rolloutTimeout, err := time.ParseDuration(os.Getenv(envVarDeploymentRolloutTimeout))
+	if err != nil {
+		logrus.WithError(err).Fatal("could not parse rollout timeout provided by 'DEPLOYMENT_ROLLOUT_TIMEOUT' env var")
+	}
+	return rolloutTimeout
+}
+
+// actionTriggeredEventHandlerOptions configures the ActionTriggeredEventHandler using environment variables
+func actionTriggeredEventHandlerOptions(shutdownCtx context.Context, actions *handler.ActionRegistry, getSliEventHandler *handler.GetSliEventHandler, clientset kubernetes.Interface) []handler.ActionTriggeredEventHandlerOption {
+	actionOptions := []handler.ActionTriggeredEventHandlerOption{
+		handler.WithActions(actions),
+		handler.WithVerification(getSliEventHandler),
+		handler.WithShutdownContext(shutdownCtx),
+		handler.WithProblemTargets(),
+	}
+
+	if os.Getenv(envVarReportUnknownActions) != "" {
+		reportUnknownActions, err := strconv.ParseBool(os.Getenv(envVarReportUnknownActions))
+		if err != nil {
+			logrus.WithError(err).Fatal("could not parse 'REPORT_UNKNOWN_ACTIONS' env var")
+		}
+		actionOptions = append(actionOptions, handler.WithReportUnknownActions(reportUnknownActions))
+	}
+
+	if os.Getenv(envVarActionDryRun) != "" {
+		dryRun, err := strconv.ParseBool(os.Getenv(envVarActionDryRun))
+		if err != nil {
+			logrus.WithError(err).Fatal("could not parse 'ACTION_DRY_RUN' env var")
+		}
+		actionOptions = append(actionOptions, handler.WithDryRun(dryRun))
+	}
+
+	if os.Getenv(envVarActionTimeout) != "" {
+		actionTimeout, err := time.ParseDuration(os.Getenv(envVarActionTimeout))
+		if err != nil || actionTimeout <= 0 {
+			logrus.WithError(err).Fatal("could not parse action timeout provided by 'ACTION_TIMEOUT' env var")
+		}
+		actionOptions = append(actionOptions, handler.WithActionTimeout(actionTimeout))
+	}
+
+	if os.Getenv(envVarActionTimeouts) != "" {
+		actionOptions = append(actionOptions, handler.WithActionTimeouts(parseActionTimeouts(os.Getenv(envVarActionTimeouts))))
+	}
+
+	if records := actionRecordStore(clientset); records != nil {
+		actionOptions = append(actionOptions, handler.WithActionRecords(records))
+	}
+
+	return actionOptions
+}
+
+// actionRecordStore returns the store used to deduplicate redelivered action.triggered events, nil if it is disabled
+func actionRecordStore(clientset kubernetes.Interface) handler.ActionRecordStore {
+	var retention time.Duration
+	if os.Getenv(envVarActionRecordRetention) != "" {
+		var err error
+		retention, err = time.ParseDuration(os.Getenv(envVarActionRecordRetention))
+		if err != nil {
+			logrus.WithError(err).Fatal("could not parse action record retention provided by 'ACTION_RECORD_RETENTION' env var")
+		}
+	}
+
+	switch os.Getenv(envVarActionRecordStore) {
+	case "", "memory":
+		return handler.NewMemoryActionRecordStore(retention)
+	case "file":
+		if os.Getenv(envVarActionRecordFile) == "" {
+			logrus.Fatal("'ACTION_RECORD_FILE' env var must be set to store action records in a file")
+		}
+		return handler.NewFileActionRecordStore(os.Getenv(envVarActionRecordFile), retention)
+	case "configmap":
+		if clientset == nil {
+			logrus.Fatal("action records can only be stored in a configmap if the service runs in a Kubernetes cluster")
+		}
+		name := defaultActionRecordConfigMap
+		if os.Getenv(envVarActionRecordConfigMap) != "" {
+			name = os.Getenv(envVarActionRecordConfigMap)
+		}
+		return handler.NewConfigMapActionRecordStore(clientset, os.Getenv(envVarK8sNamespace), name, retention)
+	case "none":
+		return nil
+	default:
+		logrus.Fatalf("unknown action record store %q provided by 'ACTION_RECORD_STORE' env var, expected memory, file, configmap or none", os.Getenv(envVarActionRecordStore))
+		return nil
+	}
+}
+
+// parseActionTimeouts parses a comma separated list of action timeouts, e.g. "rollout-restart=10m,scaling=1m"
+func parseActionTimeouts(value string) map[string]time.Duration {
+	timeouts := map[string]time.Duration{}
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, "=", 2)
+		if len(parts) != 2 {
+			logrus.Fatalf("could not parse action timeout %q provided by 'ACTION_TIMEOUTS' env var, expected <action>=<duration>", entry)
+		}
+		name := strings.TrimSpace(parts[0])
+		timeout, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+		if err != nil || timeout <= 0 {
+			logrus.WithError(err).Fatalf("could not parse timeout of action %s provided by 'ACTION_TIMEOUTS' env var", name)
+		}
+		timeouts[name] = timeout
+	}
+	return timeouts
+}
+
+// scaleDeploymentActionOptions configures the ScaleDeploymentAction using environment variables
+func scaleDeploymentActionOptions() []handler.ScaleDeploymentActionOption {
+	scaleOptions := []handler.ScaleDeploymentActionOption{handler.WithScaleNamespaceTemplate(actionNamespaceTemplate())}
+
+	if os.Getenv(envVarScaleMinReplicas) != "" || os.Getenv(envVarScaleMaxReplicas) != "" {
+		minReplicas := parseReplicasEnvVar(envVarScaleMinReplicas, 1)
+		maxReplicas := parseReplicasEnvVar(envVarScaleMaxReplicas, 10)
+		if minReplicas > maxReplicas {
+			logrus.Fatalf("'%s' must not be greater than '%s'", envVarScaleMinReplicas, envVarScaleMaxReplicas)
+		}
+		scaleOptions = append(scaleOptions, handler.WithReplicaLimits(minReplicas, maxReplicas))
+	}
+
+	return scaleOptions
+}
+
+// rolloutRestartActionOptions configures the RolloutRestartAction using environment variables
+func rolloutRestartActionOptions() []handler.RolloutRestartActionOption {
+	restartOptions := []handler.RolloutRestartActionOption{handler.WithRestartNamespaceTemplate(actionNamespaceTemplate())}
+
+	if os.Getenv(envVarRolloutTimeout) != "" {
+		rolloutTimeout, err := time.ParseDuration(os.Getenv(envVarRolloutTimeout))
+		if err != nil {
+			logrus.WithError(err).Fatal("could not parse rollout timeout provided by 'ROLLOUT_TIMEOUT' env var")
+		}
+		restartOptions = append(restartOptions, handler.WithRolloutTimeout(rolloutTimeout))
+	}
+
+	return restartOptions
+}
+
+// scriptActionOptions configures the ScriptActions using environment variables
+func scriptActionOptions() []handler.ScriptActionOption {
+	var scriptOptions []handler.ScriptActionOption
+
+	if os.Getenv(envVarScriptTimeout) != "" {
+		scriptTimeout, err := time.ParseDuration(os.Getenv(envVarScriptTimeout))
+		if err != nil {
+			logrus.WithError(err).Fatal("could not parse script timeout provided by 'SCRIPT_TIMEOUT' env var")
+		}
+		scriptOptions = append(scriptOptions, handler.WithScriptTimeout(scriptTimeout))
+	}
+
+	return scriptOptions
+}
+
+// readWebhookConfig reads the configuration of the webhook actions from the given file
+func readWebhookConfig(filename string) *handler.WebhookConfig {
+	content, err := ioutil.ReadFile(filename)
+	if err != nil {
+		logrus.WithError(err).Fatal("could not read webhook config provided by 'WEBHOOK_CONFIG' env var")
+	}
+	webhookConfig, err := handler.ParseWebhookConfig(content)
+	if err != nil {
+		logrus.WithError(err).Fatal("could not parse webhook config provided by 'WEBHOOK_CONFIG' env var")
+	}
+	return webhookConfig
+}
+
+// parseReplicasEnvVar returns the number of replicas configured by the given env var or the default if it is not set
+func parseReplicasEnvVar(envVar string, defaultReplicas int32) int32 {
+	if os.Getenv(envVar) == "" {
+		return defaultReplicas
+	}
+	replicas, err := strconv.ParseInt(os.Getenv(envVar), 10, 32)
+	if err != nil || replicas < 0 {
+		logrus.WithError(err).Fatalf("could not parse number of replicas provided by '%s' env var", envVar)
+	}
+	return int32(replicas)
+}
+
+// actionNamespaceTemplate returns the template for the namespace of the Kubernetes workloads remediation actions are applied to
+func actionNamespaceTemplate() *handler.NamespaceTemplate {
+	text := handler.DefaultNamespaceTemplate
+	if os.Getenv(envVarActionNamespaceTemplate) != "" {
+		text = os.Getenv(envVarActionNamespaceTemplate)
+	}
+	namespaceTemplate, err := handler.ParseNamespaceTemplate(text)
+	if err != nil {
+		logrus.WithError(err).Fatal("could not parse namespace template provided by 'ACTION_NAMESPACE_TEMPLATE' env var")
+	}
+	return namespaceTemplate
+}
+
+// getSliEventHandlerOptions configures the GetSliEventHandler using environment variables
+func getSliEventHandlerOptions(sliBackends *handler.SLIBackendRegistry, clientset kubernetes.Interface) []handler.GetSliEventHandlerOption {
+	getSliOptions := []handler.GetSliEventHandlerOption{handler.WithSLIBackends(sliBackends)}
+
+	if clientset != nil {
+		var credentialsCacheTTL time.Duration
+		if os.Getenv(envVarCredentialsCacheTTL) != "" {
+			var err error
+			credentialsCacheTTL, err = time.ParseDuration(os.Getenv(envVarCredentialsCacheTTL))
+			if err != nil {
+				logrus.WithError(err).Fatal("could not parse credentials cache TTL provided by 'CREDENTIALS_CACHE_TTL' env var")
+			}
+		}
+		getSliOptions = append(getSliOptions, handler.WithCredentialsProvider(
+			handler.NewSecretCredentialsProvider(clientset, os.Getenv(envVarK8sNamespace), credentialsCacheTTL)))
+	}
+
+	if os.Getenv(envVarSLIFailurePolicy) != "" {
+		policy, err := handler.ParseSLIFailurePolicy(os.Getenv(envVarSLIFailurePolicy))
+		if err != nil {
+			logrus.WithError(err).Fatal("could not parse SLI failure policy provided by 'SLI_FAILURE_POLICY' env var")
+		}
+		getSliOptions = append(getSliOptions, handler.WithSLIFailurePolicy(policy))
+	}
+
+	if os.Getenv(envVarSLIMaxParallelism) != "" {
+		maxParallelism, err := strconv.Atoi(os.Getenv(envVarSLIMaxParallelism))
+		if err != nil {
+			logrus.WithError(err).Fatal("could not parse max parallelism provided by 'SLI_MAX_PARALLELISM' env var")
+		}
+		getSliOptions = append(getSliOptions, handler.WithMaxParallelism(maxParallelism))
+	}
+
+	if os.Getenv(envVarSLIQueryTimeout) != "" {
+		queryTimeout, err := time.ParseDuration(os.Getenv(envVarSLIQueryTimeout))
+		if err != nil {
+			logrus.WithError(err).Fatal("could not parse query timeout provided by 'SLI_QUERY_TIMEOUT' env var")
+		}
+		getSliOptions = append(getSliOptions, handler.WithQueryTimeout(queryTimeout))
+	}
+
+	sliCacheSize := defaultSLICacheSize
+	if os.Getenv(envVarSLICacheSize) != "" {
+		var err error
+		sliCacheSize, err = strconv.Atoi(os.Getenv(envVarSLICacheSize))
+		if err != nil {
+			logrus.WithError(err).Fatal("could not parse SLI cache size provided by 'SLI_CACHE_SIZE' env var")
+		}
+	}
+	sliCacheTTL := defaultSLICacheTTL
+	if os.Getenv(envVarSLICacheTTL) != "" {
+		var err error
+		sliCacheTTL, err = time.ParseDuration(os.Getenv(envVarSLICacheTTL))
+		if err != nil {
+			logrus.WithError(err).Fatal("could not parse SLI cache TTL provided by 'SLI_CACHE_TTL' env var")
+		}
+	}
+	if sliCacheSize > 0 && sliCacheTTL > 0 {
+		cache := handler.NewSLIResultCache(sliCacheSize, sliCacheTTL)
+		cache.Publish("sli_result_cache")
+		getSliOptions = append(getSliOptions, handler.WithSLIResultCache(cache))
+	}
+
+	return getSliOptions
+}
+
+// getKubernetesClients creates a clientset and a dynamic client for the cluster the service is running in
+func getKubernetesClients() (kubernetes.Interface, dynamic.Interface, error) {
+	config, err := rest.InClusterConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, nil, err
+	}
+	return clientset, dynamicClient, nil
 }
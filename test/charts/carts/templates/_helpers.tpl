@@ -0,0 +1,3 @@
+{{- define "carts.labels" -}}
+app.kubernetes.io/name: {{ .Release.Name }}
+{{- end -}}